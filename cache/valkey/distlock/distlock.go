@@ -14,6 +14,14 @@ type DistLockValkey struct {
 	KeyPrefix     string
 	ChannelPrefix string
 	Timeout       time.Duration
+	HashTag       bool
+}
+
+func (d *DistLockValkey) lockKey(key string) string {
+	if d.HashTag {
+		return d.KeyPrefix + HashTag(key)
+	}
+	return d.KeyPrefix + key
 }
 
 func (d *DistLockValkey) Lock(ctx context.Context, key string, value string) error {
@@ -21,7 +29,7 @@ func (d *DistLockValkey) Lock(ctx context.Context, key string, value string) err
 }
 
 func (d *DistLockValkey) LockWithExpiry(ctx context.Context, key string, value string, expiry time.Duration) error {
-	err := d.Client.Do(ctx, d.Client.B().Set().Key(d.KeyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+	err := d.Client.Do(ctx, d.Client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
 	if err == nil {
 		return nil
 	}
@@ -57,7 +65,7 @@ func (d *DistLockValkey) LockWithExpiry(ctx context.Context, key string, value s
 		}
 
 		err = d.Client.Do(ctx,
-			d.Client.B().Set().Key(d.KeyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+			d.Client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
 		if err != nil {
 			return errors.New("acquire lock: " + err.Error())
 		}
@@ -67,7 +75,7 @@ func (d *DistLockValkey) LockWithExpiry(ctx context.Context, key string, value s
 
 func (d *DistLockValkey) Unlock(ctx context.Context, key string, value string) error {
 	err := d.Client.Do(ctx,
-		d.Client.B().Del().Key(d.KeyPrefix+key).Build()).Error()
+		d.Client.B().Del().Key(d.lockKey(key)).Build()).Error()
 	if err != nil {
 		return err
 	}
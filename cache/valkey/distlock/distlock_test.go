@@ -0,0 +1,168 @@
+package distlock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+type locker interface {
+	Lock(ctx context.Context, key string, value string) error
+	LockWithExpiry(ctx context.Context, key string, value string, expiry time.Duration) error
+	Unlock(ctx context.Context, key string, value string) error
+}
+
+func newLocks(t *testing.T, client valkey.Client, timeout time.Duration) map[string]locker {
+	v3 := distlock.NewDistLockValkeyV3(context.Background(), client, "lock:", "chan:", timeout, 0)
+	t.Cleanup(func() { v3.Close() })
+	return map[string]locker{
+		"v2": distlock.NewDistLockValkeyV2(client, "lock:", "chan:", timeout, 0),
+		"v3": v3,
+	}
+}
+
+func TestLockWaitsForUnlock(t *testing.T) {
+	for name, l := range newLocks(t, valkeytest.NewClient(t, valkeytest.Start(t)), 5*time.Second) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := l.Lock(ctx, "1", "a"); err != nil {
+				t.Fatalf("lock a: %v", err)
+			}
+
+			acquired := make(chan error, 1)
+			go func() { acquired <- l.Lock(ctx, "1", "b") }()
+			select {
+			case err := <-acquired:
+				t.Fatalf("lock b acquired a held lock: %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if err := l.Unlock(ctx, "1", "a"); err != nil {
+				t.Fatalf("unlock a: %v", err)
+			}
+			select {
+			case err := <-acquired:
+				if err != nil {
+					t.Fatalf("lock b: %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("lock b was not acquired after unlock")
+			}
+			if err := l.Unlock(ctx, "1", "b"); err != nil {
+				t.Fatalf("unlock b: %v", err)
+			}
+		})
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	for name, l := range newLocks(t, valkeytest.NewClient(t, valkeytest.Start(t)), 50*time.Millisecond) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := l.Lock(ctx, "1", "a"); err != nil {
+				t.Fatalf("lock a: %v", err)
+			}
+			defer l.Unlock(ctx, "1", "a")
+
+			var lockErr *distlock.AcquireLockError
+			err := l.Lock(ctx, "1", "b")
+			if !errors.As(err, &lockErr) || !errors.Is(err, distlock.ErrLockNotAcquired) {
+				t.Fatalf("lock b: got %v, want an AcquireLockError of ErrLockNotAcquired", err)
+			}
+		})
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	for name, l := range newLocks(t, valkeytest.NewClient(t, valkeytest.Start(t)), 50*time.Millisecond) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := l.LockWithExpiry(ctx, "1", "a", time.Second); err != nil {
+				t.Fatalf("lock a: %v", err)
+			}
+			time.Sleep(1100 * time.Millisecond)
+			if err := l.Lock(ctx, "1", "b"); err != nil {
+				t.Fatalf("lock b after expiry: %v", err)
+			}
+			l.Unlock(ctx, "1", "b")
+		})
+	}
+}
+
+func TestLockFailsFastOnValkeyError(t *testing.T) {
+	s := valkeytest.Start(t)
+	for name, l := range newLocks(t, valkeytest.NewClient(t, s), 5*time.Second) {
+		t.Run(name, func(t *testing.T) {
+			s.FailCommand("SET", "ERR injected", 1)
+
+			start := time.Now()
+			err := l.Lock(context.Background(), "1", "a")
+			var lockErr *distlock.AcquireLockError
+			if !errors.As(err, &lockErr) || lockErr.Err == nil || errors.Is(err, distlock.ErrLockNotAcquired) {
+				t.Fatalf("lock: got %v, want an AcquireLockError of the valkey error", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("lock waited %v for a release", elapsed)
+			}
+		})
+	}
+}
+
+func TestLockHashTag(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	l := distlock.NewDistLockValkeyV3(ctx, client, "lock:", "chan:", time.Second, 0).WithHashTag()
+	defer l.Close()
+
+	if err := l.Lock(ctx, "1", "a"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if v, err := client.Do(ctx, client.B().Get().Key("lock:{1}").Build()).ToString(); err != nil || v != "a" {
+		t.Errorf("get lock:{1} = %q, %v, want a", v, err)
+	}
+	if got := distlock.HashTag("reserve:{1}"); got != "reserve:{1}" {
+		t.Errorf("HashTag of a tagged key = %q", got)
+	}
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	l := distlock.NewDistLockValkeyV3(ctx, client, "lock:", "chan:", time.Second, 0)
+	defer l.Close()
+
+	if holder, err := l.Holder(ctx, "1"); err != nil || holder != "" {
+		t.Fatalf("holder of a free lock = %q, %v", holder, err)
+	}
+	if err := l.Lock(ctx, "1", "a"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if holder, err := l.Holder(ctx, "1"); err != nil || holder != "a" {
+		t.Fatalf("holder = %q, %v, want a", holder, err)
+	}
+
+	if err := l.Extend(ctx, "1", "b", time.Minute); !errors.Is(err, distlock.ErrLockNotHeld) {
+		t.Errorf("extend by b: got %v, want ErrLockNotHeld", err)
+	}
+	if err := l.Extend(ctx, "1", "a", 100*time.Millisecond); err != nil {
+		t.Errorf("extend by a: %v", err)
+	}
+	if ttl, _ := client.Do(ctx, client.B().Pttl().Key("lock:1").Build()).AsInt64(); ttl <= 0 || ttl > 100 {
+		t.Errorf("pttl after extend = %d", ttl)
+	}
+
+	if err := l.Release(ctx, "1", "b"); !errors.Is(err, distlock.ErrLockNotHeld) {
+		t.Errorf("release by b: got %v, want ErrLockNotHeld", err)
+	}
+	if err := l.Release(ctx, "1", "a"); err != nil {
+		t.Errorf("release by a: %v", err)
+	}
+	if err := l.Release(ctx, "1", "a"); !errors.Is(err, distlock.ErrLockNotHeld) {
+		t.Errorf("second release: got %v, want ErrLockNotHeld", err)
+	}
+}
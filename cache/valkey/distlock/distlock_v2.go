@@ -15,6 +15,7 @@ type DistLockValkeyV2 struct {
 
 	defaultExpiry time.Duration
 	retry         int8
+	hashTag       bool
 }
 
 func NewDistLockValkeyV2(client valkey.Client, keyPrefix, channelPrefix string, timeout time.Duration, retry int8) *DistLockValkeyV2 {
@@ -29,6 +30,20 @@ func NewDistLockValkeyV2(client valkey.Client, keyPrefix, channelPrefix string,
 	}
 }
 
+// WithHashTag makes the lock hash tag its keys so that they can be co-located with the
+// data they guard on a cluster.
+func (d *DistLockValkeyV2) WithHashTag() *DistLockValkeyV2 {
+	d.hashTag = true
+	return d
+}
+
+func (d *DistLockValkeyV2) lockKey(key string) string {
+	if d.hashTag {
+		return d.keyPrefix + HashTag(key)
+	}
+	return d.keyPrefix + key
+}
+
 func (d *DistLockValkeyV2) Lock(ctx context.Context, key string, value string) error {
 	return d.LockWithExpiry(ctx, key, value, d.defaultExpiry)
 }
@@ -38,13 +53,14 @@ func (d *DistLockValkeyV2) LockWithExpiry(ctx context.Context, key string, value
 		return d.lockWithExpiry(ctx, key, value, expiry)
 	}
 
+	var err error
 	for i := int8(0); i < d.retry; i++ {
-		err := d.lockWithExpiry(ctx, key, value, expiry)
+		err = d.lockWithExpiry(ctx, key, value, expiry)
 		if err == nil {
 			return nil
 		}
 	}
-	return NewAcquireLockError("retry limit reached")
+	return AsAcquireLockError("retry limit reached", err)
 }
 
 func (d *DistLockValkeyV2) Unlock(ctx context.Context, key string, value string) error {
@@ -52,7 +68,7 @@ func (d *DistLockValkeyV2) Unlock(ctx context.Context, key string, value string)
 	defer cancel()
 
 	err := c.Do(ctx,
-		c.B().Del().Key(d.keyPrefix+key).Build()).Error()
+		c.B().Del().Key(d.lockKey(key)).Build()).Error()
 	if err != nil {
 		return err
 	}
@@ -70,11 +86,15 @@ func (d *DistLockValkeyV2) lockWithExpiry(ctx context.Context, key string, value
 	defer cancelClient()
 
 	err := client.Do(ctx,
-		client.B().Set().Key(d.keyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+		client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
 	if err == nil {
 		// fmt.Println("lock in first attempt")
 		return nil
 	}
+	if !valkey.IsValkeyNil(err) {
+		// valkey failed rather than the lock being held, so waiting for a release is pointless
+		return AsAcquireLockError("trying to acquire lock", err)
+	}
 
 	pubsubClient, cancelPubsubClient := d.client.Dedicate()
 	defer cancelPubsubClient()
@@ -91,22 +111,27 @@ func (d *DistLockValkeyV2) lockWithExpiry(ctx context.Context, key string, value
 	})
 	err = pubsubClient.Do(ctxSub, pubsubClient.B().Subscribe().Channel(d.channelPrefix+key).Build()).Error()
 	if err != nil {
-		return NewAcquireLockError("subscribe: " + err.Error())
+		return AsAcquireLockError("subscribe", err)
 	}
 
 	select {
 	case <-ctxSub.Done():
-		return NewAcquireLockError("subscribe done: " + ctxSub.Err().Error())
+		// the lock was not released in time
+		return newLockNotAcquired("subscribe done: " + ctxSub.Err().Error())
 	case err := <-w:
 		if err != nil {
-			return NewAcquireLockError("disconnected subscriber: " + err.Error())
+			return AsAcquireLockError("disconnected subscriber", err)
 		}
 		return NewAcquireLockError("disconnected subscriber: unknown error")
 	case <-wait:
 		err = client.Do(ctx,
-			client.B().Set().Key(d.keyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+			client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
+		if valkey.IsValkeyNil(err) {
+			// someone else took the lock once it was released
+			return newLockNotAcquired("taken after release")
+		}
 		if err != nil {
-			return NewAcquireLockError(err.Error())
+			return AsAcquireLockError("trying to acquire lock", err)
 		}
 		// fmt.Println("lock after second attempt")
 		return nil
@@ -19,6 +19,7 @@ type DistLockValkeyV3 struct {
 
 	defaultExpiry time.Duration
 	retry         int8
+	hashTag       bool
 
 	lockChans     map[string]chan string
 	lockChansLock sync.RWMutex
@@ -129,6 +130,20 @@ func (d *DistLockValkeyV3) releaseLockChans(key string) {
 	// fmt.Println("channel not found")
 }
 
+// WithHashTag makes the lock hash tag its keys so that they can be co-located with the
+// data they guard on a cluster.
+func (d *DistLockValkeyV3) WithHashTag() *DistLockValkeyV3 {
+	d.hashTag = true
+	return d
+}
+
+func (d *DistLockValkeyV3) lockKey(key string) string {
+	if d.hashTag {
+		return d.keyPrefix + HashTag(key)
+	}
+	return d.keyPrefix + key
+}
+
 func (d *DistLockValkeyV3) Lock(ctx context.Context, key string, value string) error {
 	return d.LockWithExpiry(ctx, key, value, d.defaultExpiry)
 }
@@ -153,14 +168,14 @@ func (d *DistLockValkeyV3) Unlock(ctx context.Context, key string, value string)
 	defer cancel()
 
 	err := c.Do(ctx,
-		c.B().Del().Key(d.keyPrefix+key).Build()).Error()
+		c.B().Del().Key(d.lockKey(key)).Build()).Error()
 	if err != nil {
 		return err
 	}
 
-	// d.addLockChans(d.keyPrefix + key)
+	// d.addLockChans(d.lockKey(key))
 	err = c.Do(ctx,
-		c.B().Publish().Channel(d.channelPrefix).Message(d.keyPrefix+key).Build()).Error()
+		c.B().Publish().Channel(d.channelPrefix).Message(d.lockKey(key)).Build()).Error()
 	if err != nil {
 		return err
 	}
@@ -173,25 +188,33 @@ func (d *DistLockValkeyV3) lockWithExpiry(ctx context.Context, key string, value
 	defer cancelClient()
 
 	err := client.Do(ctx,
-		client.B().Set().Key(d.keyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+		client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
 	if err == nil {
 		d.lockMeasure.IncLock()
 		return nil
 	}
+	if !valkey.IsValkeyNil(err) {
+		// valkey failed rather than the lock being held, so waiting for a release is pointless
+		return AsAcquireLockError("trying to acquire lock", err)
+	}
 
-	ch := d.addLockChans(d.keyPrefix + key)
+	ch := d.addLockChans(d.lockKey(key))
 	// wait
 	// fmt.Printf("waiting for lock: %v\n", key)
 	select {
 	case <-ch:
 	case <-time.After(d.timeout):
-		return NewAcquireLockError("timeout")
+		return newLockNotAcquired("timeout")
 	case <-ctx.Done():
 		return AsAcquireLockError("context done: ", ctx.Err())
 	}
 
 	err = client.Do(ctx,
-		client.B().Set().Key(d.keyPrefix+key).Value(value).Nx().Ex(expiry).Build()).Error()
+		client.B().Set().Key(d.lockKey(key)).Value(value).Nx().Ex(expiry).Build()).Error()
+	if valkey.IsValkeyNil(err) {
+		// someone else took the lock once it was released
+		return newLockNotAcquired("taken after release")
+	}
 	if err != nil {
 		return AsAcquireLockError("trying to acquire lock", err)
 	}
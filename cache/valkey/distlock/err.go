@@ -1,9 +1,24 @@
 package distlock
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type AcquireLockError struct {
 	Msg string
+	// Err is ErrLockNotAcquired if the lock stayed held by someone else, or the error of the
+	// valkey call or context that failed, if any.
+	Err error
+}
+
+// ErrLockNotAcquired is wrapped by an AcquireLockError when the lock was held by someone else
+// for as long as it was waited for, as opposed to valkey or the context failing.
+var ErrLockNotAcquired = errors.New("distlock: lock not acquired")
+
+// newLockNotAcquired returns an AcquireLockError of a lock held by someone else.
+func newLockNotAcquired(msg string) *AcquireLockError {
+	return &AcquireLockError{Msg: msg, Err: ErrLockNotAcquired}
 }
 
 func NewAcquireLockError(msg string) *AcquireLockError {
@@ -19,7 +34,7 @@ func AsAcquireLockError(msg string, err error) *AcquireLockError {
 		return v
 	}
 
-	return &AcquireLockError{Msg: fmt.Sprintf("%s: %s", msg, err.Error())}
+	return &AcquireLockError{Msg: fmt.Sprintf("%s: %s", msg, err.Error()), Err: err}
 }
 
 func (e *AcquireLockError) Error() string {
@@ -28,3 +43,10 @@ func (e *AcquireLockError) Error() string {
 	}
 	return fmt.Sprintf("distlock acquire: %s", e.Msg)
 }
+
+func (e *AcquireLockError) Unwrap() error {
+	return e.Err
+}
+
+// ErrLockNotHeld is returned when a lock is extended or released by a value that does not hold it.
+var ErrLockNotHeld = errors.New("distlock: lock not held")
@@ -0,0 +1,14 @@
+package distlock
+
+import "strings"
+
+// HashTag wraps key in braces so that every key built from it is hashed to the same
+// cluster slot. Keys that already carry a hash tag, such as `reserve:{1}`, are returned as is.
+func HashTag(key string) string {
+	if i := strings.Index(key, "{"); i >= 0 {
+		if j := strings.Index(key[i+1:], "}"); j > 0 {
+			return key
+		}
+	}
+	return "{" + key + "}"
+}
@@ -0,0 +1,78 @@
+package distlock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Holder returns the value of the holder of the lock on key, or an empty string if it is free.
+func (d *DistLockValkeyV3) Holder(ctx context.Context, key string) (string, error) {
+	v, err := d.client.Do(ctx, d.client.B().Get().Key(d.lockKey(key)).Build()).ToString()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+// Extend resets the expiry of the lock on key if it is still held by value, and returns
+// ErrLockNotHeld otherwise. Unlike Lock, the expiry may be shorter than a second.
+func (d *DistLockValkeyV3) Extend(ctx context.Context, key string, value string, expiry time.Duration) error {
+	lockKey := d.lockKey(key)
+	return d.casHeld(ctx, lockKey, value, d.client.B().Pexpire().Key(lockKey).Milliseconds(expiry.Milliseconds()).Build())
+}
+
+// Release unlocks key if it is still held by value, and returns ErrLockNotHeld otherwise.
+// Unlike Unlock, it never removes a lock that expired and was acquired by someone else.
+func (d *DistLockValkeyV3) Release(ctx context.Context, key string, value string) error {
+	lockKey := d.lockKey(key)
+	if err := d.casHeld(ctx, lockKey, value, d.client.B().Del().Key(lockKey).Build()); err != nil {
+		return err
+	}
+
+	err := d.client.Do(ctx, d.client.B().Publish().Channel(d.channelPrefix).Message(lockKey).Build()).Error()
+	if err != nil {
+		return err
+	}
+	d.lockMeasure.IncUnlock()
+	return nil
+}
+
+// casHeld runs cmd in a transaction that is only executed if lockKey is held by value.
+func (d *DistLockValkeyV3) casHeld(ctx context.Context, lockKey string, value string, cmd valkey.Completed) error {
+	c, cancel := d.client.Dedicate()
+	defer cancel()
+
+	if err := c.Do(ctx, c.B().Watch().Key(lockKey).Build()).Error(); err != nil {
+		return err
+	}
+	holder, err := c.Do(ctx, c.B().Get().Key(lockKey).Build()).ToString()
+	if err != nil && !valkey.IsValkeyNil(err) {
+		return err
+	}
+	if holder != value {
+		_ = c.Do(ctx, c.B().Unwatch().Build()).Error()
+		return ErrLockNotHeld
+	}
+
+	res := c.DoMulti(ctx,
+		c.B().Multi().Build(),
+		cmd,
+		c.B().Exec().Build(),
+	)
+	for i, r := range res {
+		if valkey.IsValkeyNil(r.Error()) {
+			// the lock expired or changed hands after it was read
+			return ErrLockNotHeld
+		}
+		if r.Error() != nil {
+			return fmt.Errorf("cas %s(resInd=%d): %v", lockKey, i, r.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package factory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+type Mode string
+
+const (
+	ModeStandalone Mode = "standalone"
+	ModeSentinel   Mode = "sentinel"
+	ModeCluster    Mode = "cluster"
+)
+
+// Config describes how to connect to valkey.
+// Addrs are the server addresses for standalone and cluster modes, and the sentinel
+// addresses for sentinel mode.
+type Config struct {
+	Mode         Mode     `json:"mode"`
+	Addrs        []string `json:"addrs"`
+	MasterSet    string   `json:"master_set"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	DB           int      `json:"db"`
+	DisableCache bool     `json:"disable_cache"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mode:  ModeStandalone,
+		Addrs: []string{"127.0.0.1:6379"},
+	}
+}
+
+// Load reads the config file at path, if any, and overrides it with the environment.
+func Load(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("load valkey config: %v", err)
+		}
+		if err = json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("load valkey config: %v", err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// LoadFromEnv reads the config file named by VALKEY_CONFIG, if set, and the environment.
+func LoadFromEnv() (Config, error) {
+	return Load(os.Getenv("VALKEY_CONFIG"))
+}
+
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("VALKEY_MODE"); v != "" {
+		c.Mode = Mode(strings.ToLower(v))
+	}
+	if v := os.Getenv("VALKEY_ADDRS"); v != "" {
+		c.Addrs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("VALKEY_MASTER_SET"); v != "" {
+		c.MasterSet = v
+	}
+	if v := os.Getenv("VALKEY_USERNAME"); v != "" {
+		c.Username = v
+	}
+	if v := os.Getenv("VALKEY_PASSWORD"); v != "" {
+		c.Password = v
+	}
+	if v := os.Getenv("VALKEY_DB"); v != "" {
+		db, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("load valkey config: VALKEY_DB: %v", err)
+		}
+		c.DB = db
+	}
+	if v := os.Getenv("VALKEY_DISABLE_CACHE"); v != "" {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("load valkey config: VALKEY_DISABLE_CACHE: %v", err)
+		}
+		c.DisableCache = disable
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if len(c.Addrs) == 0 {
+		return fmt.Errorf("valkey config: no address")
+	}
+	switch c.Mode {
+	case ModeStandalone:
+	case ModeSentinel:
+		if c.MasterSet == "" {
+			return fmt.Errorf("valkey config: sentinel mode requires master_set")
+		}
+	case ModeCluster:
+		if c.DB != 0 {
+			return fmt.Errorf("valkey config: cluster mode supports db 0 only")
+		}
+	default:
+		return fmt.Errorf("valkey config: unknown mode %q", c.Mode)
+	}
+	return nil
+}
+
+// Cluster reports whether keys touched together must share a hash tag.
+func (c Config) Cluster() bool {
+	return c.Mode == ModeCluster
+}
+
+// RequireHashTag returns an error if c is of a cluster and the keys of a schema are not hash
+// tagged. A transaction may only touch keys of one slot of a cluster, which keys of the same
+// id share only when they are hash tagged.
+func (c Config) RequireHashTag(hashTag bool) error {
+	if c.Cluster() && !hashTag {
+		return fmt.Errorf("valkey config: cluster mode requires hash tagged keys")
+	}
+	return nil
+}
+
+func (c Config) ClientOption() valkey.ClientOption {
+	opt := valkey.ClientOption{
+		InitAddress:  c.Addrs,
+		Username:     c.Username,
+		Password:     c.Password,
+		SelectDB:     c.DB,
+		DisableCache: c.DisableCache,
+	}
+	switch c.Mode {
+	case ModeStandalone:
+		opt.ForceSingleClient = true
+	case ModeSentinel:
+		opt.Sentinel = valkey.SentinelOption{
+			MasterSet: c.MasterSet,
+			Username:  c.Username,
+			Password:  c.Password,
+		}
+	case ModeCluster:
+		opt.ShuffleInit = true
+	}
+	return opt
+}
+
+func NewClient(c Config) (valkey.Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return valkey.NewClient(c.ClientOption())
+}
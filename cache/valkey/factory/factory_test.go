@@ -0,0 +1,177 @@
+package factory_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/factory"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  factory.Config
+		err  string
+	}{
+		{"default", factory.DefaultConfig(), ""},
+		{"standalone db", factory.Config{Mode: factory.ModeStandalone, Addrs: []string{"a:6379"}, DB: 3}, ""},
+		{"no address", factory.Config{Mode: factory.ModeStandalone}, "no address"},
+		{"sentinel", factory.Config{Mode: factory.ModeSentinel, Addrs: []string{"s:26379"}, MasterSet: "mymaster"}, ""},
+		{"sentinel without master set", factory.Config{Mode: factory.ModeSentinel, Addrs: []string{"s:26379"}}, "requires master_set"},
+		{"cluster", factory.Config{Mode: factory.ModeCluster, Addrs: []string{"c1:6379", "c2:6379"}}, ""},
+		{"cluster db", factory.Config{Mode: factory.ModeCluster, Addrs: []string{"c1:6379"}, DB: 1}, "db 0 only"},
+		{"unknown mode", factory.Config{Mode: "ring", Addrs: []string{"a:6379"}}, "unknown mode"},
+		{"empty mode", factory.Config{Addrs: []string{"a:6379"}}, "unknown mode"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRequireHashTag(t *testing.T) {
+	cluster := factory.Config{Mode: factory.ModeCluster, Addrs: []string{"c1:6379"}}
+	if err := cluster.RequireHashTag(false); err == nil || !strings.Contains(err.Error(), "hash tagged") {
+		t.Errorf("cluster without hash tags: %v", err)
+	}
+	if err := cluster.RequireHashTag(true); err != nil {
+		t.Errorf("cluster with hash tags: %v", err)
+	}
+	if err := factory.DefaultConfig().RequireHashTag(false); err != nil {
+		t.Errorf("standalone without hash tags: %v", err)
+	}
+}
+
+var envKeys = []string{
+	"VALKEY_MODE", "VALKEY_ADDRS", "VALKEY_MASTER_SET", "VALKEY_USERNAME",
+	"VALKEY_PASSWORD", "VALKEY_DB", "VALKEY_DISABLE_CACHE", "VALKEY_CONFIG",
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "valkey.json")
+	if err := os.WriteFile(file, []byte(`{"mode":"sentinel","addrs":["s1:26379"],"master_set":"file","db":2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		env  map[string]string
+		want factory.Config
+		err  string
+	}{
+		{
+			name: "defaults",
+			want: factory.DefaultConfig(),
+		},
+		{
+			name: "file",
+			path: file,
+			want: factory.Config{Mode: factory.ModeSentinel, Addrs: []string{"s1:26379"}, MasterSet: "file", DB: 2},
+		},
+		{
+			name: "env overrides file",
+			path: file,
+			env: map[string]string{
+				"VALKEY_ADDRS":         "s2:26379,s3:26379",
+				"VALKEY_MASTER_SET":    "env",
+				"VALKEY_USERNAME":      "user",
+				"VALKEY_PASSWORD":      "secret",
+				"VALKEY_DB":            "5",
+				"VALKEY_DISABLE_CACHE": "true",
+			},
+			want: factory.Config{
+				Mode: factory.ModeSentinel, Addrs: []string{"s2:26379", "s3:26379"}, MasterSet: "env",
+				Username: "user", Password: "secret", DB: 5, DisableCache: true,
+			},
+		},
+		{
+			name: "mode is case insensitive",
+			env:  map[string]string{"VALKEY_MODE": "CLUSTER", "VALKEY_ADDRS": "c1:6379"},
+			want: factory.Config{Mode: factory.ModeCluster, Addrs: []string{"c1:6379"}},
+		},
+		{
+			name: "env is validated",
+			env:  map[string]string{"VALKEY_MODE": "cluster", "VALKEY_DB": "1"},
+			err:  "db 0 only",
+		},
+		{
+			name: "invalid db",
+			env:  map[string]string{"VALKEY_DB": "one"},
+			err:  "VALKEY_DB",
+		},
+		{
+			name: "invalid disable cache",
+			env:  map[string]string{"VALKEY_DISABLE_CACHE": "sometimes"},
+			err:  "VALKEY_DISABLE_CACHE",
+		},
+		{
+			name: "missing file",
+			path: filepath.Join(dir, "missing.json"),
+			err:  "load valkey config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range envKeys {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg, err := factory.Load(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("config = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valkey.json")
+	if err := os.WriteFile(file, []byte(`{"addrs":["file:6379"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+	t.Setenv("VALKEY_CONFIG", file)
+
+	cfg, err := factory.LoadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mode != factory.ModeStandalone || len(cfg.Addrs) != 1 || cfg.Addrs[0] != "file:6379" {
+		t.Errorf("config = %+v, want the file over the defaults", cfg)
+	}
+}
+
+func TestClientOption(t *testing.T) {
+	standalone := factory.Config{Mode: factory.ModeStandalone, Addrs: []string{"a:6379"}, DB: 1}.ClientOption()
+	if !standalone.ForceSingleClient || standalone.SelectDB != 1 {
+		t.Errorf("standalone = %+v", standalone)
+	}
+	sentinel := factory.Config{Mode: factory.ModeSentinel, Addrs: []string{"s:26379"}, MasterSet: "m", Password: "p"}.ClientOption()
+	if sentinel.Sentinel.MasterSet != "m" || sentinel.Sentinel.Password != "p" || sentinel.ForceSingleClient {
+		t.Errorf("sentinel = %+v", sentinel)
+	}
+	cluster := factory.Config{Mode: factory.ModeCluster, Addrs: []string{"c:6379"}}.ClientOption()
+	if !cluster.ShuffleInit || cluster.ForceSingleClient {
+		t.Errorf("cluster = %+v", cluster)
+	}
+}
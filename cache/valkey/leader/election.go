@@ -0,0 +1,251 @@
+// Package leader elects one instance among many to run jobs that must not run twice, such
+// as sweeps and reconciliations.
+//
+// The leader holds a distlock under the name of the election, valued by its identity, as a
+// lease that it renews well before it expires. If it cannot renew in time it steps down,
+// so two instances only lead at once if one of them stalls for longer than the lease.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+)
+
+type electionMeasure struct {
+	Elected     atomic.Int64
+	Revoked     atomic.Int64
+	RenewFailed atomic.Int64
+}
+
+func (m *electionMeasure) String() string {
+	return fmt.Sprintf("elected: %d, revoked: %d, renew_failed: %d",
+		m.Elected.Load(), m.Revoked.Load(), m.RenewFailed.Load())
+}
+
+// Election campaigns for the leadership of name on behalf of the instance identified by id.
+type Election struct {
+	lock          *distlock.DistLockValkeyV3
+	name          string
+	id            string
+	lease         time.Duration
+	renewInterval time.Duration
+	retryInterval time.Duration
+
+	onElected func(ctx context.Context)
+	onRevoked func()
+
+	mu      sync.Mutex
+	term    context.Context
+	endTerm context.CancelFunc
+	renewed chan struct{}
+
+	measure *electionMeasure
+}
+
+// NewElection creates an Election holding a lease of the given length, which the lock
+// requires to be at least a second. The lease is renewed every third of its length.
+func NewElection(lock *distlock.DistLockValkeyV3, name, id string, lease time.Duration) *Election {
+	return &Election{
+		lock:          lock,
+		name:          name,
+		id:            id,
+		lease:         lease,
+		renewInterval: lease / 3,
+		retryInterval: time.Second,
+		measure:       &electionMeasure{},
+	}
+}
+
+// WithRenewInterval renews the lease every d instead of every third of it.
+func (e *Election) WithRenewInterval(d time.Duration) *Election {
+	e.renewInterval = d
+	return e
+}
+
+// WithOnElected calls fn in its own goroutine whenever this instance becomes the leader.
+// ctx is cancelled when the term ends, which is when fn should stop leading.
+func (e *Election) WithOnElected(fn func(ctx context.Context)) *Election {
+	e.onElected = fn
+	return e
+}
+
+// WithOnRevoked calls fn whenever a term of this instance ends, by resigning or by losing
+// the lease.
+func (e *Election) WithOnRevoked(fn func()) *Election {
+	e.onRevoked = fn
+	return e
+}
+
+func (e *Election) ID() string {
+	return e.id
+}
+
+func (e *Election) String() string {
+	return e.measure.String()
+}
+
+// IsLeader reports whether this instance is in a term.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.term != nil
+}
+
+// Leader returns the identity of the current leader, or an empty string if there is none.
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	return e.lock.Holder(ctx, e.name)
+}
+
+// Campaign blocks until this instance is elected or ctx is done. It returns a context of
+// the term, which is cancelled when the term ends; cancelling ctx after the election does
+// not end it. Campaigning while in a term returns the current one.
+func (e *Election) Campaign(ctx context.Context) (context.Context, error) {
+	e.mu.Lock()
+	if e.term != nil {
+		term := e.term
+		e.mu.Unlock()
+		return term, nil
+	}
+	e.mu.Unlock()
+
+	for {
+		start := time.Now()
+		err := e.lock.LockWithExpiry(ctx, e.name, e.id, e.lease)
+		if err == nil {
+			return e.begin(ctx, start), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if errors.Is(err, distlock.ErrLockNotAcquired) {
+			// someone else leads; the lock already waited for a release
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(e.retryInterval):
+		}
+	}
+}
+
+// Resign ends the term of this instance and releases the lease, so that another instance
+// can be elected right away. It does nothing if this instance is not the leader.
+func (e *Election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	term, renewed := e.term, e.renewed
+	e.mu.Unlock()
+	if term == nil {
+		return nil
+	}
+
+	if !e.end(term) {
+		return nil
+	}
+	<-renewed
+
+	err := e.lock.Release(ctx, e.name, e.id)
+	if err != nil && !errors.Is(err, distlock.ErrLockNotHeld) {
+		return fmt.Errorf("resign %s: %v", e.name, err)
+	}
+	return nil
+}
+
+// Run campaigns again whenever a term ends, until ctx is done, and then resigns.
+func (e *Election) Run(ctx context.Context) error {
+	for {
+		term, err := e.Campaign(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			resignCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.renewInterval)
+			err := e.Resign(resignCtx)
+			cancel()
+			if err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-term.Done():
+		}
+	}
+}
+
+// begin starts a term whose lease was acquired at start.
+func (e *Election) begin(ctx context.Context, start time.Time) context.Context {
+	term, endTerm := context.WithCancel(context.WithoutCancel(ctx))
+	renewed := make(chan struct{})
+
+	e.mu.Lock()
+	e.term, e.endTerm, e.renewed = term, endTerm, renewed
+	e.mu.Unlock()
+	e.measure.Elected.Add(1)
+
+	go e.renew(term, renewed, start)
+	if e.onElected != nil {
+		go e.onElected(term)
+	}
+	return term
+}
+
+// end ends term, reporting false if it already ended.
+func (e *Election) end(term context.Context) bool {
+	e.mu.Lock()
+	if e.term != term {
+		e.mu.Unlock()
+		return false
+	}
+	e.endTerm()
+	e.term, e.endTerm = nil, nil
+	e.mu.Unlock()
+
+	e.measure.Revoked.Add(1)
+	if e.onRevoked != nil {
+		e.onRevoked()
+	}
+	return true
+}
+
+// renew extends the lease until term ends. The term ends once the lease is held by someone
+// else, or could expire before the next renewal because valkey keeps failing.
+func (e *Election) renew(term context.Context, renewed chan struct{}, start time.Time) {
+	defer close(renewed)
+
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-term.Done():
+			return
+		case <-ticker.C:
+		}
+
+		attempt := time.Now()
+		ctx, cancel := context.WithTimeout(term, e.renewInterval)
+		err := e.lock.Extend(ctx, e.name, e.id, e.lease)
+		cancel()
+		if err == nil {
+			start = attempt
+			continue
+		}
+		if term.Err() != nil {
+			return
+		}
+
+		e.measure.RenewFailed.Add(1)
+		if errors.Is(err, distlock.ErrLockNotHeld) || time.Since(start)+e.renewInterval >= e.lease {
+			e.end(term)
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package leader_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/leader"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+// events records the callbacks of elections and observers in order.
+type events struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.log = append(e.log, event)
+}
+
+func (e *events) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return strings.Join(e.log, " ")
+}
+
+func newLock(t *testing.T, s *valkeytest.Server) *distlock.DistLockValkeyV3 {
+	lock := distlock.NewDistLockValkeyV3(context.Background(), valkeytest.NewClient(t, s), "lock:", "chan:", 5*time.Second, 0)
+	t.Cleanup(func() { lock.Close() })
+	return lock
+}
+
+// newCandidate creates the election of id on a client of its own, recording its terms.
+func newCandidate(t *testing.T, s *valkeytest.Server, id string, ev *events) *leader.Election {
+	return leader.NewElection(newLock(t, s), "sweep", id, time.Second).
+		WithRenewInterval(100 * time.Millisecond).
+		WithOnElected(func(ctx context.Context) { ev.add(id + ":elected") }).
+		WithOnRevoked(func() { ev.add(id + ":revoked") })
+}
+
+func waitDone(t *testing.T, ctx context.Context, within time.Duration, what string) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(within):
+		t.Fatalf("%s did not happen within %v", what, within)
+	}
+}
+
+func eventually(t *testing.T, within time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not happen within %v", what, within)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestElection(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	ev := &events{}
+	a := newCandidate(t, s, "a", ev)
+	b := newCandidate(t, s, "b", ev)
+
+	var observed events
+	observer := leader.NewObserver(newLock(t, s), "sweep", 10*time.Millisecond).
+		WithOnLeaderChange(func(leader string) { observed.add("[" + leader + "]") })
+	observeCtx, stopObserving := context.WithCancel(ctx)
+	defer stopObserving()
+	go observer.Observe(observeCtx)
+
+	termA, err := a.Campaign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsLeader() {
+		t.Fatal("a is not the leader after its election")
+	}
+	// campaigning in a term returns it
+	if again, err := a.Campaign(ctx); err != nil || again != termA {
+		t.Errorf("campaign in a term = %v, %v, want the term", again, err)
+	}
+
+	elected := make(chan context.Context, 1)
+	go func() {
+		term, err := b.Campaign(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		elected <- term
+	}()
+	// the lease is renewed, so b keeps waiting past its length
+	time.Sleep(1500 * time.Millisecond)
+	if b.IsLeader() || termA.Err() != nil {
+		t.Fatal("b was elected while a renews its lease")
+	}
+	if l, err := b.Leader(ctx); err != nil || l != "a" {
+		t.Fatalf("leader = %q, %v, want a", l, err)
+	}
+	eventually(t, time.Second, "observing a", func() bool { return observer.Leader() == "a" })
+
+	if err = a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, termA, time.Second, "end of the term of a")
+	var termB context.Context
+	select {
+	case termB = <-elected:
+	case <-time.After(time.Second):
+		t.Fatal("b was not elected after a resigned")
+	}
+	if a.IsLeader() || !b.IsLeader() || termB.Err() != nil {
+		t.Fatalf("after resigning a leads = %v and b leads = %v", a.IsLeader(), b.IsLeader())
+	}
+	eventually(t, time.Second, "observing b", func() bool { return observer.Leader() == "b" })
+
+	if err = b.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, time.Second, "observing no leader", func() bool { return observer.Leader() == "" })
+
+	eventually(t, time.Second, "callbacks", func() bool {
+		return ev.String() == "a:elected a:revoked b:elected b:revoked" || ev.String() == "a:elected a:revoked b:revoked b:elected"
+	})
+	if got := observed.String(); got != "[a] [b] []" {
+		t.Errorf("observed leaders = %s, want [a] [b] []", got)
+	}
+	if got := a.String(); got != "elected: 1, revoked: 1, renew_failed: 0" {
+		t.Errorf("measure of a = %s", got)
+	}
+}
+
+func TestRenewalFailure(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	ev := &events{}
+	a := newCandidate(t, s, "a", ev)
+
+	term, err := a.Campaign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// renewals fail while the lease is still held, so a steps down before it may expire
+	s.FailCommand("WATCH", "ERR injected", -1)
+	steppedDown := time.Now()
+	waitDone(t, term, 2*time.Second, "stepping down")
+	if held := time.Since(steppedDown); held > time.Second {
+		t.Errorf("stepped down after %v, want before the lease of 1s expires", held)
+	}
+	if a.IsLeader() {
+		t.Error("a leads after stepping down")
+	}
+	if got := a.String(); !strings.HasPrefix(got, "elected: 1, revoked: 1, renew_failed: ") || strings.HasSuffix(got, "renew_failed: 0") {
+		t.Errorf("measure = %s, want failed renewals", got)
+	}
+	if got := ev.String(); got != "a:elected a:revoked" {
+		t.Errorf("callbacks = %s", got)
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	ev := &events{}
+	a := newCandidate(t, s, "a", ev)
+	b := newCandidate(t, s, "b", ev)
+
+	term, err := a.Campaign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lease of a expired and was taken over by b, as after a long stall of a
+	if err = client.Do(ctx, client.B().Set().Key("lock:sweep").Value("b").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, term, time.Second, "revocation")
+	if a.IsLeader() {
+		t.Error("a leads after losing its lease")
+	}
+	// resigning after the revocation leaves the lease of b alone
+	if err = a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := b.Leader(ctx); err != nil || l != "b" {
+		t.Errorf("leader = %q, %v, want b", l, err)
+	}
+	if got := ev.String(); got != "a:elected a:revoked" {
+		t.Errorf("callbacks = %s", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := valkeytest.Start(t)
+	ev := &events{}
+	a := newCandidate(t, s, "a", ev)
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+	eventually(t, time.Second, "election", a.IsLeader)
+
+	stop()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return")
+	}
+	// run resigns when it stops
+	if l, err := a.Leader(context.Background()); err != nil || l != "" {
+		t.Errorf("leader after run = %q, %v, want none", l, err)
+	}
+}
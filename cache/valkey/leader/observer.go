@@ -0,0 +1,74 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+)
+
+// Observer follows the leader of an election without campaigning in it, such as to route
+// requests to the leader.
+type Observer struct {
+	lock     *distlock.DistLockValkeyV3
+	name     string
+	interval time.Duration
+
+	onChange func(leader string)
+
+	mu     sync.RWMutex
+	leader string
+}
+
+// NewObserver creates an Observer reading the leader of name every interval.
+func NewObserver(lock *distlock.DistLockValkeyV3, name string, interval time.Duration) *Observer {
+	return &Observer{
+		lock:     lock,
+		name:     name,
+		interval: interval,
+	}
+}
+
+// WithOnLeaderChange calls fn with the identity of the new leader whenever Observe sees it
+// change, and with an empty string when there is none.
+func (o *Observer) WithOnLeaderChange(fn func(leader string)) *Observer {
+	o.onChange = fn
+	return o
+}
+
+// Leader returns the identity of the leader last seen, or an empty string if there was none.
+func (o *Observer) Leader() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.leader
+}
+
+// Observe reads the leader until ctx is done. Reads that fail keep the leader last seen.
+func (o *Observer) Observe(ctx context.Context) error {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		if leader, err := o.lock.Holder(ctx, o.name); err == nil {
+			o.set(leader)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Observer) set(leader string) {
+	o.mu.Lock()
+	changed := o.leader != leader
+	o.leader = leader
+	o.mu.Unlock()
+
+	if changed && o.onChange != nil {
+		o.onChange(leader)
+	}
+}
@@ -0,0 +1,225 @@
+package lincheck
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Model is the sequential specification a history is checked against.
+type Model struct {
+	// Partition splits a history into independent sub-histories, such as one per key.
+	// It is optional; without it the whole history is checked at once.
+	Partition func(ops []Operation) [][]Operation
+	// Init returns the initial state.
+	Init func() any
+	// Step applies input to state and reports whether output is a valid result of it,
+	// along with the next state. output is nil for pending operations.
+	Step func(state any, input any, output any) (bool, any)
+	// Equal compares two states.
+	Equal func(a, b any) bool
+}
+
+// Result is the outcome of checking a history.
+type Result struct {
+	Ok bool
+	// Partitions holds the sub-histories that are not linearizable.
+	Partitions [][]Operation
+}
+
+var ErrCheckTimeout = errors.New("check timed out")
+
+// Check reports whether ops is linearizable with respect to m, using the algorithm of
+// Wing and Gong with the memoization of Lowe, as done by Porcupine.
+// It returns ErrCheckTimeout if ctx is done before every partition is decided.
+func Check(ctx context.Context, m Model, ops []Operation) (Result, error) {
+	partitions := [][]Operation{ops}
+	if m.Partition != nil {
+		partitions = m.Partition(ops)
+	}
+
+	res := Result{Ok: true}
+	for _, p := range partitions {
+		ok, err := checkPartition(ctx, m, p)
+		if err != nil {
+			return res, err
+		}
+		if !ok {
+			res.Ok = false
+			res.Partitions = append(res.Partitions, p)
+		}
+	}
+	return res, nil
+}
+
+type entry struct {
+	id    int
+	call  bool
+	time  int64
+	value any
+	match *entry // return entry of a call entry
+	prev  *entry
+	next  *entry
+}
+
+// makeEntries returns the call and return events of ops as a doubly linked list sorted
+// by time, headed by a sentinel. Calls sort before returns at the same time.
+func makeEntries(ops []Operation) *entry {
+	type event struct {
+		id   int
+		call bool
+		time int64
+	}
+	events := make([]event, 0, 2*len(ops))
+	for i, op := range ops {
+		events = append(events, event{i, true, op.Call}, event{i, false, op.Return})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].call && !events[j].call
+	})
+
+	head := &entry{id: -1}
+	last := head
+	returns := make(map[int]*entry, len(ops))
+	calls := make(map[int]*entry, len(ops))
+	for _, ev := range events {
+		e := &entry{id: ev.id, call: ev.call, time: ev.time, prev: last}
+		if ev.call {
+			e.value = ops[ev.id].Input
+			calls[ev.id] = e
+		} else {
+			e.value = ops[ev.id].Output
+			returns[ev.id] = e
+		}
+		last.next = e
+		last = e
+	}
+	for id, c := range calls {
+		c.match = returns[id]
+	}
+	return head
+}
+
+// lift removes a call and its return from the list.
+func lift(e *entry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// unlift puts back a call and its return removed by lift.
+func unlift(e *entry) {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int)   { b[i/64] |= 1 << (uint(i) % 64) }
+func (b bitset) clear(i int) { b[i/64] &^= 1 << (uint(i) % 64) }
+
+func (b bitset) clone() bitset {
+	c := make(bitset, len(b))
+	copy(c, b)
+	return c
+}
+
+func (b bitset) equal(c bitset) bool {
+	for i := range b {
+		if b[i] != c[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) hash() uint64 {
+	var h uint64 = 14695981039346656037
+	for _, w := range b {
+		h ^= w
+		h *= 1099511628211
+	}
+	return h
+}
+
+type cacheEntry struct {
+	linearized bitset
+	state      any
+}
+
+type frame struct {
+	entry *entry
+	state any
+}
+
+func checkPartition(ctx context.Context, m Model, ops []Operation) (bool, error) {
+	head := makeEntries(ops)
+	state := m.Init()
+	linearized := newBitset(len(ops))
+	cache := make(map[uint64][]cacheEntry)
+	var calls []frame
+
+	seen := func(b bitset, s any) bool {
+		for _, c := range cache[b.hash()] {
+			if c.linearized.equal(b) && m.Equal(c.state, s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%1024 == 0 && ctx.Err() != nil {
+			return false, ErrCheckTimeout
+		}
+
+		if e.call {
+			ok, next := m.Step(state, e.value, e.match.value)
+			if ok {
+				b := linearized.clone()
+				b.set(e.id)
+				if !seen(b, next) {
+					h := b.hash()
+					cache[h] = append(cache[h], cacheEntry{b, next})
+					calls = append(calls, frame{e, state})
+					state = next
+					linearized.set(e.id)
+					lift(e)
+					e = head.next
+					continue
+				}
+			}
+			e = e.next
+			continue
+		}
+
+		// an operation returned before it could be linearized, so backtrack
+		if len(calls) == 0 {
+			return false, nil
+		}
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		state = top.state
+		linearized.clear(top.entry.id)
+		unlift(top.entry)
+		e = top.entry.next
+	}
+	return true, nil
+}
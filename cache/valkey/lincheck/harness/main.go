@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/lincheck"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+const usage = `usage: harness <scenario> [flags]
+
+Records a history of concurrent operations and checks it.
+
+scenarios:
+  lock      Lock and Unlock of a distributed lock, checked for mutual exclusion
+  adapter   CasZadd, Zadd, Zrem and Zrange of the reserve adapter, checked for linearizability
+  usecase   SetReserve and GetReserve of the reserve use case, checked for linearizability
+
+run 'harness <scenario> -h' for the flags of a scenario.
+`
+
+type options struct {
+	addr        string
+	clients     int
+	ops         int
+	keys        int
+	values      int
+	maxDelay    time.Duration
+	lockVersion string
+	lockTimeout time.Duration
+	expiry      time.Duration
+	hold        time.Duration
+	seed        int64
+	timeout     time.Duration
+}
+
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "addr", "", "Address of a valkey server; an in-process fake server is started if empty")
+	fs.IntVar(&o.clients, "clients", 8, "Number of concurrent clients")
+	fs.IntVar(&o.ops, "ops", 100, "Number of operations per client")
+	fs.IntVar(&o.keys, "keys", 2, "Number of distinct users (or lock keys)")
+	fs.IntVar(&o.values, "values", 4, "Number of distinct lives")
+	fs.DurationVar(&o.maxDelay, "max-delay", 2*time.Millisecond, "Maximum random delay the fake server adds before each command")
+	fs.StringVar(&o.lockVersion, "lock", "v3", "Distributed lock version, v2 or v3")
+	fs.DurationVar(&o.lockTimeout, "lock-timeout", 5*time.Second, "Time to wait for a lock")
+	fs.DurationVar(&o.expiry, "expiry", 0, "Expiry of a lock; the lock default if zero")
+	fs.DurationVar(&o.hold, "hold", time.Millisecond, "Time to hold a lock in the lock scenario")
+	fs.Int64Var(&o.seed, "seed", 0, "Seed of the random operations and delays; the current time if zero")
+	fs.DurationVar(&o.timeout, "check-timeout", time.Minute, "Time allowed to check a history")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	scenarios := map[string]func(context.Context, valkey.Client, *options) error{
+		"lock":    runLock,
+		"adapter": runAdapter,
+		"usecase": runUsecase,
+	}
+	name := os.Args[1]
+	scenario, ok := scenarios[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown scenario: %s\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	opts := &options{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts.bind(fs)
+	fs.Parse(os.Args[2:])
+	if opts.clients <= 0 || opts.ops <= 0 || opts.keys <= 0 || opts.values <= 0 {
+		fmt.Fprintln(os.Stderr, "clients, ops, keys and values must be positive")
+		os.Exit(2)
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+
+	addr := opts.addr
+	if addr == "" {
+		srv, err := valkeytest.NewServer()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "err: start fake server: %v\n", err)
+			os.Exit(1)
+		}
+		defer srv.Close()
+		srv.SetDelay(randomDelay(opts.seed, opts.maxDelay))
+		addr = srv.Addr()
+	}
+
+	client, err := valkey.NewClient(valkey.ClientOption{
+		InitAddress:       []string{addr},
+		ForceSingleClient: true,
+		DisableCache:      true,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err: connect valkey: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	fmt.Printf("scenario=%s, addr=%s, clients=%d, ops=%d, keys=%d, values=%d, seed=%d\n",
+		name, addr, opts.clients, opts.ops, opts.keys, opts.values, opts.seed)
+	if err = scenario(context.Background(), client, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "err: %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// randomDelay returns a delay function for the fake server drawing uniformly up to max.
+func randomDelay(seed int64, max time.Duration) func(cmd []string) time.Duration {
+	if max <= 0 {
+		return nil
+	}
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(seed))
+	return func(cmd []string) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Duration(rnd.Int63n(int64(max)))
+	}
+}
+
+// runClients runs opts.ops calls of op on each of opts.clients concurrent clients.
+func runClients(opts *options, op func(clientId int, rnd *rand.Rand)) {
+	var wg sync.WaitGroup
+	wg.Add(opts.clients)
+	for i := 0; i < opts.clients; i++ {
+		go func(clientId int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(opts.seed + int64(clientId) + 1))
+			for n := 0; n < opts.ops; n++ {
+				op(clientId, rnd)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func report(ops []lincheck.Operation) {
+	var pending int
+	for _, op := range ops {
+		if op.Pending() {
+			pending++
+		}
+	}
+	fmt.Printf("history: ops=%d, failed=%d\n", len(ops), pending)
+}
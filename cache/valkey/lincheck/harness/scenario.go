@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/lincheck"
+	"github.com/wonksing/go-tutorials/cache/valkey/loadtest/fixture"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/usecase"
+)
+
+func runLock(ctx context.Context, client valkey.Client, opts *options) error {
+	l, closeLock, err := fixture.NewLock(ctx, client, opts.lockVersion, "lincheck", "contention", opts.lockTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer closeLock()
+
+	rec := lincheck.NewRecorder()
+	runClients(opts, func(clientId int, rnd *rand.Rand) {
+		key := strconv.Itoa(rnd.Intn(opts.keys) + 1)
+		owner := fmt.Sprintf("%d-%d", clientId, rec.Now())
+
+		id := rec.Call(clientId, lincheck.LockInput{Key: key, Op: lincheck.LockAcquire, Owner: owner})
+		var err error
+		if opts.expiry > 0 {
+			err = l.LockWithExpiry(ctx, key, owner, opts.expiry)
+		} else {
+			err = l.Lock(ctx, key, owner)
+		}
+		rec.Return(id, nil, err)
+		if err != nil {
+			return
+		}
+
+		time.Sleep(opts.hold)
+
+		id = rec.Call(clientId, lincheck.LockInput{Key: key, Op: lincheck.LockRelease, Owner: owner})
+		rec.Return(id, nil, l.Unlock(ctx, key, owner))
+	})
+
+	ops := rec.History()
+	report(ops)
+	violations := lincheck.CheckMutualExclusion(ops)
+	for _, v := range violations {
+		fmt.Printf("violation: %v\n", v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("mutual exclusion violated %d times", len(violations))
+	}
+	fmt.Println("check: mutual exclusion held")
+	return nil
+}
+
+func newAdapter(client valkey.Client) *adapter.ReserveValkey {
+	schema := adapter.NewKeySchema("reserve:")
+	schema.Namespace = "lincheck"
+	return adapter.NewReserveValkeyWithSchema(client, schema, 10)
+}
+
+func runAdapter(ctx context.Context, client valkey.Client, opts *options) error {
+	a := newAdapter(client)
+	if err := fixture.ResetKeys(ctx, client, a, opts.keys, opts.values); err != nil {
+		return err
+	}
+
+	rec := lincheck.NewRecorder()
+	runClients(opts, func(clientId int, rnd *rand.Rand) {
+		userId := uint64(rnd.Intn(opts.keys) + 1)
+		liveId := fixture.FirstLiveId + uint64(rnd.Intn(opts.values))
+		key := strconv.FormatUint(userId, 10)
+
+		switch rnd.Intn(4) {
+		case 0:
+			// CasZadd reads the set after its transaction, so its result is not the state
+			// right after the addition and is not checked.
+			id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetAdd, Value: liveId})
+			_, err := a.CasZadd(ctx, userId, liveId)
+			rec.Return(id, nil, err)
+		case 1:
+			id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetAdd, Value: liveId})
+			n, err := a.Zadd(ctx, userId, liveId)
+			rec.Return(id, n, err)
+		case 2:
+			id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetRemove, Value: liveId})
+			n, err := a.Zrem(ctx, userId, liveId)
+			rec.Return(id, n, err)
+		default:
+			id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetRead})
+			res, err := a.Zrange(ctx, userId)
+			rec.Return(id, parseLives(res), err)
+		}
+	})
+
+	return checkSets(opts, rec.History(), lincheck.SetModel())
+}
+
+// runUsecase checks the reservations seen through the use case, which loads fixture.LoadedLiveId
+// for a user whose key does not exist. Cancellations are left out: removing the last
+// reservation deletes the key and the next call loads the backing store again.
+func runUsecase(ctx context.Context, client valkey.Client, opts *options) error {
+	a := newAdapter(client)
+	if err := fixture.ResetKeys(ctx, client, a, opts.keys, opts.values); err != nil {
+		return err
+	}
+
+	loadLock := distlock.NewDistLockValkeyV3(ctx, client, "lincheck:lock:load:", "lincheck:chan:load:", opts.lockTimeout, 0)
+	defer loadLock.Close()
+	setLock := distlock.NewDistLockValkeyV3(ctx, client, "lincheck:lock:set:", "lincheck:chan:set:", opts.lockTimeout, 3)
+	defer setLock.Close()
+	u := usecase.NewApppushReserveV2(loadLock, setLock, a)
+
+	rec := lincheck.NewRecorder()
+	runClients(opts, func(clientId int, rnd *rand.Rand) {
+		userId := uint64(rnd.Intn(opts.keys) + 1)
+		liveId := fixture.FirstLiveId + uint64(rnd.Intn(opts.values))
+		key := strconv.FormatUint(userId, 10)
+
+		if rnd.Intn(2) == 0 {
+			// like CasZadd, SetReserve reads the set after adding to it
+			id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetAdd, Value: liveId})
+			_, err := u.SetReserve(ctx, userId, liveId)
+			rec.Return(id, nil, err)
+			return
+		}
+		id := rec.Call(clientId, lincheck.SetInput{Key: key, Op: lincheck.SetRead})
+		res, err := u.GetReserve(ctx, userId)
+		rec.Return(id, parseLives(res), err)
+	})
+
+	return checkSets(opts, rec.History(), lincheck.SetModel(fixture.LoadedLiveId))
+}
+
+func checkSets(opts *options, ops []lincheck.Operation, m lincheck.Model) error {
+	report(ops)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	res, err := lincheck.Check(ctx, m, ops)
+	if err != nil {
+		return err
+	}
+	if res.Ok {
+		fmt.Println("check: history is linearizable")
+		return nil
+	}
+	for _, p := range res.Partitions {
+		printPartition(p)
+	}
+	return fmt.Errorf("history of %d users is not linearizable", len(res.Partitions))
+}
+
+func printPartition(ops []lincheck.Operation) {
+	fmt.Printf("not linearizable: user=%s\n", ops[0].Input.(lincheck.SetInput).Key)
+	for _, op := range ops {
+		in := op.Input.(lincheck.SetInput)
+		ret := "pending"
+		if !op.Pending() {
+			ret = strconv.FormatInt(op.Return, 10)
+		}
+		fmt.Printf("  client=%d, call=%d, return=%s, %s %d -> %v\n",
+			op.ClientId, op.Call, ret, in.Op, in.Value, op.Output)
+	}
+}
+
+func parseLives(res string) lincheck.SetOutput {
+	var lives []uint64
+	for _, v := range strings.Split(res, ",") {
+		if liveId, err := strconv.ParseUint(v, 10, 64); err == nil {
+			lives = append(lives, liveId)
+		}
+	}
+	return lincheck.NewSetOutput(lives)
+}
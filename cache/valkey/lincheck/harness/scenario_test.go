@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+// testOptions returns the default options of the harness with fewer operations.
+func testOptions(t *testing.T) *options {
+	opts := &options{}
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	opts.ops = 30
+	opts.seed = time.Now().UnixNano()
+	return opts
+}
+
+func newTestClient(t *testing.T, opts *options) valkey.Client {
+	s := valkeytest.Start(t)
+	s.SetDelay(randomDelay(opts.seed, opts.maxDelay))
+
+	option := s.ClientOption()
+	option.DisableCache = true
+	client, err := valkey.NewClient(option)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestScenarios(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		scenario func(context.Context, valkey.Client, *options) error
+		lock     string
+	}{
+		{"lock v2", runLock, "v2"},
+		{"lock v3", runLock, "v3"},
+		{"adapter", runAdapter, "v3"},
+		{"usecase", runUsecase, "v3"},
+	}
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.lockVersion = sc.lock
+			client := newTestClient(t, opts)
+
+			if err := sc.scenario(context.Background(), client, opts); err != nil {
+				t.Fatalf("seed=%d: %v", opts.seed, err)
+			}
+		})
+	}
+}
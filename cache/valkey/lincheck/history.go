@@ -0,0 +1,75 @@
+package lincheck
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Operation is one call recorded in a history. Call and Return are nanoseconds since the
+// recorder started. An operation that failed may or may not have taken effect, so its
+// return time is unbounded and its output is unknown.
+type Operation struct {
+	ClientId int
+	Input    any
+	Output   any
+	Call     int64
+	Return   int64
+	Err      error
+}
+
+// Pending reports whether the outcome of the operation is unknown.
+func (o Operation) Pending() bool {
+	return o.Return == math.MaxInt64
+}
+
+// Recorder records the operations of concurrent clients.
+type Recorder struct {
+	start time.Time
+
+	mu  sync.Mutex
+	ops []Operation
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{start: time.Now()}
+}
+
+// Now returns the time elapsed since the recorder started, on the monotonic clock.
+func (r *Recorder) Now() int64 {
+	return int64(time.Since(r.start))
+}
+
+// Call records the invocation of an operation and returns its id for Return.
+func (r *Recorder) Call(clientId int, input any) int {
+	call := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, Operation{ClientId: clientId, Input: input, Call: call, Return: math.MaxInt64})
+	return len(r.ops) - 1
+}
+
+// Return records the completion of operation id. When err is not nil the operation is
+// kept as pending, because it may have been applied before the error was observed.
+func (r *Recorder) Return(id int, output any, err error) {
+	ret := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.ops[id].Err = err
+		return
+	}
+	r.ops[id].Output = output
+	r.ops[id].Return = ret
+}
+
+// History returns a copy of the operations recorded so far.
+func (r *Recorder) History() []Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ops := make([]Operation, len(r.ops))
+	copy(ops, r.ops)
+	return ops
+}
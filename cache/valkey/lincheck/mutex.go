@@ -0,0 +1,88 @@
+package lincheck
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type LockOp int
+
+const (
+	LockAcquire LockOp = iota
+	LockRelease
+)
+
+// LockInput is the input of an operation on the lock identified by Key. Owner is the
+// value the lock is taken with, unique per acquisition.
+type LockInput struct {
+	Key   string
+	Op    LockOp
+	Owner string
+}
+
+// Hold is the interval in which Owner certainly held the lock on Key: from the return of
+// its acquisition to the call of its release.
+type Hold struct {
+	Key   string
+	Owner string
+	From  int64
+	To    int64
+}
+
+// Violation is a pair of holds of the same lock that overlap.
+type Violation struct {
+	A, B Hold
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s held by %s during [%d, %d] and by %s during [%d, %d]",
+		v.A.Key, v.A.Owner, v.A.From, v.A.To, v.B.Owner, v.B.From, v.B.To)
+}
+
+// Holds returns the holds of the successful acquisitions in ops. An acquisition that
+// was never released is held until the end of the history. Failed acquisitions are
+// ignored, since nothing certain can be said about them.
+func Holds(ops []Operation) []Hold {
+	type owner struct{ key, owner string }
+	released := make(map[owner]int64)
+	for _, op := range ops {
+		in := op.Input.(LockInput)
+		if in.Op == LockRelease {
+			released[owner{in.Key, in.Owner}] = op.Call
+		}
+	}
+
+	var holds []Hold
+	for _, op := range ops {
+		in := op.Input.(LockInput)
+		if in.Op != LockAcquire || op.Pending() {
+			continue
+		}
+		to, ok := released[owner{in.Key, in.Owner}]
+		if !ok {
+			to = math.MaxInt64
+		}
+		holds = append(holds, Hold{Key: in.Key, Owner: in.Owner, From: op.Return, To: to})
+	}
+	return holds
+}
+
+// CheckMutualExclusion returns every pair of overlapping holds of the same lock.
+func CheckMutualExclusion(ops []Operation) []Violation {
+	byKey := make(map[string][]Hold)
+	for _, h := range Holds(ops) {
+		byKey[h.Key] = append(byKey[h.Key], h)
+	}
+
+	var violations []Violation
+	for _, holds := range byKey {
+		sort.Slice(holds, func(i, j int) bool { return holds[i].From < holds[j].From })
+		for i := range holds {
+			for j := i + 1; j < len(holds) && holds[j].From < holds[i].To; j++ {
+				violations = append(violations, Violation{holds[i], holds[j]})
+			}
+		}
+	}
+	return violations
+}
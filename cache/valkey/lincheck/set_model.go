@@ -0,0 +1,149 @@
+package lincheck
+
+import (
+	"sort"
+)
+
+type SetOp int
+
+const (
+	// SetAdd adds Value. Its output, if known, is the set after the addition (SetOutput)
+	// or the number of members added (int64).
+	SetAdd SetOp = iota
+	// SetRemove removes Value. Its output, if known, is the number of members removed (int64).
+	SetRemove
+	// SetRead reads the set. Its output, if known, is a SetOutput.
+	SetRead
+)
+
+func (o SetOp) String() string {
+	switch o {
+	case SetAdd:
+		return "add"
+	case SetRemove:
+		return "remove"
+	default:
+		return "read"
+	}
+}
+
+// SetInput is the input of an operation on the set identified by Key.
+type SetInput struct {
+	Key   string
+	Op    SetOp
+	Value uint64
+}
+
+// SetOutput is the sorted members of a set.
+type SetOutput []uint64
+
+// NewSetOutput returns the members in sorted order.
+func NewSetOutput(members []uint64) SetOutput {
+	out := make(SetOutput, len(members))
+	copy(out, members)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// SetModel specifies a set per key, such as the reservations of a user. A lost update
+// shows up as a read, or the result of an addition, missing a member that was added.
+// Initial holds members of every set before the history starts.
+func SetModel(initial ...uint64) Model {
+	return Model{
+		Partition: partitionByKey(func(op Operation) string {
+			return op.Input.(SetInput).Key
+		}),
+		Init: func() any {
+			return NewSetOutput(initial)
+		},
+		Step: func(state any, input any, output any) (bool, any) {
+			s := state.(SetOutput)
+			in := input.(SetInput)
+			switch in.Op {
+			case SetAdd:
+				next, added := s.with(in.Value)
+				switch out := output.(type) {
+				case SetOutput:
+					return next.equal(out), next
+				case int64:
+					return (out == 1) == added, next
+				}
+				return true, next
+			case SetRemove:
+				next, removed := s.without(in.Value)
+				if out, ok := output.(int64); ok {
+					return (out == 1) == removed, next
+				}
+				return true, next
+			default:
+				if out, ok := output.(SetOutput); ok {
+					return s.equal(out), s
+				}
+				return true, s
+			}
+		},
+		Equal: func(a, b any) bool {
+			return a.(SetOutput).equal(b.(SetOutput))
+		},
+	}
+}
+
+func (s SetOutput) index(v uint64) (int, bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i] >= v })
+	return i, i < len(s) && s[i] == v
+}
+
+// with returns s with v added, without modifying s.
+func (s SetOutput) with(v uint64) (SetOutput, bool) {
+	i, found := s.index(v)
+	if found {
+		return s, false
+	}
+	next := make(SetOutput, 0, len(s)+1)
+	next = append(next, s[:i]...)
+	next = append(next, v)
+	next = append(next, s[i:]...)
+	return next, true
+}
+
+// without returns s with v removed, without modifying s.
+func (s SetOutput) without(v uint64) (SetOutput, bool) {
+	i, found := s.index(v)
+	if !found {
+		return s, false
+	}
+	next := make(SetOutput, 0, len(s)-1)
+	next = append(next, s[:i]...)
+	next = append(next, s[i+1:]...)
+	return next, true
+}
+
+func (s SetOutput) equal(o SetOutput) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func partitionByKey(key func(op Operation) string) func(ops []Operation) [][]Operation {
+	return func(ops []Operation) [][]Operation {
+		index := make(map[string]int)
+		var partitions [][]Operation
+		for _, op := range ops {
+			k := key(op)
+			i, ok := index[k]
+			if !ok {
+				i = len(partitions)
+				index[k] = i
+				partitions = append(partitions, nil)
+			}
+			partitions[i] = append(partitions[i], op)
+		}
+		return partitions
+	}
+}
@@ -0,0 +1,61 @@
+// Package fixture holds the locks and keys shared by the load test and the linearizability
+// harness.
+package fixture
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+)
+
+const (
+	FirstLiveId uint64 = 10108
+	// LoadedLiveId is the reservation the use cases load from their stand-in backing store.
+	LoadedLiveId uint64 = 90203
+)
+
+type Locker interface {
+	LockWithExpiry(ctx context.Context, key string, value string, expiry time.Duration) error
+	Lock(ctx context.Context, key string, value string) error
+	Unlock(ctx context.Context, key string, value string) error
+}
+
+// NewLock creates a distributed lock of version v2 or v3 whose keys and channels are
+// prefixed with namespace and name, and a function closing it.
+func NewLock(ctx context.Context, client valkey.Client, version string, namespace string, name string, timeout time.Duration, retry int8) (Locker, func(), error) {
+	keyPrefix := fmt.Sprintf("%s:lock:%s:", namespace, name)
+	channelPrefix := fmt.Sprintf("%s:chan:%s:", namespace, name)
+	switch version {
+	case "v2":
+		return distlock.NewDistLockValkeyV2(client, keyPrefix, channelPrefix, timeout, retry), func() {}, nil
+	case "v3":
+		l := distlock.NewDistLockValkeyV3(ctx, client, keyPrefix, channelPrefix, timeout, retry)
+		return l, func() { l.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown lock version: %s", version)
+	}
+}
+
+// ResetKeys deletes the sets of users 1 to users and of the lives from FirstLiveId on,
+// and of LoadedLiveId.
+func ResetKeys(ctx context.Context, c valkey.Client, a *adapter.ReserveValkey, users int, lives int) error {
+	keys := make([]string, 0, users+lives+1)
+	for u := 1; u <= users; u++ {
+		keys = append(keys, a.Key(uint64(u)))
+	}
+	for l := 0; l < lives; l++ {
+		keys = append(keys, a.LiveKey(FirstLiveId+uint64(l)))
+	}
+	keys = append(keys, a.LiveKey(LoadedLiveId))
+
+	for _, key := range keys {
+		if err := c.Do(ctx, c.B().Del().Key(key).Build()).Error(); err != nil {
+			return fmt.Errorf("reset %s: %v", key, err)
+		}
+	}
+	return nil
+}
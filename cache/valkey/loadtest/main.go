@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/factory"
+	"github.com/wonksing/go-tutorials/cache/valkey/loadtest/fixture"
+)
+
+const usage = `usage: loadtest <scenario> [flags]
+
+scenarios:
+  reserve   SetReserve of the reserve use case guarded by distributed locks
+  caszadd   CasZadd of the reserve adapter without locks
+  lock      lock contention on a few keys, checking mutual exclusion
+
+run 'loadtest <scenario> -h' for the flags of a scenario.
+`
+
+type options struct {
+	users       int
+	lives       int
+	concurrency int
+	duration    time.Duration
+	lockVersion string
+	lockTimeout time.Duration
+	hold        time.Duration
+	namespace   string
+	reset       bool
+	// cluster is set when the config is of a cluster, whose keys must be hash tagged.
+	cluster bool
+}
+
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.IntVar(&o.users, "users", 5, "Number of distinct users (or lock keys)")
+	fs.IntVar(&o.lives, "lives", 5, "Number of distinct lives")
+	fs.IntVar(&o.concurrency, "concurrency", 100, "Number of concurrent workers")
+	fs.DurationVar(&o.duration, "duration", 10*time.Second, "Duration of the test")
+	fs.StringVar(&o.lockVersion, "lock", "v3", "Distributed lock version, v2 or v3")
+	fs.DurationVar(&o.lockTimeout, "lock-timeout", 15*time.Second, "Time to wait for a lock")
+	fs.DurationVar(&o.hold, "hold", time.Millisecond, "Time to hold a lock in the lock scenario")
+	fs.StringVar(&o.namespace, "namespace", "loadtest", "Namespace of every key written by the test")
+	fs.BoolVar(&o.reset, "reset", true, "Delete the keys of the test before starting")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	scenarios := map[string]func(context.Context, valkey.Client, *options) error{
+		"reserve": runReserve,
+		"caszadd": runCasZadd,
+		"lock":    runLock,
+	}
+	name := os.Args[1]
+	scenario, ok := scenarios[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown scenario: %s\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	opts := &options{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts.bind(fs)
+	fs.Parse(os.Args[2:])
+	if opts.users <= 0 || opts.lives <= 0 || opts.concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "users, lives and concurrency must be positive")
+		os.Exit(2)
+	}
+
+	config, err := factory.LoadFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err: load valkey config: %v\n", err)
+		os.Exit(1)
+	}
+	opts.cluster = config.Cluster()
+	client, err := factory.NewClient(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err: connect valkey: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Printf("scenario=%s, users=%d, lives=%d, concurrency=%d, duration=%v, lock=%s\n",
+		name, opts.users, opts.lives, opts.concurrency, opts.duration, opts.lockVersion)
+	if err = scenario(ctx, client, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "err: %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// runWorkers calls op from concurrency workers until duration elapses or ctx is done,
+// recording each call, and returns the elapsed time.
+func runWorkers(ctx context.Context, opts *options, rec *recorder, op func(ctx context.Context, rnd *rand.Rand) error) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(opts.concurrency)
+	for i := 0; i < opts.concurrency; i++ {
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				// operations are not bound to the test duration so that none is cut in half
+				opStart := time.Now()
+				err := op(context.Background(), rnd)
+				rec.record(time.Since(opStart), err)
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func userId(rnd *rand.Rand, opts *options) uint64 {
+	return uint64(rnd.Intn(opts.users) + 1)
+}
+
+func liveId(rnd *rand.Rand, opts *options) uint64 {
+	return uint64(rnd.Intn(opts.lives)) + fixture.FirstLiveId
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/loadtest/fixture"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/usecase"
+)
+
+type reserver interface {
+	SetReserve(ctx context.Context, userId uint64, liveId uint64) (string, error)
+}
+
+func newLock(ctx context.Context, client valkey.Client, opts *options, name string, retry int8) (fixture.Locker, func(), error) {
+	return fixture.NewLock(ctx, client, opts.lockVersion, opts.namespace, name, opts.lockTimeout, retry)
+}
+
+func newAdapter(client valkey.Client, opts *options) *adapter.ReserveValkey {
+	schema := adapter.NewKeySchema("reserve:")
+	schema.Namespace = opts.namespace
+	schema.HashTag = opts.cluster
+	return adapter.NewReserveValkeyWithSchema(client, schema, 10)
+}
+
+func runReserve(ctx context.Context, client valkey.Client, opts *options) error {
+	a := newAdapter(client, opts)
+
+	var u reserver
+	switch opts.lockVersion {
+	case "v2":
+		l, closeLock, err := newLock(ctx, client, opts, "load", 0)
+		if err != nil {
+			return err
+		}
+		defer closeLock()
+		u = usecase.NewApppushReserve(l.(*distlock.DistLockValkeyV2), a)
+	default:
+		loadLock, closeLoadLock, err := newLock(ctx, client, opts, "load", 0)
+		if err != nil {
+			return err
+		}
+		defer closeLoadLock()
+		setLock, closeSetLock, err := newLock(ctx, client, opts, "zadd", 3)
+		if err != nil {
+			return err
+		}
+		defer closeSetLock()
+		u = usecase.NewApppushReserveV2(loadLock.(*distlock.DistLockValkeyV3), setLock.(*distlock.DistLockValkeyV3), a)
+	}
+
+	return runReservations(ctx, client, a, opts, u.SetReserve)
+}
+
+func runCasZadd(ctx context.Context, client valkey.Client, opts *options) error {
+	a := newAdapter(client, opts)
+	return runReservations(ctx, client, a, opts, a.CasZadd)
+}
+
+func runReservations(ctx context.Context, client valkey.Client, a *adapter.ReserveValkey, opts *options, reserve func(ctx context.Context, userId uint64, liveId uint64) (string, error)) error {
+	if opts.reset {
+		if err := fixture.ResetKeys(ctx, client, a, opts.users, opts.lives); err != nil {
+			return err
+		}
+	}
+
+	exp := newExpectation()
+	rec := newRecorder()
+	elapsed := runWorkers(ctx, opts, rec, func(ctx context.Context, rnd *rand.Rand) error {
+		userId := userId(rnd, opts)
+		liveId := liveId(rnd, opts)
+		exp.attempt(userId, liveId)
+		_, err := reserve(ctx, userId, liveId)
+		if err == nil {
+			exp.ack(userId, liveId)
+		}
+		return err
+	})
+	rec.report(elapsed)
+
+	return verify(context.Background(), a, opts, exp)
+}
+
+func runLock(ctx context.Context, client valkey.Client, opts *options) error {
+	l, closeLock, err := newLock(ctx, client, opts, "contention", 0)
+	if err != nil {
+		return err
+	}
+	defer closeLock()
+
+	holders := make([]atomic.Int32, opts.users)
+	var violations, seq atomic.Int64
+	rec := newRecorder()
+	elapsed := runWorkers(ctx, opts, rec, func(ctx context.Context, rnd *rand.Rand) error {
+		k := rnd.Intn(opts.users)
+		key := strconv.Itoa(k + 1)
+		value := strconv.FormatInt(seq.Add(1), 10)
+		if err := l.Lock(ctx, key, value); err != nil {
+			return err
+		}
+		if holders[k].Add(1) > 1 {
+			violations.Add(1)
+		}
+		time.Sleep(opts.hold)
+		holders[k].Add(-1)
+		return l.Unlock(ctx, key, value)
+	})
+	rec.report(elapsed)
+
+	if v := violations.Load(); v > 0 {
+		return fmt.Errorf("mutual exclusion violated %d times", v)
+	}
+	fmt.Println("verify: mutual exclusion held")
+	return nil
+}
+
+// expectation tracks the reservations that were attempted and those acknowledged to the caller.
+// A failed operation may still have been applied, so only acknowledged reservations must
+// be stored and only attempted ones may be.
+type expectation struct {
+	mu        sync.Mutex
+	attempted map[uint64]map[uint64]struct{}
+	acked     map[uint64]map[uint64]struct{}
+}
+
+func newExpectation() *expectation {
+	return &expectation{
+		attempted: make(map[uint64]map[uint64]struct{}),
+		acked:     make(map[uint64]map[uint64]struct{}),
+	}
+}
+
+func (e *expectation) attempt(userId uint64, liveId uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	addPair(e.attempted, userId, liveId)
+}
+
+func (e *expectation) ack(userId uint64, liveId uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	addPair(e.acked, userId, liveId)
+}
+
+func addPair(m map[uint64]map[uint64]struct{}, userId uint64, liveId uint64) {
+	lives, ok := m[userId]
+	if !ok {
+		lives = make(map[uint64]struct{})
+		m[userId] = lives
+	}
+	lives[liveId] = struct{}{}
+}
+
+// verify checks that every acknowledged reservation is stored in the user's set and in the
+// live's reverse index, and that nothing but attempted and loaded reservations was stored.
+func verify(ctx context.Context, a *adapter.ReserveValkey, opts *options, exp *expectation) error {
+	var lost, unexpected, unindexed int
+	for u := 1; u <= opts.users; u++ {
+		userId := uint64(u)
+		res, err := a.Zrange(ctx, userId)
+		if err != nil {
+			return fmt.Errorf("verify: zrange %d: %v", userId, err)
+		}
+		stored := make(map[uint64]struct{})
+		for _, v := range strings.Split(res, ",") {
+			if liveId, err := strconv.ParseUint(v, 10, 64); err == nil {
+				stored[liveId] = struct{}{}
+			}
+		}
+
+		for liveId := range exp.acked[userId] {
+			if _, ok := stored[liveId]; !ok {
+				fmt.Printf("verify: lost reservation: user=%d, live=%d\n", userId, liveId)
+				lost++
+			}
+		}
+		for liveId := range stored {
+			if _, ok := exp.attempted[userId][liveId]; !ok && liveId != fixture.LoadedLiveId {
+				fmt.Printf("verify: unexpected reservation: user=%d, live=%d\n", userId, liveId)
+				unexpected++
+			}
+		}
+	}
+
+	for l := 0; l < opts.lives; l++ {
+		liveId := fixture.FirstLiveId + uint64(l)
+		indexed := make(map[uint64]struct{})
+		err := a.ForEachLiveUser(ctx, liveId, 1000, func(userIds []uint64) error {
+			for _, userId := range userIds {
+				indexed[userId] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("verify: live index %d: %v", liveId, err)
+		}
+		for userId, lives := range exp.acked {
+			if _, ok := lives[liveId]; !ok {
+				continue
+			}
+			if _, ok := indexed[userId]; !ok {
+				fmt.Printf("verify: missing from live index: user=%d, live=%d\n", userId, liveId)
+				unindexed++
+			}
+		}
+	}
+
+	fmt.Printf("verify: lost=%d, unexpected=%d, unindexed=%d\n", lost, unexpected, unindexed)
+	if lost+unexpected+unindexed > 0 {
+		return fmt.Errorf("final set contents do not match acknowledged operations")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+)
+
+// recorder collects the latency and the outcome of every operation.
+type recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    map[string]int64
+	success   int64
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		errors: make(map[string]int64),
+	}
+}
+
+func (r *recorder) record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies = append(r.latencies, d)
+	if err != nil {
+		r.errors[classify(err)]++
+		return
+	}
+	r.success++
+}
+
+func classify(err error) string {
+	var lockErr *distlock.AcquireLockError
+	switch {
+	case errors.As(err, &lockErr):
+		if strings.Contains(lockErr.Msg, "timeout") {
+			return "lock timeout"
+		}
+		return "lock"
+	case errors.Is(err, errorz.ErrNeedRetry), strings.Contains(err.Error(), "retry limit reached"):
+		return "retry exhausted"
+	case errors.Is(err, errorz.ErrResourceNotFound):
+		return "not found"
+	case strings.Contains(err.Error(), "context"):
+		return "context"
+	default:
+		return "other"
+	}
+}
+
+func (r *recorder) report(elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := int64(len(r.latencies))
+	fmt.Printf("operations: total=%d, success=%d, failure=%d\n", total, r.success, total-r.success)
+	fmt.Printf("throughput: %.1f ops/s over %v\n", float64(total)/elapsed.Seconds(), elapsed.Round(time.Millisecond))
+
+	if total > 0 {
+		sorted := make([]time.Duration, len(r.latencies))
+		copy(sorted, r.latencies)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Printf("latency: p50=%v, p90=%v, p99=%v, p999=%v, max=%v\n",
+			percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), percentile(sorted, 99.9), sorted[len(sorted)-1])
+	}
+
+	if len(r.errors) > 0 {
+		kinds := make([]string, 0, len(r.errors))
+		for k := range r.errors {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		fmt.Println("errors:")
+		for _, k := range kinds {
+			fmt.Printf("  %s: %d\n", k, r.errors[k])
+		}
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i].Round(time.Microsecond)
+}
@@ -11,17 +11,23 @@ import (
 
 	"github.com/valkey-io/valkey-go"
 	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/factory"
 	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
 	"github.com/wonksing/go-tutorials/cache/valkey/reserve/usecase"
 )
 
 var (
 	client valkey.Client
+	config factory.Config
 )
 
 func init() {
 	var err error
-	client, err = valkey.NewClient(valkey.ClientOption{InitAddress: []string{"127.0.0.1:6379"}})
+	config, err = factory.LoadFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	client, err = factory.NewClient(config)
 	if err != nil {
 		panic(err)
 	}
@@ -45,7 +51,17 @@ func zaddTest() {
 	defer loadLock.Close()
 	setLock := distlock.NewDistLockValkeyV3(ctx, client, "key-prefix:zadd:", "chan-prefix:zadd:", timeout, 3)
 	defer setLock.Close()
-	a := adapter.NewReserveValkey(client, "reserve:", 10)
+	schema := adapter.NewKeySchema("reserve:")
+	if config.Cluster() {
+		loadLock.WithHashTag()
+		setLock.WithHashTag()
+		schema.HashTag = true
+	}
+	if err := config.RequireHashTag(schema.HashTag); err != nil {
+		panic(err)
+	}
+	a := adapter.NewReserveValkeyWithSchema(client, schema, 10)
+	a.EnableEventStream("reserve-events", 100000)
 	u := usecase.NewApppushReserveV2(loadLock, setLock, a)
 
 	// simple
@@ -284,7 +300,7 @@ func _lockTest(l *distlock.DistLockValkeyV2, i int, numClients int) {
 }
 
 func exampleLockV2() {
-	client, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{"127.0.0.1:6379"}})
+	client, err := factory.NewClient(config)
 	if err != nil {
 		panic(err)
 	}
@@ -335,7 +351,7 @@ func exampleLockV2() {
 func example() {
 	fmt.Println("Hello, World!")
 
-	client, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{"127.0.0.1:6379"}})
+	client, err := factory.NewClient(config)
 	if err != nil {
 		panic(err)
 	}
@@ -394,3 +410,37 @@ func example() {
 
 	fmt.Println("finished, bye")
 }
+
+func eventReaderExample() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	r := adapter.NewReserveEventReader(client, "reserve-events", "apppush", "consumer-1")
+	if err := r.CreateGroup(ctx); err != nil {
+		fmt.Printf("err: create group: %v\n", err)
+		return
+	}
+
+	// take over entries left pending by consumers that went away
+	claimed, _, err := r.Claim(ctx, time.Minute, "0-0", 100)
+	if err != nil {
+		fmt.Printf("err: claim: %v\n", err)
+		return
+	}
+	for _, e := range claimed {
+		fmt.Printf("claimed: %+v\n", e)
+		r.Ack(ctx, e.Id)
+	}
+
+	for ctx.Err() == nil {
+		events, err := r.Read(ctx, 100, time.Second)
+		if err != nil {
+			fmt.Printf("err: read: %v\n", err)
+			return
+		}
+		for _, e := range events {
+			fmt.Printf("event: %+v\n", e)
+			r.Ack(ctx, e.Id)
+		}
+	}
+}
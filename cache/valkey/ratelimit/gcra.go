@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// gcraScript implements the generic cell rate algorithm. It stores the theoretical arrival
+// time (TAT) of the next request, which advances by the emission interval with every
+// allowed request; a request is allowed if it does not arrive more than the burst
+// tolerance before the TAT.
+//
+// KEYS[1] TAT key
+// ARGV[1] emission interval in microseconds
+// ARGV[2] burst
+var gcraScript = valkey.NewLuaScript(`
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', key))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local tolerance = interval * burst
+local newTat = tat + interval
+local allowAt = newTat - tolerance
+if now < allowAt then
+	return {0, 0, allowAt - now, tat - now}
+end
+
+local resetAfter = newTat - now
+redis.call('SET', key, newTat, 'PX', math.ceil(resetAfter / 1000))
+return {1, math.floor((now - allowAt) / interval), 0, resetAfter}
+`)
+
+// GCRA is a token bucket holding up to burst requests that refills at rate requests per
+// period. Unlike SlidingWindowLog it stores a single value per key.
+type GCRA struct {
+	client   valkey.Client
+	prefix   string
+	burst    int64
+	interval time.Duration
+}
+
+// NewGCRA creates a GCRA allowing bursts of up to burst requests and rate requests per
+// period on average. rate and burst must be positive, and period long enough for rate
+// requests a microsecond apart.
+func NewGCRA(client valkey.Client, prefix string, rate int64, period time.Duration, burst int64) (*GCRA, error) {
+	if rate <= 0 || burst <= 0 {
+		return nil, fmt.Errorf("ratelimit: rate and burst must be positive, got %d and %d", rate, burst)
+	}
+	interval := period / time.Duration(rate)
+	if interval < time.Microsecond {
+		return nil, fmt.Errorf("ratelimit: period %v is too short for %d requests", period, rate)
+	}
+	return &GCRA{
+		client:   client,
+		prefix:   prefix,
+		burst:    burst,
+		interval: interval,
+	}, nil
+}
+
+func (l *GCRA) Allow(ctx context.Context, key string) (Result, error) {
+	res := gcraScript.Exec(ctx, l.client, []string{l.prefix + key}, []string{
+		strconv.FormatInt(l.interval.Microseconds(), 10),
+		strconv.FormatInt(l.burst, 10),
+	})
+	return parseResult(res, l.burst)
+}
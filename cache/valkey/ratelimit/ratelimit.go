@@ -0,0 +1,50 @@
+// Package ratelimit limits the rate of requests across instances with state kept in valkey.
+//
+// Each algorithm runs as a single Lua script, so concurrent requests for the same key are
+// decided atomically, and uses the clock of the server, so instances need not agree on time.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Result is the decision on a request.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed at once.
+	Limit int64
+	// Remaining is the number of requests that would be allowed right after this one.
+	Remaining int64
+	// RetryAfter is how long to wait before the next request is allowed, zero if allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the whole limit is available again.
+	ResetAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key is allowed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// parseResult reads the reply of a script: allowed, remaining, retry after and reset after,
+// both in microseconds.
+func parseResult(res valkey.ValkeyResult, limit int64) (Result, error) {
+	values, err := res.AsIntSlice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply of %d values", len(values))
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/ratelimit"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestNewGCRA(t *testing.T) {
+	tests := []struct {
+		rate   int64
+		period time.Duration
+		burst  int64
+		ok     bool
+	}{
+		{20, time.Second, 40, true},
+		{1, time.Microsecond, 1, true},
+		{0, time.Second, 40, false},
+		{-1, time.Second, 40, false},
+		{20, time.Second, 0, false},
+		{20, 0, 40, false},
+		{2, time.Microsecond, 1, false},
+	}
+	for _, tt := range tests {
+		_, err := ratelimit.NewGCRA(nil, "ratelimit:", tt.rate, tt.period, tt.burst)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewGCRA(rate=%d, period=%v, burst=%d): err = %v, want ok = %v", tt.rate, tt.period, tt.burst, err, tt.ok)
+		}
+	}
+}
+
+func TestNewSlidingWindowLog(t *testing.T) {
+	tests := []struct {
+		limit  int64
+		window time.Duration
+		ok     bool
+	}{
+		{10, time.Minute, true},
+		{0, time.Minute, false},
+		{10, 0, false},
+		{10, time.Microsecond, false},
+	}
+	for _, tt := range tests {
+		_, err := ratelimit.NewSlidingWindowLog(nil, "ratelimit:", tt.limit, tt.window)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewSlidingWindowLog(limit=%d, window=%v): err = %v, want ok = %v", tt.limit, tt.window, err, tt.ok)
+		}
+	}
+}
+
+func allow(t *testing.T, l ratelimit.Limiter, key string) ratelimit.Result {
+	t.Helper()
+	res, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("allow %s: %v", key, err)
+	}
+	return res
+}
+
+func TestGCRA(t *testing.T) {
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	// a request every 100ms, and bursts of 3
+	l, err := ratelimit.NewGCRA(client, "ratelimit:", 10, time.Second, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := int64(0); i < 3; i++ {
+		res := allow(t, l, "a")
+		if !res.Allowed || res.Limit != 3 || res.Remaining != 2-i || res.RetryAfter != 0 {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, res, 2-i)
+		}
+	}
+	res := allow(t, l, "a")
+	elapsed := time.Since(start)
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request over the burst = %+v, want denied", res)
+	}
+	if res.RetryAfter <= 100*time.Millisecond-elapsed-time.Millisecond || res.RetryAfter > 100*time.Millisecond {
+		t.Errorf("retry after = %v, want up to the 100ms interval", res.RetryAfter)
+	}
+	if res.ResetAfter <= 200*time.Millisecond || res.ResetAfter > 300*time.Millisecond {
+		t.Errorf("reset after = %v, want up to 300ms for the burst", res.ResetAfter)
+	}
+
+	// other keys have their own burst
+	if res := allow(t, l, "b"); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("request of another key = %+v, want allowed with 2 remaining", res)
+	}
+
+	time.Sleep(res.RetryAfter + 5*time.Millisecond)
+	if res := allow(t, l, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("request after retry after = %+v, want allowed with 0 remaining", res)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if res := allow(t, l, "a"); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("request after reset = %+v, want allowed with the whole burst", res)
+	}
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	l, err := ratelimit.NewSlidingWindowLog(client, "ratelimit:", 2, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Now()
+	if res := allow(t, l, "a"); !res.Allowed || res.Limit != 2 || res.Remaining != 1 || res.ResetAfter != 200*time.Millisecond {
+		t.Fatalf("first request = %+v, want allowed with 1 remaining", res)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if res := allow(t, l, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("second request = %+v, want allowed with 0 remaining", res)
+	}
+	res := allow(t, l, "a")
+	elapsed := time.Since(first)
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request over the limit = %+v, want denied", res)
+	}
+	// a slot frees up when the first request leaves the window, the whole limit when the second does
+	if res.RetryAfter <= 200*time.Millisecond-elapsed-time.Millisecond || res.RetryAfter > 150*time.Millisecond {
+		t.Errorf("retry after = %v, want until the first request leaves the window", res.RetryAfter)
+	}
+	if res.ResetAfter-res.RetryAfter < 40*time.Millisecond {
+		t.Errorf("reset after = %v, want about 50ms after retry after %v", res.ResetAfter, res.RetryAfter)
+	}
+
+	time.Sleep(res.RetryAfter + 5*time.Millisecond)
+	if res := allow(t, l, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("request after the first left the window = %+v, want allowed with 0 remaining", res)
+	}
+
+	// the log expires with the window
+	time.Sleep(250 * time.Millisecond)
+	n, err := client.Do(context.Background(), client.B().Exists().Key("ratelimit:a").Build()).AsInt64()
+	if err != nil || n != 0 {
+		t.Errorf("log after the window = %d, %v, want expired", n, err)
+	}
+	if res := allow(t, l, "a"); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("request after the window = %+v, want allowed with 1 remaining", res)
+	}
+}
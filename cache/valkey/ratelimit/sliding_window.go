@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+// slidingWindowScript keeps the time of every allowed request in the window in a sorted
+// set and allows a request while there are fewer than the limit.
+//
+// KEYS[1] log key
+// ARGV[1] limit
+// ARGV[2] window in microseconds
+// ARGV[3] unique member of the request
+var slidingWindowScript = valkey.NewLuaScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[3])
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	return {1, limit - count - 1, 0, window}
+end
+
+-- a slot frees up when the oldest request leaves the window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now, tonumber(newest[2]) + window - now}
+`)
+
+// SlidingWindowLog allows up to limit requests per key in any window of the given length.
+// It is exact, at the cost of storing one entry per allowed request.
+type SlidingWindowLog struct {
+	client valkey.Client
+	prefix string
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingWindowLog creates a SlidingWindowLog storing its logs under prefix followed by
+// the key. limit must be positive and window at least a millisecond, the expiry of a log.
+func NewSlidingWindowLog(client valkey.Client, prefix string, limit int64, window time.Duration) (*SlidingWindowLog, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("ratelimit: limit must be positive, got %d", limit)
+	}
+	if window < time.Millisecond {
+		return nil, fmt.Errorf("ratelimit: window must be at least 1ms, got %v", window)
+	}
+	return &SlidingWindowLog{
+		client: client,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}, nil
+}
+
+func (l *SlidingWindowLog) Allow(ctx context.Context, key string) (Result, error) {
+	res := slidingWindowScript.Exec(ctx, l.client, []string{l.prefix + key}, []string{
+		strconv.FormatInt(l.limit, 10),
+		strconv.FormatInt(l.window.Microseconds(), 10),
+		ulid.Make().String(),
+	})
+	return parseResult(res, l.limit)
+}
@@ -0,0 +1,146 @@
+package adapter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// KeySchema builds every key used by ReserveValkey.
+//
+// A user key looks like `[namespace:][version:]reserve:<userId>`, its load time key like
+// `[namespace:][version:]reserve:<userId>:loaded`, its outbox key like
+// `[namespace:][version:]reserve:<userId>:outbox`, its pending changes key like
+// `[namespace:][version:]reserve:<userId>:changes` and a reverse index key like
+// `[namespace:][version:]live:<liveId>:users`. When HashTag is set, the id is wrapped
+// in braces (`reserve:{1}`) so that keys of the same id land in the same cluster slot.
+type KeySchema struct {
+	Namespace  string
+	Version    string
+	UserPrefix string
+	LivePrefix string
+	HashTag    bool
+}
+
+// NewKeySchema creates a KeySchema whose user keys start with userPrefix.
+// It produces the same keys as the adapter did before KeySchema was introduced.
+func NewKeySchema(userPrefix string) *KeySchema {
+	return &KeySchema{
+		UserPrefix: strings.TrimSuffix(userPrefix, ":"),
+		LivePrefix: "live",
+	}
+}
+
+// User returns the key of the sorted set holding the lives reserved by userId.
+func (s *KeySchema) User(userId uint64) string {
+	return s.base() + s.UserPrefix + ":" + s.id(userId)
+}
+
+// Loaded returns the key holding when the reservations of userId were loaded from storage.
+func (s *KeySchema) Loaded(userId uint64) string {
+	return s.User(userId) + ":loaded"
+}
+
+// Outbox returns the key of the sorted set holding the events of userId not yet handed to a
+// publisher.
+func (s *KeySchema) Outbox(userId uint64) string {
+	return s.User(userId) + ":outbox"
+}
+
+// Changes returns the key of the sorted set holding the changes of userId not yet applied to
+// the reverse index and the event stream.
+func (s *KeySchema) Changes(userId uint64) string {
+	return s.User(userId) + ":changes"
+}
+
+// Live returns the key of the set holding the users who reserved liveId.
+func (s *KeySchema) Live(liveId uint64) string {
+	return s.base() + s.LivePrefix + ":" + s.id(liveId) + ":users"
+}
+
+// UserPattern returns a SCAN pattern matching user keys.
+func (s *KeySchema) UserPattern() string {
+	return s.base() + s.UserPrefix + ":*"
+}
+
+// OutboxPattern returns a SCAN pattern matching outbox keys.
+func (s *KeySchema) OutboxPattern() string {
+	return s.base() + s.UserPrefix + ":*:outbox"
+}
+
+// ChangesPattern returns a SCAN pattern matching pending changes keys.
+func (s *KeySchema) ChangesPattern() string {
+	return s.base() + s.UserPrefix + ":*:changes"
+}
+
+// LivePattern returns a SCAN pattern matching reverse index keys.
+func (s *KeySchema) LivePattern() string {
+	return s.base() + s.LivePrefix + ":*:users"
+}
+
+// ParseUser extracts the user id from a key built by User.
+func (s *KeySchema) ParseUser(key string) (uint64, bool) {
+	prefix := s.base() + s.UserPrefix + ":"
+	if !strings.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	return s.parseId(strings.TrimPrefix(key, prefix))
+}
+
+// ParseOutbox extracts the user id from a key built by Outbox.
+func (s *KeySchema) ParseOutbox(key string) (uint64, bool) {
+	if !strings.HasSuffix(key, ":outbox") {
+		return 0, false
+	}
+	return s.ParseUser(strings.TrimSuffix(key, ":outbox"))
+}
+
+// ParseChanges extracts the user id from a key built by Changes.
+func (s *KeySchema) ParseChanges(key string) (uint64, bool) {
+	if !strings.HasSuffix(key, ":changes") {
+		return 0, false
+	}
+	return s.ParseUser(strings.TrimSuffix(key, ":changes"))
+}
+
+// ParseLive extracts the live id from a key built by Live.
+func (s *KeySchema) ParseLive(key string) (uint64, bool) {
+	prefix := s.base() + s.LivePrefix + ":"
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, ":users") {
+		return 0, false
+	}
+	return s.parseId(strings.TrimSuffix(strings.TrimPrefix(key, prefix), ":users"))
+}
+
+func (s *KeySchema) base() string {
+	var b strings.Builder
+	if s.Namespace != "" {
+		b.WriteString(s.Namespace)
+		b.WriteString(":")
+	}
+	if s.Version != "" {
+		b.WriteString(s.Version)
+		b.WriteString(":")
+	}
+	return b.String()
+}
+
+func (s *KeySchema) id(id uint64) string {
+	if s.HashTag {
+		return "{" + strconv.FormatUint(id, 10) + "}"
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+func (s *KeySchema) parseId(v string) (uint64, bool) {
+	if s.HashTag {
+		if !strings.HasPrefix(v, "{") || !strings.HasSuffix(v, "}") {
+			return 0, false
+		}
+		v = v[1 : len(v)-1]
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
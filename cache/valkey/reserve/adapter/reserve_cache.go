@@ -0,0 +1,82 @@
+package adapter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+type cacheMeasure struct {
+	Hit  atomic.Int64
+	Miss atomic.Int64
+}
+
+func (m *cacheMeasure) String() string {
+	return fmt.Sprintf("hit: %d, miss: %d", m.Hit.Load(), m.Miss.Load())
+}
+
+// CacheStats is a snapshot of the client side cache of reservation reads.
+type CacheStats struct {
+	Enabled bool  `json:"enabled"`
+	Hit     int64 `json:"hit"`
+	Miss    int64 `json:"miss"`
+}
+
+func (m *cacheMeasure) observe(res valkey.ValkeyResult) {
+	if res.IsCacheHit() {
+		m.Hit.Add(1)
+		return
+	}
+	m.Miss.Add(1)
+}
+
+// NewCachedReserveValkey creates a ReserveValkey that serves Zrange and Exists from the
+// server-assisted client side cache. Entries live locally for at most cacheTTL and are
+// invalidated by the server through the tracking protocol, so the client must be created
+// without ClientOption.DisableCache.
+func NewCachedReserveValkey(client valkey.Client, keyPrefix string, retry int8, cacheTTL time.Duration) *ReserveValkey {
+	a := NewReserveValkey(client, keyPrefix, retry)
+	a.EnableClientCache(cacheTTL)
+	return a
+}
+
+// EnableClientCache turns on client side caching of reads with the given local TTL.
+func (a *ReserveValkey) EnableClientCache(cacheTTL time.Duration) {
+	a.cacheTTL = cacheTTL
+	a.cacheMeasure = &cacheMeasure{}
+}
+
+// CacheHits returns the number of reads served from the client side cache.
+func (a *ReserveValkey) CacheHits() int64 {
+	if a.cacheMeasure == nil {
+		return 0
+	}
+	return a.cacheMeasure.Hit.Load()
+}
+
+// CacheMisses returns the number of cacheable reads that went to the server.
+func (a *ReserveValkey) CacheMisses() int64 {
+	if a.cacheMeasure == nil {
+		return 0
+	}
+	return a.cacheMeasure.Miss.Load()
+}
+
+// CacheStats returns the hits and misses of the client side cache, or a zero CacheStats
+// without EnableClientCache.
+func (a *ReserveValkey) CacheStats() CacheStats {
+	if a.cacheMeasure == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Enabled: a.cacheEnabled(),
+		Hit:     a.cacheMeasure.Hit.Load(),
+		Miss:    a.cacheMeasure.Miss.Load(),
+	}
+}
+
+func (a *ReserveValkey) cacheEnabled() bool {
+	return a.cacheTTL > 0
+}
@@ -0,0 +1,132 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+// pendingChange is a change of a reservation whose reverse index update, and event if Emit
+// is set, is yet to be applied. Id makes every change a distinct member.
+type pendingChange struct {
+	Id        string    `json:"id"`
+	Type      EventType `json:"type"`
+	UserId    uint64    `json:"user_id"`
+	LiveId    uint64    `json:"live_id"`
+	Emit      bool      `json:"emit"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChangesKey returns the key of the pending changes of userId.
+func (a *ReserveValkey) ChangesKey(userId uint64) string {
+	return a.schema.Changes(userId)
+}
+
+// indexInTx reports whether the reverse index and the event stream can be written in the
+// same transaction as the user key. Hash tagged keys of a user and a live, and the stream,
+// live in different cluster slots.
+func (a *ReserveValkey) indexInTx() bool {
+	return !a.schema.HashTag
+}
+
+// txChangeCmds returns the commands to queue in the transaction of a change of userId's
+// reservation of liveId. They update the reverse index and append the event themselves if
+// indexInTx, and otherwise record the change in the pending changes of the user, which share
+// its hash tag, for ApplyChanges to apply once the transaction has committed.
+func (a *ReserveValkey) txChangeCmds(b valkey.Builder, typ EventType, userId uint64, liveId uint64, emit bool) (valkey.Commands, error) {
+	now := time.Now()
+	if a.indexInTx() {
+		return a.changeCmds(b, typ, userId, liveId, emit, now), nil
+	}
+	payload, err := json.Marshal(pendingChange{
+		Id:        ulid.Make().String(),
+		Type:      typ,
+		UserId:    userId,
+		LiveId:    liveId,
+		Emit:      emit,
+		Timestamp: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pending change: marshal: %w", err)
+	}
+	return valkey.Commands{
+		b.Zadd().Key(a.ChangesKey(userId)).ScoreMember().ScoreMember(float64(now.UnixMilli()), string(payload)).Build(),
+	}, nil
+}
+
+// applyCommitted applies the pending changes of userId once a write has committed. A failure
+// is only logged, as the write stands and its change stays pending for the next write of the
+// user or ApplyPendingChanges.
+func (a *ReserveValkey) applyCommitted(ctx context.Context, userId uint64) {
+	if a.indexInTx() {
+		return
+	}
+	if _, err := a.ApplyChanges(ctx, userId); err != nil {
+		fmt.Printf("err: %v\n", err)
+	}
+}
+
+// ApplyChanges applies the pending changes of userId oldest first, removing each once it is
+// applied, and returns how many it applied. It stops at the first change that fails, which
+// stays pending.
+//
+// A change is applied at least once: when two callers apply the same user or one fails
+// between applying a change and removing it, its event may be appended to the stream twice.
+func (a *ReserveValkey) ApplyChanges(ctx context.Context, userId uint64) (int64, error) {
+	key := a.ChangesKey(userId)
+	var n int64
+	for {
+		members, err := a.client.Do(ctx, a.client.B().Zrange().Key(key).Min("0").Max("0").Build()).AsStrSlice()
+		if err != nil {
+			return n, fmt.Errorf("pending changes: zrange %s: %w", key, err)
+		}
+		if len(members) == 0 {
+			return n, nil
+		}
+
+		var c pendingChange
+		if err = json.Unmarshal([]byte(members[0]), &c); err != nil {
+			// it would block the changes after it forever
+			fmt.Printf("err: pending changes: drop %q of %s: %v\n", members[0], key, err)
+		} else if err = a.doChangeCmds(ctx, a.changeCmds(a.client.B(), c.Type, c.UserId, c.LiveId, c.Emit, c.Timestamp)); err != nil {
+			return n, err
+		} else {
+			n++
+		}
+		if err = a.client.Do(ctx, a.client.B().Zrem().Key(key).Member(members[0]).Build()).Error(); err != nil {
+			return n, fmt.Errorf("pending changes: zrem %s: %w", key, err)
+		}
+	}
+}
+
+// ApplyPendingChanges applies the pending changes of every user, those left behind by writes
+// whose changes failed to apply, and returns how many it applied. Users whose changes fail
+// are skipped and reported in the returned error.
+func (a *ReserveValkey) ApplyPendingChanges(ctx context.Context, count int64) (int64, error) {
+	var applied, failed int64
+	var lastErr error
+	err := scanNodes(ctx, a.client, a.schema.ChangesPattern(), "zset", count, func(key string) error {
+		userId, ok := a.schema.ParseChanges(key)
+		if !ok {
+			return nil
+		}
+		n, err := a.ApplyChanges(ctx, userId)
+		applied += n
+		if err != nil {
+			failed++
+			lastErr = err
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return applied, err
+	}
+	if lastErr != nil {
+		return applied, fmt.Errorf("pending changes of %d users failed: %w", failed, lastErr)
+	}
+	return applied, nil
+}
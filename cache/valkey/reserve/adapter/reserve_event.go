@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+type EventType string
+
+const (
+	EventReserved  EventType = "reserved"
+	EventCancelled EventType = "cancelled"
+)
+
+// ReserveEvent is a change of a user's reservation appended to the event stream.
+type ReserveEvent struct {
+	Id        string    `json:"id"`
+	Type      EventType `json:"type"`
+	UserId    uint64    `json:"user_id"`
+	LiveId    uint64    `json:"live_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EnableEventStream makes every reservation write append a ReserveEvent to stream. The
+// stream is trimmed to roughly maxLen entries, or never if maxLen is 0.
+//
+// Without a hash tagged schema the event is appended in the transaction of the write.
+// With one, the stream is in another cluster slot than the user key, so the transaction
+// records the change in the pending changes of the user and the event is appended once
+// the write has committed. If that fails, the change stays pending until ApplyChanges or
+// ApplyPendingChanges applies it.
+func (a *ReserveValkey) EnableEventStream(stream string, maxLen int64) {
+	a.stream = stream
+	a.streamMaxLen = maxLen
+}
+
+// Stream returns the name of the event stream, or "" if events are disabled.
+func (a *ReserveValkey) Stream() string {
+	return a.stream
+}
+
+func (a *ReserveValkey) xaddCmd(b valkey.Builder, typ EventType, userId uint64, liveId uint64, at time.Time) valkey.Completed {
+	u := strconv.FormatUint(userId, 10)
+	l := strconv.FormatUint(liveId, 10)
+	ts := strconv.FormatInt(at.UnixMilli(), 10)
+	if a.streamMaxLen > 0 {
+		return b.Xadd().Key(a.stream).Maxlen().Almost().Threshold(strconv.FormatInt(a.streamMaxLen, 10)).Id("*").FieldValue().
+			FieldValue("type", string(typ)).FieldValue("user_id", u).FieldValue("live_id", l).FieldValue("ts", ts).Build()
+	}
+	return b.Xadd().Key(a.stream).Id("*").FieldValue().
+		FieldValue("type", string(typ)).FieldValue("user_id", u).FieldValue("live_id", l).FieldValue("ts", ts).Build()
+}
+
+// changeCmds returns the commands that accompany a change of userId's reservation of liveId:
+// the reverse index update and, if emit is set and events are enabled, the change event made
+// at the given time.
+func (a *ReserveValkey) changeCmds(b valkey.Builder, typ EventType, userId uint64, liveId uint64, emit bool, at time.Time) valkey.Commands {
+	var cmds valkey.Commands
+	switch typ {
+	case EventReserved:
+		cmds = append(cmds, b.Sadd().Key(a.LiveKey(liveId)).Member(strconv.FormatUint(userId, 10)).Build())
+	case EventCancelled:
+		cmds = append(cmds, b.Srem().Key(a.LiveKey(liveId)).Member(strconv.FormatUint(userId, 10)).Build())
+	}
+	if emit && a.stream != "" {
+		cmds = append(cmds, a.xaddCmd(b, typ, userId, liveId, at))
+	}
+	return cmds
+}
+
+// doChangeCmds runs commands built by changeCmds outside of the user's transaction.
+func (a *ReserveValkey) doChangeCmds(ctx context.Context, cmds valkey.Commands) error {
+	for _, r := range a.client.DoMulti(ctx, cmds...) {
+		if r.Error() != nil {
+			return fmt.Errorf("apply reserve change: %w", r.Error())
+		}
+	}
+	return nil
+}
+
+// ParseReserveEvent converts a stream entry into a ReserveEvent.
+func ParseReserveEvent(e valkey.XRangeEntry) (ReserveEvent, error) {
+	userId, err := strconv.ParseUint(e.FieldValues["user_id"], 10, 64)
+	if err != nil {
+		return ReserveEvent{}, fmt.Errorf("parse reserve event %s: user_id: %w", e.ID, err)
+	}
+	liveId, err := strconv.ParseUint(e.FieldValues["live_id"], 10, 64)
+	if err != nil {
+		return ReserveEvent{}, fmt.Errorf("parse reserve event %s: live_id: %w", e.ID, err)
+	}
+	ts, err := strconv.ParseInt(e.FieldValues["ts"], 10, 64)
+	if err != nil {
+		return ReserveEvent{}, fmt.Errorf("parse reserve event %s: ts: %w", e.ID, err)
+	}
+	return ReserveEvent{
+		Id:        e.ID,
+		Type:      EventType(e.FieldValues["type"]),
+		UserId:    userId,
+		LiveId:    liveId,
+		Timestamp: time.UnixMilli(ts),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// ReserveEventReader reads the reservation event stream as a member of a consumer group.
+// Entries stay pending until acknowledged with Ack, and pending entries of consumers that
+// went away can be taken over with Claim.
+type ReserveEventReader struct {
+	client   valkey.Client
+	stream   string
+	group    string
+	consumer string
+}
+
+func NewReserveEventReader(client valkey.Client, stream, group, consumer string) *ReserveEventReader {
+	return &ReserveEventReader{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+	}
+}
+
+// CreateGroup creates the consumer group, and the stream if missing, starting at the
+// first entry. It is a no-op if the group already exists.
+func (r *ReserveEventReader) CreateGroup(ctx context.Context) error {
+	err := r.client.Do(ctx, r.client.B().XgroupCreate().Key(r.stream).Group(r.group).Id("0").Mkstream().Build()).Error()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create group %s: %w", r.group, err)
+	}
+	return nil
+}
+
+// Read returns up to count new events for this consumer, waiting up to block for them.
+// It returns no events and no error if nothing arrived in time.
+func (r *ReserveEventReader) Read(ctx context.Context, count int64, block time.Duration) ([]ReserveEvent, error) {
+	res, err := r.client.Do(ctx, r.client.B().Xreadgroup().Group(r.group, r.consumer).Count(count).Block(block.Milliseconds()).
+		Streams().Key(r.stream).Id(">").Build()).AsXRead()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read events: %w", err)
+	}
+	return parseReserveEvents(res[r.stream])
+}
+
+// Ack acknowledges processed events so that they are no longer pending.
+func (r *ReserveEventReader) Ack(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	n, err := r.client.Do(ctx, r.client.B().Xack().Key(r.stream).Group(r.group).Id(ids...).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("ack events: %w", err)
+	}
+	return n, nil
+}
+
+// Claim takes over up to count events that have been pending for at least minIdle,
+// scanning the pending list from start ("0-0" for the beginning). It returns the claimed
+// events and the id to start the next call from, which is "0-0" once the scan is complete.
+func (r *ReserveEventReader) Claim(ctx context.Context, minIdle time.Duration, start string, count int64) ([]ReserveEvent, string, error) {
+	res, err := r.client.Do(ctx, r.client.B().Xautoclaim().Key(r.stream).Group(r.group).Consumer(r.consumer).
+		MinIdleTime(strconv.FormatInt(minIdle.Milliseconds(), 10)).Start(start).Count(count).Build()).ToArray()
+	if err != nil {
+		return nil, "", fmt.Errorf("claim events: %w", err)
+	}
+	if len(res) < 2 {
+		return nil, "", fmt.Errorf("claim events: unexpected reply of length %d", len(res))
+	}
+	next, err := res[0].ToString()
+	if err != nil {
+		return nil, "", fmt.Errorf("claim events: %w", err)
+	}
+	entries, err := res[1].AsXRange()
+	if err != nil {
+		return nil, "", fmt.Errorf("claim events: %w", err)
+	}
+	events, err := parseReserveEvents(entries)
+	return events, next, err
+}
+
+func parseReserveEvents(entries []valkey.XRangeEntry) ([]ReserveEvent, error) {
+	events := make([]ReserveEvent, 0, len(entries))
+	for _, e := range entries {
+		// entries deleted while pending come back without fields
+		if e.FieldValues == nil {
+			continue
+		}
+		ev, err := ParseReserveEvent(e)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
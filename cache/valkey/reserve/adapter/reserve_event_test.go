@@ -0,0 +1,139 @@
+package adapter_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+// streamEvents returns the type and live of the events in the stream of a, in order.
+func streamEvents(t *testing.T, client valkey.Client, a *adapter.ReserveValkey) []string {
+	t.Helper()
+	entries, err := client.Do(context.Background(), client.B().Xrange().Key(a.Stream()).Start("-").End("+").Build()).AsXRange()
+	if err != nil {
+		t.Fatalf("xrange: %v", err)
+	}
+	events := []string{}
+	for _, e := range entries {
+		event, err := adapter.ParseReserveEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, string(event.Type)+":"+e.FieldValues["live_id"])
+	}
+	return events
+}
+
+func pendingChanges(t *testing.T, client valkey.Client, a *adapter.ReserveValkey, userId uint64) int64 {
+	t.Helper()
+	n, err := client.Do(context.Background(), client.B().Zcard().Key(a.ChangesKey(userId)).Build()).AsInt64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestEventInTransaction(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+	a.EnableEventStream("reserve-events", 0)
+
+	if _, err := a.CasZadd(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CacheZadd(ctx, 1, 11); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Zrem(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	// a failing event fails the write along with it
+	s.FailCommand("XADD", "ERR injected", 1)
+	if _, err := a.Zadd(ctx, 1, 12); err == nil {
+		t.Error("zadd succeeded while its event failed")
+	}
+
+	if got, want := streamEvents(t, client, a), []string{"reserved:10", "cancelled:10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if got, err := a.Get(ctx, 1); err != nil || got != "11" {
+		t.Errorf("get = %q, %v, want 11", got, err)
+	}
+	if n := pendingChanges(t, client, a, 1); n != 0 {
+		t.Errorf("pending changes = %d without a hash tag", n)
+	}
+}
+
+func TestWriteStandsWhenEventFails(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	schema := adapter.NewKeySchema("reserve:")
+	schema.HashTag = true
+	a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+	a.EnableEventStream("reserve-events", 0)
+
+	// the event is appended after the write has committed
+	s.FailCommand("XADD", "ERR injected", -1)
+	if _, err := a.CasZadd(ctx, 1, 10); err != nil {
+		t.Fatalf("cas zadd: %v", err)
+	}
+	if _, err := a.Zadd(ctx, 1, 11); err != nil {
+		t.Fatalf("zadd: %v", err)
+	}
+	if _, err := a.Zrem(ctx, 1, 10); err != nil {
+		t.Fatalf("zrem: %v", err)
+	}
+	if got, err := a.Get(ctx, 1); err != nil || got != "11" {
+		t.Errorf("get = %q, %v, want 11", got, err)
+	}
+
+	// the changes are kept until they apply
+	if n := pendingChanges(t, client, a, 1); n != 3 {
+		t.Fatalf("pending changes = %d, want 3", n)
+	}
+	if got := streamEvents(t, client, a); len(got) != 0 {
+		t.Fatalf("events = %v while xadd fails", got)
+	}
+	s.ClearFaults()
+	applied, err := a.ApplyPendingChanges(ctx, 10)
+	if err != nil || applied != 3 {
+		t.Fatalf("apply pending changes = %d, %v, want 3", applied, err)
+	}
+	if got, want := streamEvents(t, client, a), []string{"reserved:10", "reserved:11", "cancelled:10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if got, want := liveUsers(t, a, 11), []uint64{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("users of live 11 = %v, want %v", got, want)
+	}
+	if got := liveUsers(t, a, 10); len(got) != 0 {
+		t.Errorf("users of live 10 = %v, want none", got)
+	}
+	if n := pendingChanges(t, client, a, 1); n != 0 {
+		t.Errorf("pending changes = %d after applying them", n)
+	}
+
+	// the next write applies the changes left before it
+	s.FailCommand("XADD", "ERR injected", 1)
+	if _, err = a.CasZadd(ctx, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.CacheZadd(ctx, 2, 12); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingChanges(t, client, a, 2); n != 0 {
+		t.Errorf("pending changes = %d after the next write", n)
+	}
+	if got, want := liveUsers(t, a, 12), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("users of live 12 = %v, want %v", got, want)
+	}
+	if got, want := streamEvents(t, client, a), []string{"reserved:10", "reserved:11", "cancelled:10", "reserved:10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
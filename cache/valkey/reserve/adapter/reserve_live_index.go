@@ -0,0 +1,186 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// ScanLiveUsers returns a page of users who reserved liveId, starting at cursor.
+// The returned cursor is 0 when the iteration is complete.
+func (a *ReserveValkey) ScanLiveUsers(ctx context.Context, liveId uint64, cursor uint64, count int64) ([]uint64, uint64, error) {
+	c, cancel := a.client.Dedicate()
+	defer cancel()
+
+	entry, err := c.Do(ctx, c.B().Sscan().Key(a.LiveKey(liveId)).Cursor(cursor).Count(count).Build()).AsScanEntry()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userIds := make([]uint64, 0, len(entry.Elements))
+	for _, e := range entry.Elements {
+		userId, err := strconv.ParseUint(e, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan live users: invalid user id %q: %w", e, err)
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, entry.Cursor, nil
+}
+
+// ForEachLiveUser walks the reverse index of liveId page by page and calls fn for each page.
+// Iteration stops at the first error returned by fn.
+func (a *ReserveValkey) ForEachLiveUser(ctx context.Context, liveId uint64, count int64, fn func(userIds []uint64) error) error {
+	var cursor uint64
+	for {
+		userIds, next, err := a.ScanLiveUsers(ctx, liveId, cursor, count)
+		if err != nil {
+			return err
+		}
+		if len(userIds) > 0 {
+			if err = fn(userIds); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// StoredLivesFunc returns the lives reserved by userId in the backing store, which is the
+// source of truth once the cached reservations of the user have expired.
+type StoredLivesFunc func(ctx context.Context, userId uint64) ([]uint64, error)
+
+// ReconcileLiveIndex rebuilds the reverse index from the per-user keys.
+// Every reservation found in a user key is added to its live's set, then members of
+// live sets that are no longer reserved by the user are removed.
+// User keys expire after ReserveTTL while the index does not, so a member whose user key
+// is gone is checked against stored instead, and kept if stored is nil.
+// Each step is idempotent, so it can be re-run at any time; a reservation written between
+// the check and the removal of a member is restored by the next run.
+// With a hash tagged schema the index is written outside of the user's transaction,
+// and this is also what repairs it after a partial failure.
+func (a *ReserveValkey) ReconcileLiveIndex(ctx context.Context, count int64, stored StoredLivesFunc) (added int64, removed int64, err error) {
+	// add missing members
+	err = scanNodes(ctx, a.client, a.schema.UserPattern(), "zset", count, func(key string) error {
+		userId, ok := a.schema.ParseUser(key)
+		if !ok {
+			return nil
+		}
+		lives, err := a.client.Do(ctx, a.client.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
+		if err != nil {
+			return fmt.Errorf("reconcile: zrange %s: %w", key, err)
+		}
+		for _, live := range lives {
+			liveId, err := strconv.ParseUint(live, 10, 64)
+			if err != nil {
+				continue
+			}
+			n, err := a.client.Do(ctx, a.client.B().Sadd().Key(a.LiveKey(liveId)).Member(strconv.FormatUint(userId, 10)).Build()).AsInt64()
+			if err != nil {
+				return fmt.Errorf("reconcile: sadd %s: %w", a.LiveKey(liveId), err)
+			}
+			added += n
+		}
+		return nil
+	})
+	if err != nil {
+		return added, removed, err
+	}
+
+	// remove stale members
+	err = scanNodes(ctx, a.client, a.schema.LivePattern(), "set", count, func(key string) error {
+		liveId, ok := a.schema.ParseLive(key)
+		if !ok {
+			return nil
+		}
+		n, err := a.pruneLiveUsers(ctx, liveId, count, stored)
+		removed += n
+		return err
+	})
+	return added, removed, err
+}
+
+func (a *ReserveValkey) pruneLiveUsers(ctx context.Context, liveId uint64, count int64, stored StoredLivesFunc) (int64, error) {
+	var removed int64
+	err := a.ForEachLiveUser(ctx, liveId, count, func(userIds []uint64) error {
+		for _, userId := range userIds {
+			reserved, err := a.reserved(ctx, userId, liveId, stored)
+			if err != nil {
+				return err
+			}
+			if reserved {
+				continue
+			}
+			n, err := a.client.Do(ctx, a.client.B().Srem().Key(a.LiveKey(liveId)).Member(strconv.FormatUint(userId, 10)).Build()).AsInt64()
+			if err != nil {
+				return fmt.Errorf("reconcile: srem %s: %w", a.LiveKey(liveId), err)
+			}
+			removed += n
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// reserved reports whether userId still reserves liveId, according to the user key or, if
+// it has expired, to stored.
+func (a *ReserveValkey) reserved(ctx context.Context, userId uint64, liveId uint64, stored StoredLivesFunc) (bool, error) {
+	key := a.Key(userId)
+	err := a.client.Do(ctx, a.client.B().Zscore().Key(key).Member(strconv.FormatUint(liveId, 10)).Build()).Error()
+	if err == nil {
+		return true, nil
+	}
+	if !valkey.IsValkeyNil(err) {
+		return false, fmt.Errorf("reconcile: zscore %s: %w", key, err)
+	}
+
+	n, err := a.client.Do(ctx, a.client.B().Exists().Key(key).Build()).AsInt64()
+	if err != nil {
+		return false, fmt.Errorf("reconcile: exists %s: %w", key, err)
+	}
+	if n > 0 {
+		return false, nil
+	}
+	if stored == nil {
+		return true, nil
+	}
+	lives, err := stored(ctx, userId)
+	if err != nil {
+		return false, fmt.Errorf("reconcile: stored lives of %d: %w", userId, err)
+	}
+	for _, l := range lives {
+		if l == liveId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// scanNodes runs SCAN on every node of the client, which is a single node unless the
+// client is connected to a cluster, and calls fn for each matching key.
+func scanNodes(ctx context.Context, client valkey.Client, pattern string, typ string, count int64, fn func(key string) error) error {
+	for addr, node := range client.Nodes() {
+		var cursor uint64
+		for {
+			entry, err := node.Do(ctx, node.B().Scan().Cursor(cursor).Match(pattern).Count(count).Type(typ).Build()).AsScanEntry()
+			if err != nil {
+				return fmt.Errorf("scan %s on %s: %w", pattern, addr, err)
+			}
+			for _, key := range entry.Elements {
+				if err = fn(key); err != nil {
+					return err
+				}
+			}
+			if entry.Cursor == 0 {
+				break
+			}
+			cursor = entry.Cursor
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package adapter_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func liveUsers(t *testing.T, a *adapter.ReserveValkey, liveId uint64) []uint64 {
+	t.Helper()
+	var users []uint64
+	err := a.ForEachLiveUser(context.Background(), liveId, 10, func(userIds []uint64) error {
+		users = append(users, userIds...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("for each live user: %v", err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+func TestReconcileLiveIndex(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+
+	for _, userId := range []uint64{1, 2, 3, 4} {
+		if _, err := a.CasZadd(ctx, userId, 10); err != nil {
+			t.Fatalf("cas zadd %d: %v", userId, err)
+		}
+	}
+	// user 2 cancelled without the index being updated, user 3 and 4 expired
+	if err := client.Do(ctx, client.B().Zrem().Key(a.Key(2)).Member("10").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CasZadd(ctx, 2, 11); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Do(ctx, client.B().Del().Key(a.Key(3), a.Key(4)).Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the backing store, expired users are kept
+	_, removed, err := a.ReconcileLiveIndex(ctx, 10, nil)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	if got, want := liveUsers(t, a, 10), []uint64{1, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("live users = %v, want %v", got, want)
+	}
+
+	// the backing store still has the reservation of user 3 only
+	stored := func(ctx context.Context, userId uint64) ([]uint64, error) {
+		if userId == 3 {
+			return []uint64{10}, nil
+		}
+		return nil, nil
+	}
+	_, removed, err = a.ReconcileLiveIndex(ctx, 10, stored)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	if got, want := liveUsers(t, a, 10), []uint64{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("live users = %v, want %v", got, want)
+	}
+	if got, want := liveUsers(t, a, 11), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("live users of 11 = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+)
+
+// LoadedKey returns the key holding when the reservations of userId were loaded from storage.
+func (a *ReserveValkey) LoadedKey(userId uint64) string {
+	return a.schema.Loaded(userId)
+}
+
+// ZrangeLoaded returns the lives reserved by userId along with the time they were loaded
+// from storage, which is zero if unknown. A sorted set is deleted with its last member, so
+// no lives mean that the user has none if they were loaded, and otherwise that nothing is
+// cached, for which it returns errorz.ErrResourceNotFound.
+func (a *ReserveValkey) ZrangeLoaded(ctx context.Context, userId uint64) (string, time.Time, error) {
+	// the keys are only in the same slot with a hash tag, so they are read by a pipeline
+	// that the client splits by slot on a cluster
+	res := a.client.DoMulti(ctx,
+		a.client.B().Zrange().Key(a.Key(userId)).Min("0").Max("-1").Build(),
+		a.client.B().Get().Key(a.LoadedKey(userId)).Build())
+
+	lives, err := res[0].AsStrSlice()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var loadedAt time.Time
+	ms, err := res[1].AsInt64()
+	if err == nil {
+		loadedAt = time.UnixMilli(ms)
+	} else if !valkey.IsValkeyNil(err) {
+		return "", time.Time{}, err
+	}
+	if len(lives) == 0 && loadedAt.IsZero() {
+		return "", time.Time{}, errorz.ErrResourceNotFound
+	}
+	return strings.Join(lives, ","), loadedAt, nil
+}
+
+// MarkLoaded records that the reservations of userId were loaded from storage at loadedAt,
+// and keeps them for another ReserveTTL. The two keys are written in one transaction when
+// the schema hash tags them, and one after the other otherwise, as a cluster rejects a
+// transaction across slots.
+func (a *ReserveValkey) MarkLoaded(ctx context.Context, userId uint64, loadedAt time.Time) error {
+	b := a.client.B()
+	cmds := valkey.Commands{
+		b.Set().Key(a.LoadedKey(userId)).Value(strconv.FormatInt(loadedAt.UnixMilli(), 10)).Ex(ReserveTTL).Build(),
+		b.Expire().Key(a.Key(userId)).Seconds(int64(ReserveTTL / time.Second)).Build(),
+	}
+
+	var res []valkey.ValkeyResult
+	if a.schema.HashTag {
+		c, cancel := a.client.Dedicate()
+		defer cancel()
+
+		cmds = append(append(valkey.Commands{c.B().Multi().Build()}, cmds...), c.B().Exec().Build())
+		res = c.DoMulti(ctx, cmds...)
+	} else {
+		res = a.client.DoMulti(ctx, cmds...)
+	}
+	for _, r := range res {
+		if err := r.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceLoaded replaces the reservations of userId with the lives in storage and marks
+// them loaded, keeping them for another ReserveTTL, and returns all reserved lives. Cached
+// lives missing from storage are removed, and the reverse index follows without emitting
+// events. The load time is recorded even when there are no lives, so that a user without
+// reservations is served until the load is stale.
+//
+// The reservations are watched from before storage is read, and everything is written in
+// one transaction, so a write made in the meantime is not lost: the transaction aborts and
+// is retried with storage read again.
+func (a *ReserveValkey) ReplaceLoaded(ctx context.Context, userId uint64, stored StoredLivesFunc) (string, error) {
+	if a.retry == 0 {
+		return a.replaceLoaded(ctx, userId, stored)
+	}
+
+	var res string
+	var err error
+	for i := int8(0); i < a.retry; i++ {
+		res, err = a.replaceLoaded(ctx, userId, stored)
+		if !errors.Is(err, errorz.ErrNeedRetry) {
+			return res, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return "", fmt.Errorf("replace loaded reserve: retry limit reached: %w", err)
+}
+
+func (a *ReserveValkey) replaceLoaded(ctx context.Context, userId uint64, stored StoredLivesFunc) (string, error) {
+	c, cancel := a.client.Dedicate()
+	defer cancel()
+
+	key := a.Key(userId)
+	if err := c.Do(ctx, c.B().Watch().Key(key).Build()).Error(); err != nil {
+		return "", err
+	}
+	cached, err := c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
+	if err != nil && !valkey.IsValkeyNil(err) {
+		return "", err
+	}
+	loadedAt := time.Now()
+	lives, err := stored(ctx, userId)
+	if err != nil {
+		return "", fmt.Errorf("replace loaded: stored lives of %d: %w", userId, err)
+	}
+	removed := make(map[string]struct{}, len(cached))
+	for _, m := range cached {
+		removed[m] = struct{}{}
+	}
+
+	cmds := valkey.Commands{
+		c.B().Multi().Build(),
+		c.B().Del().Key(key).Build(),
+	}
+	if len(lives) > 0 {
+		zadd := c.B().Zadd().Key(key).ScoreMember()
+		for _, liveId := range lives {
+			zadd = zadd.ScoreMember(float64(liveId), strconv.FormatUint(liveId, 10))
+		}
+		cmds = append(cmds, zadd.Build(), c.B().Expire().Key(key).Seconds(int64(ReserveTTL/time.Second)).Build())
+	}
+	cmds = append(cmds, c.B().Set().Key(a.LoadedKey(userId)).Value(strconv.FormatInt(loadedAt.UnixMilli(), 10)).Ex(ReserveTTL).Build())
+	for _, liveId := range lives {
+		m := strconv.FormatUint(liveId, 10)
+		if _, ok := removed[m]; ok {
+			delete(removed, m)
+			continue
+		}
+		changes, err := a.txChangeCmds(c.B(), EventReserved, userId, liveId, false)
+		if err != nil {
+			return "", err
+		}
+		cmds = append(cmds, changes...)
+	}
+	for m := range removed {
+		liveId, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			// not a live, so not in the reverse index either
+			continue
+		}
+		changes, err := a.txChangeCmds(c.B(), EventCancelled, userId, liveId, false)
+		if err != nil {
+			return "", err
+		}
+		cmds = append(cmds, changes...)
+	}
+	cmds = append(cmds, c.B().Exec().Build())
+
+	for i, r := range c.DoMulti(ctx, cmds...) {
+		if valkey.IsValkeyNil(r.Error()) {
+			// the reservations changed since WATCH
+			return "", errorz.ErrNeedRetry
+		}
+		if r.Error() != nil {
+			return "", fmt.Errorf("replace loaded(resInd=%d): %w", i, r.Error())
+		}
+	}
+	a.applyCommitted(ctx, userId)
+
+	res, err := c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(res, ","), nil
+}
@@ -0,0 +1,136 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestMarkLoaded(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hashTag=%v", hashTag), func(t *testing.T) {
+			ctx := context.Background()
+			client := valkeytest.NewClient(t, valkeytest.Start(t))
+			schema := adapter.NewKeySchema("reserve:")
+			schema.HashTag = hashTag
+			a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+
+			if _, _, err := a.ZrangeLoaded(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+				t.Fatalf("zrange loaded of a missing user: got %v, want ErrResourceNotFound", err)
+			}
+
+			if _, err := a.CacheZadd(ctx, 1, 10); err != nil {
+				t.Fatal(err)
+			}
+			lives, loadedAt, err := a.ZrangeLoaded(ctx, 1)
+			if err != nil || lives != "10" || !loadedAt.IsZero() {
+				t.Fatalf("zrange loaded before marking = %q, %v, %v", lives, loadedAt, err)
+			}
+
+			now := time.UnixMilli(time.Now().UnixMilli())
+			if err = a.MarkLoaded(ctx, 1, now); err != nil {
+				t.Fatalf("mark loaded: %v", err)
+			}
+			lives, loadedAt, err = a.ZrangeLoaded(ctx, 1)
+			if err != nil || lives != "10" || !loadedAt.Equal(now) {
+				t.Errorf("zrange loaded = %q, %v, %v, want 10, %v", lives, loadedAt, err, now)
+			}
+			if ttl, err := client.Do(ctx, client.B().Ttl().Key(a.LoadedKey(1)).Build()).AsInt64(); err != nil || ttl <= 0 {
+				t.Errorf("ttl of the loaded key = %d, %v", ttl, err)
+			}
+		})
+	}
+}
+
+func TestReplaceLoaded(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hashTag=%v", hashTag), func(t *testing.T) {
+			ctx := context.Background()
+			client := valkeytest.NewClient(t, valkeytest.Start(t))
+			schema := adapter.NewKeySchema("reserve:")
+			schema.HashTag = hashTag
+			a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+			var stored []uint64
+			storedLives := func(ctx context.Context, userId uint64) ([]uint64, error) {
+				return stored, nil
+			}
+
+			if _, err := a.CacheZadd(ctx, 1, 10); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.CacheZadd(ctx, 1, 11); err != nil {
+				t.Fatal(err)
+			}
+			lives, loadedAt, err := a.ZrangeLoaded(ctx, 1)
+			if err != nil || lives != "10,11" || !loadedAt.IsZero() {
+				t.Fatalf("zrange loaded before replacing = %q, %v, %v", lives, loadedAt, err)
+			}
+
+			// live 10 was cancelled in storage
+			stored = []uint64{11, 12}
+			before := time.Now().Truncate(time.Millisecond)
+			res, err := a.ReplaceLoaded(ctx, 1, storedLives)
+			if err != nil || res != "11,12" {
+				t.Fatalf("replace loaded = %q, %v, want 11,12", res, err)
+			}
+			lives, loadedAt, err = a.ZrangeLoaded(ctx, 1)
+			if err != nil || lives != "11,12" || loadedAt.Before(before) {
+				t.Errorf("zrange loaded = %q, %v, %v, want 11,12 loaded after %v", lives, loadedAt, err, before)
+			}
+			for _, key := range []string{a.Key(1), a.LoadedKey(1)} {
+				if ttl, err := client.Do(ctx, client.B().Ttl().Key(key).Build()).AsInt64(); err != nil || ttl <= 0 {
+					t.Errorf("ttl of %s = %d, %v", key, ttl, err)
+				}
+			}
+			for liveId, want := range map[uint64]int{10: 0, 11: 1, 12: 1} {
+				if got := liveUsers(t, a, liveId); len(got) != want {
+					t.Errorf("users of live %d = %v, want %d", liveId, got, want)
+				}
+			}
+
+			// an empty load is served until it is stale
+			stored = nil
+			if res, err = a.ReplaceLoaded(ctx, 1, storedLives); err != nil || res != "" {
+				t.Fatalf("replace loaded with no lives = %q, %v", res, err)
+			}
+			lives, loadedAt, err = a.ZrangeLoaded(ctx, 1)
+			if err != nil || lives != "" || loadedAt.IsZero() {
+				t.Errorf("zrange loaded of no lives = %q, %v, %v, want none and the load time", lives, loadedAt, err)
+			}
+			if got := liveUsers(t, a, 12); len(got) != 0 {
+				t.Errorf("users of live 12 = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestReplaceLoadedKeepsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	a := adapter.NewReserveValkey(client, "reserve:", 3)
+
+	reads := 0
+	res, err := a.ReplaceLoaded(ctx, 1, func(ctx context.Context, userId uint64) ([]uint64, error) {
+		reads++
+		if reads == 1 {
+			// reserved while storage is read, and stored by the time it is read again
+			if _, err := a.CasZadd(ctx, 1, 11); err != nil {
+				t.Error(err)
+			}
+			return []uint64{10}, nil
+		}
+		return []uint64{10, 11}, nil
+	})
+	if err != nil || res != "10,11" {
+		t.Fatalf("replace loaded = %q, %v, want 10,11", res, err)
+	}
+	if reads != 2 {
+		t.Errorf("storage read %d times, want 2", reads)
+	}
+}
@@ -0,0 +1,158 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+)
+
+// MigrateLegacyKeys moves reservations written by the old Get/Set path, which stored a
+// comma separated string under the bare user id (`1` => "10108,10109"), into the sorted
+// sets of the key schema and the reverse index. Migrated reservations expire after
+// ReserveTTL like any other cached ones, and each legacy key is removed once migrated.
+func (a *ReserveValkey) MigrateLegacyKeys(ctx context.Context, count int64) (int64, error) {
+	var migrated int64
+	err := scanNodes(ctx, a.client, "[0-9]*", "string", count, func(key string) error {
+		userId, ok := parseLegacyKey(key)
+		if !ok {
+			// the pattern also matches keys of other formats that start with a digit
+			fmt.Printf("err: migrate: skip %q, not a legacy key\n", key)
+			return nil
+		}
+		ok, err := a.migrateLegacyKey(ctx, key, userId)
+		if err != nil {
+			return err
+		}
+		if ok {
+			migrated++
+		}
+		return nil
+	})
+	return migrated, err
+}
+
+// parseLegacyKey returns the user id of a legacy key, which is the bare user id as written by
+// the old Set path, with no sign, leading zeros or anything around it.
+func parseLegacyKey(key string) (uint64, bool) {
+	userId, err := strconv.ParseUint(key, 10, 64)
+	if err != nil || strconv.FormatUint(userId, 10) != key {
+		return 0, false
+	}
+	return userId, true
+}
+
+func (a *ReserveValkey) migrateLegacyKey(ctx context.Context, legacyKey string, userId uint64) (bool, error) {
+	if a.retry == 0 {
+		return a.migrateLegacyKeyOnce(ctx, legacyKey, userId)
+	}
+
+	var ok bool
+	var err error
+	for i := int8(0); i < a.retry; i++ {
+		ok, err = a.migrateLegacyKeyOnce(ctx, legacyKey, userId)
+		if !errors.Is(err, errorz.ErrNeedRetry) {
+			// only a transaction aborted by a change of the legacy key is worth retrying
+			return ok, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false, fmt.Errorf("migrate %s: retry limit reached: %w", legacyKey, err)
+}
+
+func (a *ReserveValkey) migrateLegacyKeyOnce(ctx context.Context, legacyKey string, userId uint64) (bool, error) {
+	c, cancel := a.client.Dedicate()
+	defer cancel()
+
+	if err := c.Do(ctx, c.B().Watch().Key(legacyKey).Build()).Error(); err != nil {
+		return false, fmt.Errorf("migrate %s: watch: %w", legacyKey, err)
+	}
+
+	lives, err := c.Do(ctx, c.B().Get().Key(legacyKey).Build()).ToString()
+	if err != nil {
+		c.Do(ctx, c.B().Unwatch().Build())
+		if valkey.IsValkeyNil(err) {
+			// removed by someone else in the meantime
+			return false, nil
+		}
+		return false, fmt.Errorf("migrate %s: get: %w", legacyKey, err)
+	}
+
+	key := a.Key(userId)
+	member := strconv.FormatUint(userId, 10)
+	ttl := int64(ReserveTTL / time.Second)
+	var liveIds []uint64
+	var writes valkey.Commands
+	for _, live := range strings.Split(lives, ",") {
+		liveId, err := strconv.ParseUint(strings.TrimSpace(live), 10, 64)
+		if err != nil {
+			continue
+		}
+		liveIds = append(liveIds, liveId)
+		writes = append(writes, c.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(liveId), strconv.FormatUint(liveId, 10)).Build())
+	}
+	if len(writes) > 0 {
+		writes = append(writes, c.B().Expire().Key(key).Seconds(ttl).Nx().Build())
+	}
+
+	if !a.schema.HashTag {
+		// the legacy key `1` and the user key `reserve:1` are in different slots of a
+		// cluster, so the reservations and the index are copied first and the legacy key is
+		// deleted in a transaction of its own. Copying is idempotent, so a retry after a
+		// failure in between only copies them again.
+		for _, liveId := range liveIds {
+			writes = append(writes, c.B().Sadd().Key(a.LiveKey(liveId)).Member(member).Build())
+		}
+		if len(writes) > 0 {
+			for _, r := range a.client.DoMulti(ctx, writes...) {
+				if r.Error() != nil {
+					c.Do(ctx, c.B().Unwatch().Build())
+					return false, fmt.Errorf("migrate %s: %w", legacyKey, r.Error())
+				}
+			}
+		}
+		if err = a.execLegacyTx(ctx, c, legacyKey, nil); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// the legacy key `1` and a hash tagged user key `reserve:{1}` share a slot, and so do
+	// the pending changes updating the index once the transaction has committed
+	for _, liveId := range liveIds {
+		changes, err := a.txChangeCmds(c.B(), EventReserved, userId, liveId, false)
+		if err != nil {
+			c.Do(ctx, c.B().Unwatch().Build())
+			return false, err
+		}
+		writes = append(writes, changes...)
+	}
+	if err = a.execLegacyTx(ctx, c, legacyKey, writes); err != nil {
+		return false, err
+	}
+	a.applyCommitted(ctx, userId)
+	return true, nil
+}
+
+// execLegacyTx runs cmds and deletes legacyKey in a transaction, which fails with
+// errorz.ErrNeedRetry if legacyKey has changed since it was watched by c.
+func (a *ReserveValkey) execLegacyTx(ctx context.Context, c valkey.DedicatedClient, legacyKey string, cmds valkey.Commands) error {
+	tx := make(valkey.Commands, 0, len(cmds)+3)
+	tx = append(tx, c.B().Multi().Build())
+	tx = append(tx, cmds...)
+	tx = append(tx, c.B().Del().Key(legacyKey).Build(), c.B().Exec().Build())
+	for _, r := range c.DoMulti(ctx, tx...) {
+		if valkey.IsValkeyNil(r.Error()) {
+			return errorz.ErrNeedRetry
+		}
+		if r.Error() != nil {
+			return fmt.Errorf("migrate %s: %w", legacyKey, r.Error())
+		}
+	}
+	return nil
+}
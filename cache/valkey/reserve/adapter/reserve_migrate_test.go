@@ -0,0 +1,156 @@
+package adapter_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		ctx := context.Background()
+		s := valkeytest.Start(t)
+		client := valkeytest.NewClient(t, s)
+		schema := adapter.NewKeySchema("reserve:")
+		schema.HashTag = hashTag
+		a := adapter.NewReserveValkeyWithSchema(client, schema, 3)
+
+		if err := client.Do(ctx, client.B().Set().Key("1").Value("10108,10109").Build()).Error(); err != nil {
+			t.Fatal(err)
+		}
+		n, err := a.MigrateLegacyKeys(ctx, 10)
+		if err != nil {
+			t.Fatalf("hash tag %v: migrate: %v", hashTag, err)
+		}
+		if n != 1 {
+			t.Errorf("hash tag %v: migrated = %d, want 1", hashTag, n)
+		}
+
+		if got, err := a.Get(ctx, 1); err != nil || got != "10108,10109" {
+			t.Errorf("hash tag %v: get = %q, %v", hashTag, got, err)
+		}
+		if got, want := liveUsers(t, a, 10109), []uint64{1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("hash tag %v: live users = %v, want %v", hashTag, got, want)
+		}
+		ttl, err := client.Do(ctx, client.B().Ttl().Key(a.Key(1)).Build()).AsInt64()
+		if err != nil || ttl <= 0 {
+			t.Errorf("hash tag %v: ttl = %d, %v, want the ReserveTTL", hashTag, ttl, err)
+		}
+		exists, err := client.Do(ctx, client.B().Exists().Key("1").Build()).AsInt64()
+		if err != nil || exists != 0 {
+			t.Errorf("hash tag %v: legacy key exists = %d, %v", hashTag, exists, err)
+		}
+	}
+}
+
+func TestMigrateLegacyKeysKeepsFailedIndexChanges(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	schema := adapter.NewKeySchema("reserve:")
+	schema.HashTag = true
+	a := adapter.NewReserveValkeyWithSchema(client, schema, 3)
+
+	if err := client.Do(ctx, client.B().Set().Key("1").Value("10108").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	s.FailCommand("SADD", "ERR injected", 1)
+	if n, err := a.MigrateLegacyKeys(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("migrate = %d, %v, want 1", n, err)
+	}
+	if got := liveUsers(t, a, 10108); len(got) != 0 {
+		t.Fatalf("live users = %v while sadd fails", got)
+	}
+	if n, err := a.ApplyPendingChanges(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("apply pending changes = %d, %v, want 1", n, err)
+	}
+	if got, want := liveUsers(t, a, 10108), []uint64{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("live users = %v, want %v", got, want)
+	}
+}
+
+func TestMigrateLegacyKeysRetriesAbortedTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	other := valkeytest.NewClient(t, s)
+	schema := adapter.NewKeySchema("reserve:")
+	schema.HashTag = true
+	a := adapter.NewReserveValkeyWithSchema(client, schema, 3)
+
+	if err := client.Do(ctx, client.B().Set().Key("1").Value("10108,10109").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	// the legacy key changes after it was read, which aborts the first transaction
+	var once sync.Once
+	changed := make(chan error, 1)
+	s.SetDelay(func(cmd []string) time.Duration {
+		if !strings.EqualFold(cmd[0], "MULTI") {
+			return 0
+		}
+		var d time.Duration
+		once.Do(func() {
+			go func() {
+				changed <- other.Do(ctx, other.B().Set().Key("1").Value("10108,10110").Build()).Error()
+			}()
+			d = 200 * time.Millisecond
+		})
+		return d
+	})
+	if n, err := a.MigrateLegacyKeys(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("migrate = %d, %v, want 1", n, err)
+	}
+	if err := <-changed; err != nil {
+		t.Fatal(err)
+	}
+	if got, err := a.Get(ctx, 1); err != nil || got != "10108,10110" {
+		t.Errorf("get = %q, %v, want the legacy key as of the retry", got, err)
+	}
+}
+
+func TestMigrateLegacyKeysFailsFast(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 3)
+
+	if err := client.Do(ctx, client.B().Set().Key("1").Value("10108").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	// a failure other than an aborted transaction is not retried
+	s.FailCommand("GET", "ERR injected", 1)
+	if _, err := a.MigrateLegacyKeys(ctx, 10); err == nil || !strings.Contains(err.Error(), "injected") {
+		t.Fatalf("migrate: %v, want the injected error", err)
+	}
+	if exists, _ := client.Do(ctx, client.B().Exists().Key("1").Build()).AsInt64(); exists != 1 {
+		t.Error("legacy key was migrated by a retry")
+	}
+}
+
+func TestMigrateLegacyKeysSkipsOtherKeys(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 3)
+
+	others := []string{"1abc", "12:x", "01", "2021-10-19"}
+	for _, key := range append([]string{"1"}, others...) {
+		if err := client.Do(ctx, client.B().Set().Key(key).Value("10108").Build()).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := a.MigrateLegacyKeys(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("migrate = %d, %v, want 1", n, err)
+	}
+	for _, key := range others {
+		if got, err := client.Do(ctx, client.B().Get().Key(key).Build()).ToString(); err != nil || got != "10108" {
+			t.Errorf("%s = %q, %v, want it left alone", key, got, err)
+		}
+	}
+}
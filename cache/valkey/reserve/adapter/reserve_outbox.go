@@ -0,0 +1,104 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/valkey-io/valkey-go"
+)
+
+// OutboxEntry is an event in the outbox of a user.
+type OutboxEntry struct {
+	Event ReserveEvent
+	// Payload is the JSON encoded event, which is also its member in the outbox.
+	Payload []byte
+}
+
+// EnableOutbox makes every reservation write that emits an event also record it in the
+// outbox of the user, in the same transaction as the write, so that an event is never
+// lost once its write has committed. The outbox shares the hash tag of the user key, so
+// this holds in cluster mode too. A publisher takes the events out with Outbox and
+// RemoveOutbox.
+func (a *ReserveValkey) EnableOutbox() {
+	a.outbox = true
+}
+
+// OutboxKey returns the key of the outbox of userId.
+func (a *ReserveValkey) OutboxKey(userId uint64) string {
+	return a.schema.Outbox(userId)
+}
+
+// outboxCmd returns the command recording a change in the outbox of userId, if the outbox
+// is enabled and emit is set.
+func (a *ReserveValkey) outboxCmd(b valkey.Builder, typ EventType, userId uint64, liveId uint64, emit bool) (valkey.Completed, bool, error) {
+	if !a.outbox || !emit {
+		return valkey.Completed{}, false, nil
+	}
+	now := time.Now()
+	payload, err := json.Marshal(ReserveEvent{
+		Id:        ulid.Make().String(),
+		Type:      typ,
+		UserId:    userId,
+		LiveId:    liveId,
+		Timestamp: now,
+	})
+	if err != nil {
+		return valkey.Completed{}, false, fmt.Errorf("outbox: marshal event: %w", err)
+	}
+	cmd := b.Zadd().Key(a.OutboxKey(userId)).ScoreMember().ScoreMember(float64(now.UnixMilli()), string(payload)).Build()
+	return cmd, true, nil
+}
+
+// Outbox returns the events of userId recorded before the given time, or all of them if it
+// is zero, oldest first.
+func (a *ReserveValkey) Outbox(ctx context.Context, userId uint64, before time.Time) ([]OutboxEntry, error) {
+	key := a.OutboxKey(userId)
+	max := "+inf"
+	if !before.IsZero() {
+		max = "(" + strconv.FormatInt(before.UnixMilli(), 10)
+	}
+	members, err := a.client.Do(ctx, a.client.B().Zrange().Key(key).Min("-inf").Max(max).Byscore().Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("outbox: zrange %s: %w", key, err)
+	}
+	entries := make([]OutboxEntry, 0, len(members))
+	for _, m := range members {
+		var event ReserveEvent
+		if err = json.Unmarshal([]byte(m), &event); err != nil {
+			return nil, fmt.Errorf("outbox: unmarshal event of %s: %w", key, err)
+		}
+		entries = append(entries, OutboxEntry{Event: event, Payload: []byte(m)})
+	}
+	return entries, nil
+}
+
+// RemoveOutbox removes entries returned by Outbox from the outbox of userId.
+func (a *ReserveValkey) RemoveOutbox(ctx context.Context, userId uint64, entries ...OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	members := make([]string, 0, len(entries))
+	for _, e := range entries {
+		members = append(members, string(e.Payload))
+	}
+	key := a.OutboxKey(userId)
+	if err := a.client.Do(ctx, a.client.B().Zrem().Key(key).Member(members...).Build()).Error(); err != nil {
+		return fmt.Errorf("outbox: zrem %s: %w", key, err)
+	}
+	return nil
+}
+
+// ScanOutboxes calls fn with every user that has events in their outbox.
+func (a *ReserveValkey) ScanOutboxes(ctx context.Context, count int64, fn func(userId uint64) error) error {
+	return scanNodes(ctx, a.client, a.schema.OutboxPattern(), "zset", count, func(key string) error {
+		userId, ok := a.schema.ParseOutbox(key)
+		if !ok {
+			return nil
+		}
+		return fn(userId)
+	})
+}
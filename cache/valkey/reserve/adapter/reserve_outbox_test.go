@@ -0,0 +1,117 @@
+package adapter_test
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestOutbox(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		ctx := context.Background()
+		s := valkeytest.Start(t)
+		client := valkeytest.NewClient(t, s)
+		schema := adapter.NewKeySchema("reserve:")
+		schema.HashTag = hashTag
+		a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+		a.EnableOutbox()
+
+		if _, err := a.CasZadd(ctx, 1, 10); err != nil {
+			t.Fatal(err)
+		}
+		// loading from storage does not emit events
+		if _, err := a.CacheZadd(ctx, 1, 11); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		if _, err := a.Zrem(ctx, 1, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Zadd(ctx, 2, 20); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := a.Outbox(ctx, 1, time.Time{})
+		if err != nil {
+			t.Fatalf("hash tag %v: outbox: %v", hashTag, err)
+		}
+		if len(entries) != 2 || entries[0].Event.Type != adapter.EventReserved || entries[1].Event.Type != adapter.EventCancelled {
+			t.Fatalf("hash tag %v: outbox = %+v", hashTag, entries)
+		}
+		if entries[0].Event.Id == "" || entries[0].Event.LiveId != 10 || entries[0].Event.UserId != 1 {
+			t.Errorf("hash tag %v: event = %+v", hashTag, entries[0].Event)
+		}
+
+		var users []uint64
+		err = a.ScanOutboxes(ctx, 10, func(userId uint64) error {
+			users = append(users, userId)
+			return nil
+		})
+		if err != nil || len(users) != 2 {
+			t.Errorf("hash tag %v: scan outboxes = %v, %v", hashTag, users, err)
+		}
+
+		if err = a.RemoveOutbox(ctx, 1, entries[0]); err != nil {
+			t.Fatal(err)
+		}
+		entries, err = a.Outbox(ctx, 1, time.Time{})
+		if err != nil || len(entries) != 1 || entries[0].Event.Type != adapter.EventCancelled {
+			t.Errorf("hash tag %v: outbox after remove = %+v, %v", hashTag, entries, err)
+		}
+		old, err := a.Outbox(ctx, 1, time.UnixMilli(0))
+		if err != nil || len(old) != 0 {
+			t.Errorf("hash tag %v: outbox before epoch = %+v, %v", hashTag, old, err)
+		}
+	}
+}
+
+func TestOutboxSkipsUnchangedReserves(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		ctx := context.Background()
+		s := valkeytest.Start(t)
+		client := valkeytest.NewClient(t, s)
+		schema := adapter.NewKeySchema("reserve:")
+		schema.HashTag = hashTag
+		a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+		a.EnableOutbox()
+		a.EnableEventStream("reserve-events", 0)
+
+		// only the first write of each pair changes a member
+		if _, err := a.CasZadd(ctx, 1, 10); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := a.CasZadd(ctx, 1, 10); err != nil || got != "10" {
+			t.Fatalf("hash tag %v: cas zadd again = %q, %v", hashTag, got, err)
+		}
+		for _, want := range []int64{1, 0} {
+			if n, err := a.Zadd(ctx, 1, 11); err != nil || n != want {
+				t.Fatalf("hash tag %v: zadd = %d, %v, want %d", hashTag, n, err, want)
+			}
+		}
+		for _, want := range []int64{1, 0} {
+			if n, err := a.Zrem(ctx, 1, 10); err != nil || n != want {
+				t.Fatalf("hash tag %v: zrem = %d, %v, want %d", hashTag, n, err, want)
+			}
+		}
+
+		entries, err := a.Outbox(ctx, 1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, string(e.Event.Type)+":"+strconv.FormatUint(e.Event.LiveId, 10))
+		}
+		if want := []string{"reserved:10", "reserved:11", "cancelled:10"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("hash tag %v: outbox = %v, want %v", hashTag, got, want)
+		}
+		if got, want := streamEvents(t, client, a), []string{"reserved:10", "reserved:11", "cancelled:10"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("hash tag %v: events = %v, want %v", hashTag, got, want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package adapter
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,89 +12,84 @@ import (
 	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
 )
 
+// ReserveTTL is how long the reservations of a user stay cached after they are created.
+const ReserveTTL = 600 * time.Second
+
 type ReserveValkey struct {
-	client    valkey.Client
-	retry     int8
-	keyPrefix string
+	client valkey.Client
+	retry  int8
+	schema *KeySchema
+
+	cacheTTL     time.Duration
+	cacheMeasure *cacheMeasure
+
+	stream       string
+	streamMaxLen int64
+	outbox       bool
 }
 
 func NewReserveValkey(client valkey.Client, keyPrefix string, retry int8) *ReserveValkey {
+	return NewReserveValkeyWithSchema(client, NewKeySchema(keyPrefix), retry)
+}
+
+func NewReserveValkeyWithSchema(client valkey.Client, schema *KeySchema, retry int8) *ReserveValkey {
 	return &ReserveValkey{
-		client:    client,
-		keyPrefix: strings.TrimSuffix(keyPrefix, ":") + ":",
-		retry:     retry,
+		client: client,
+		schema: schema,
+		retry:  retry,
 	}
 }
 
 func (a *ReserveValkey) Key(userId uint64) string {
-	return fmt.Sprintf("%s%d", a.keyPrefix, userId)
+	return a.schema.User(userId)
 }
 
-func (r *ReserveValkey) Get(ctx context.Context, userId uint64) (string, error) {
-	c, cancel := r.client.Dedicate()
-	defer cancel()
-
-	res := c.Do(ctx, c.B().Get().Key(fmt.Sprintf("%d", userId)).Build())
-	if res.Error() != nil {
-		if valkey.IsValkeyNil(res.Error()) {
-			return "", errorz.ErrResourceNotFound
-		}
-		return "", res.Error()
-	}
-	return res.ToString()
+// LiveKey returns the key of the reverse index holding users who reserved liveId.
+func (a *ReserveValkey) LiveKey(liveId uint64) string {
+	return a.schema.Live(liveId)
 }
 
-func (r *ReserveValkey) Set(ctx context.Context, userId uint64, liveId uint64) (string, error) {
-	c, cancel := r.client.Dedicate()
-	defer cancel()
-
-	var err error
-
-	key := fmt.Sprintf("%d", userId)
-	if err = c.Do(ctx, c.B().Watch().Key(key).Build()).Error(); err != nil {
-		return "", err
-	}
-
-	res := c.Do(ctx, c.B().Get().Key(key).Build())
-	if res.Error() != nil {
-		if !valkey.IsValkeyNil(res.Error()) {
-			return "", res.Error()
-		}
-	}
+// Schema returns the KeySchema used to build keys.
+func (a *ReserveValkey) Schema() *KeySchema {
+	return a.schema
+}
 
-	lives := ""
-	lives, err = res.ToString()
+// Get returns the lives reserved by userId, or errorz.ErrResourceNotFound if the key does not exist.
+func (a *ReserveValkey) Get(ctx context.Context, userId uint64) (string, error) {
+	res, err := a.Zrange(ctx, userId)
 	if err != nil {
 		return "", err
 	}
-	if lives != "" {
-		lives = fmt.Sprintf("%s,%d", lives, liveId)
-	} else {
-		lives = fmt.Sprintf("%d", liveId)
+	if res != "" {
+		return res, nil
 	}
-	res2 := c.DoMulti(
-		ctx,
-		c.B().Multi().Build(),
-		c.B().Set().Key(key).Value(lives).Build(),
-		c.B().Exec().Build(),
-	)
-	for _, r := range res2 {
-		if r.Error() != nil {
-			return "", r.Error()
-		}
+	if err = a.Exists(ctx, userId); err != nil {
+		return "", err
 	}
+	return res, nil
+}
 
-	return lives, nil
+// Set adds liveId to the reservations of userId and returns all reserved lives.
+func (a *ReserveValkey) Set(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	return a.CasZadd(ctx, userId, liveId)
 }
 
 func (a *ReserveValkey) Zrange(ctx context.Context, userId uint64) (string, error) {
-	c, cancel := a.client.Dedicate()
-	defer cancel()
-
 	key := a.Key(userId)
 
-	// returns empty slice if the key does not exist
-	res, err := c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
+	var res []string
+	var err error
+	if a.cacheEnabled() {
+		r := a.client.DoCache(ctx, a.client.B().Zrange().Key(key).Min("0").Max("-1").Cache(), a.cacheTTL)
+		a.cacheMeasure.observe(r)
+		res, err = r.AsStrSlice()
+	} else {
+		c, cancel := a.client.Dedicate()
+		defer cancel()
+
+		// returns empty slice if the key does not exist
+		res, err = c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
+	}
 	if err != nil {
 		if valkey.IsValkeyNil(err) {
 			return "", errorz.ErrResourceNotFound
@@ -108,46 +105,147 @@ func (a *ReserveValkey) Zrange(ctx context.Context, userId uint64) (string, erro
 	return strings.Join(res, ","), nil
 }
 
+// Zadd adds liveId to the user's reservations and the user to the live's reverse index, and
+// returns the number of lives added. Adding a reserved live changes nothing, so it records
+// no outbox entry or event.
 func (a *ReserveValkey) Zadd(ctx context.Context, userId uint64, liveId uint64) (int64, error) {
+	return a.changeWithRetry(ctx, EventReserved, userId, liveId)
+}
+
+// Zrem removes liveId from the user's reservations and the user from the live's reverse index,
+// and returns the number of lives removed. Removing a live that is not reserved changes
+// nothing, so it records no outbox entry or event.
+func (a *ReserveValkey) Zrem(ctx context.Context, userId uint64, liveId uint64) (int64, error) {
+	return a.changeWithRetry(ctx, EventCancelled, userId, liveId)
+}
+
+func (a *ReserveValkey) changeWithRetry(ctx context.Context, typ EventType, userId uint64, liveId uint64) (int64, error) {
+	if a.retry == 0 {
+		return a.change(ctx, typ, userId, liveId)
+	}
+
+	var n int64
+	var err error
+	for i := int8(0); i < a.retry; i++ {
+		n, err = a.change(ctx, typ, userId, liveId)
+		if !errors.Is(err, errorz.ErrNeedRetry) {
+			return n, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	op := "zadd"
+	if typ == EventCancelled {
+		op = "zrem"
+	}
+	return 0, fmt.Errorf("%s: retry limit reached: %w", op, err)
+}
+
+// change reserves liveId for a reserved typ and cancels it otherwise. It WATCHes the user key
+// while it checks whether the live is reserved, so the outbox entry and the change are only
+// queued along with a ZADD or ZREM that changes a member, and the transaction aborts with
+// ErrNeedRetry when the reservations changed in the meantime.
+func (a *ReserveValkey) change(ctx context.Context, typ EventType, userId uint64, liveId uint64) (int64, error) {
 	c, cancel := a.client.Dedicate()
 	defer cancel()
 
 	key := a.Key(userId)
-	res, err := c.Do(ctx, c.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(liveId), fmt.Sprintf("%d", liveId)).Build()).AsInt64()
+	member := strconv.FormatUint(liveId, 10)
+	if err := c.Do(ctx, c.B().Watch().Key(key).Build()).Error(); err != nil {
+		return 0, err
+	}
+	err := c.Do(ctx, c.B().Zscore().Key(key).Member(member).Build()).Error()
+	if err != nil && !valkey.IsValkeyNil(err) {
+		c.Do(ctx, c.B().Unwatch().Build())
+		return 0, err
+	}
+	if reserved := err == nil; reserved == (typ == EventReserved) {
+		c.Do(ctx, c.B().Unwatch().Build())
+		return 0, nil
+	}
+
+	cmds := valkey.Commands{c.B().Multi().Build()}
+	if typ == EventReserved {
+		cmds = append(cmds, c.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(liveId), member).Build())
+	} else {
+		cmds = append(cmds, c.B().Zrem().Key(key).Member(member).Build())
+	}
+	outbox, ok, err := a.outboxCmd(c.B(), typ, userId, liveId, true)
 	if err != nil {
+		c.Do(ctx, c.B().Unwatch().Build())
 		return 0, err
 	}
+	if ok {
+		cmds = append(cmds, outbox)
+	}
+	changes, err := a.txChangeCmds(c.B(), typ, userId, liveId, true)
+	if err != nil {
+		c.Do(ctx, c.B().Unwatch().Build())
+		return 0, err
+	}
+	cmds = append(cmds, changes...)
+	cmds = append(cmds, c.B().Exec().Build())
 
-	return res, nil
+	res := c.DoMulti(ctx, cmds...)
+	for _, r := range res {
+		if r.Error() != nil {
+			return 0, r.Error()
+		}
+	}
+
+	n, err := execInt64(res[len(res)-1], 0)
+	if err != nil {
+		return 0, err
+	}
+	a.applyCommitted(ctx, userId)
+	return n, nil
 }
 
+// CasZadd adds liveId to the user's reservations and returns all reserved lives.
 func (a *ReserveValkey) CasZadd(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	return a.casZaddWithRetry(ctx, userId, liveId, true)
+}
+
+// CacheZadd is CasZadd for reservations loaded from the backing store.
+// It updates the reverse index but does not emit an event.
+func (a *ReserveValkey) CacheZadd(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	return a.casZaddWithRetry(ctx, userId, liveId, false)
+}
+
+func (a *ReserveValkey) casZaddWithRetry(ctx context.Context, userId uint64, liveId uint64, emit bool) (string, error) {
 	if a.retry == 0 {
-		return a.casZadd(ctx, userId, liveId)
+		return a.casZadd(ctx, userId, liveId, emit)
 	}
 
 	var res string
 	var err error
 	for i := int8(0); i < a.retry; i++ {
-		res, err = a.casZadd(ctx, userId, liveId)
+		res, err = a.casZadd(ctx, userId, liveId, emit)
 		if err == nil {
 			return res, nil
 		}
 		time.Sleep(50 * time.Millisecond)
 	}
 
-	return "", fmt.Errorf("set reserve: retry limit reached: %v", err)
+	return "", fmt.Errorf("set reserve: retry limit reached: %w", err)
 }
 
 func (a *ReserveValkey) Exists(ctx context.Context, userId uint64) error {
-
-	c, cancel := a.client.Dedicate()
-	defer cancel()
-
 	key := a.Key(userId)
 
-	// returns empty slice if the key does not exist
-	res, err := c.Do(ctx, c.B().Exists().Key(key).Build()).AsInt64()
+	var res int64
+	var err error
+	if a.cacheEnabled() {
+		// EXISTS is not cacheable, but a sorted set is deleted once its last member is removed,
+		// so a zero ZCARD means the key does not exist.
+		r := a.client.DoCache(ctx, a.client.B().Zcard().Key(key).Cache(), a.cacheTTL)
+		a.cacheMeasure.observe(r)
+		res, err = r.AsInt64()
+	} else {
+		c, cancel := a.client.Dedicate()
+		defer cancel()
+
+		res, err = c.Do(ctx, c.B().Exists().Key(key).Build()).AsInt64()
+	}
 	if err != nil {
 		if valkey.IsValkeyNil(err) {
 			return errorz.ErrResourceNotFound
@@ -162,7 +260,7 @@ func (a *ReserveValkey) Exists(ctx context.Context, userId uint64) error {
 	return nil
 }
 
-func (a *ReserveValkey) casZadd(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+func (a *ReserveValkey) casZadd(ctx context.Context, userId uint64, liveId uint64, emit bool) (string, error) {
 	c, cancel := a.client.Dedicate()
 	defer cancel()
 
@@ -173,20 +271,41 @@ func (a *ReserveValkey) casZadd(ctx context.Context, userId uint64, liveId uint6
 		return "", err
 	}
 
-	err = c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).Error()
+	reserves, err := c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
 	if err != nil {
 		if !valkey.IsValkeyNil(err) {
 			return "", err
 		}
 	}
+	member := strconv.FormatUint(liveId, 10)
+	for _, r := range reserves {
+		if r == member {
+			// already reserved, so there is no change to record
+			c.Do(ctx, c.B().Unwatch().Build())
+			return strings.Join(reserves, ","), nil
+		}
+	}
 
-	res2 := c.DoMulti(
-		ctx,
+	cmds := valkey.Commands{
 		c.B().Multi().Build(),
-		c.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(liveId), fmt.Sprintf("%d", liveId)).Build(),
-		c.B().Expire().Key(key).Seconds(600).Nx().Build(),
-		c.B().Exec().Build(),
-	)
+		c.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(liveId), member).Build(),
+		c.B().Expire().Key(key).Seconds(int64(ReserveTTL / time.Second)).Nx().Build(),
+	}
+	outbox, ok, err := a.outboxCmd(c.B(), EventReserved, userId, liveId, emit)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		cmds = append(cmds, outbox)
+	}
+	changes, err := a.txChangeCmds(c.B(), EventReserved, userId, liveId, emit)
+	if err != nil {
+		return "", err
+	}
+	cmds = append(cmds, changes...)
+	cmds = append(cmds, c.B().Exec().Build())
+
+	res2 := c.DoMulti(ctx, cmds...)
 	for i, r := range res2 {
 		if valkey.IsValkeyNil(r.Error()) {
 			// "valkey nil message" error is returned when the value is beging modified by another client.
@@ -195,9 +314,10 @@ func (a *ReserveValkey) casZadd(ctx context.Context, userId uint64, liveId uint6
 		}
 
 		if r.Error() != nil {
-			return "", fmt.Errorf("zadd(resInd=%d): %v", i, r.Error())
+			return "", fmt.Errorf("zadd(resInd=%d): %w", i, r.Error())
 		}
 	}
+	a.applyCommitted(ctx, userId)
 
 	existingReserves, err := c.Do(ctx, c.B().Zrange().Key(key).Min("0").Max("-1").Build()).AsStrSlice()
 	if err != nil {
@@ -206,3 +326,18 @@ func (a *ReserveValkey) casZadd(ctx context.Context, userId uint64, liveId uint6
 
 	return strings.Join(existingReserves, ","), nil
 }
+
+// execInt64 returns the integer reply at index i of an EXEC result.
+func execInt64(exec valkey.ValkeyResult, i int) (int64, error) {
+	replies, err := exec.ToArray()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return 0, errorz.ErrNeedRetry
+		}
+		return 0, err
+	}
+	if i >= len(replies) {
+		return 0, fmt.Errorf("exec: reply index %d out of range", i)
+	}
+	return replies[i].AsInt64()
+}
@@ -0,0 +1,114 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestReserveValkey(t *testing.T) {
+	for _, hashTag := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hashTag=%v", hashTag), func(t *testing.T) {
+			ctx := context.Background()
+			client := valkeytest.NewClient(t, valkeytest.Start(t))
+			schema := adapter.NewKeySchema("reserve:")
+			schema.HashTag = hashTag
+			a := adapter.NewReserveValkeyWithSchema(client, schema, 0)
+
+			if _, err := a.Get(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+				t.Fatalf("get of a missing user: got %v, want ErrResourceNotFound", err)
+			}
+
+			if got, err := a.CasZadd(ctx, 1, 11); err != nil || got != "11" {
+				t.Fatalf("cas zadd = %q, %v, want 11", got, err)
+			}
+			if n, err := a.Zadd(ctx, 1, 10); err != nil || n != 1 {
+				t.Fatalf("zadd = %d, %v, want 1", n, err)
+			}
+			if n, err := a.Zadd(ctx, 1, 10); err != nil || n != 0 {
+				t.Fatalf("zadd of a reserved live = %d, %v, want 0", n, err)
+			}
+			if got, err := a.Get(ctx, 1); err != nil || got != "10,11" {
+				t.Fatalf("get = %q, %v, want 10,11", got, err)
+			}
+			if ttl, err := client.Do(ctx, client.B().Ttl().Key(a.Key(1)).Build()).AsInt64(); err != nil || ttl <= 0 {
+				t.Errorf("ttl = %d, %v, want the ReserveTTL", ttl, err)
+			}
+			if got, want := liveUsers(t, a, 10), []uint64{1}; !reflect.DeepEqual(got, want) {
+				t.Errorf("live users of 10 = %v, want %v", got, want)
+			}
+
+			if n, err := a.Zrem(ctx, 1, 10); err != nil || n != 1 {
+				t.Fatalf("zrem = %d, %v, want 1", n, err)
+			}
+			if got := liveUsers(t, a, 10); len(got) != 0 {
+				t.Errorf("live users of 10 after zrem = %v", got)
+			}
+			if n, err := a.Zrem(ctx, 1, 11); err != nil || n != 1 {
+				t.Fatalf("zrem = %d, %v, want 1", n, err)
+			}
+			// a sorted set is deleted with its last member
+			if err := a.Exists(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+				t.Errorf("exists after removing every live: got %v, want ErrResourceNotFound", err)
+			}
+		})
+	}
+}
+
+func TestCasZaddConcurrent(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	a := adapter.NewReserveValkey(client, "reserve:", 100)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(liveId uint64) {
+			defer wg.Done()
+			if _, err := a.CasZadd(ctx, 1, liveId); err != nil {
+				errs <- err
+			}
+		}(uint64(100 + i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("cas zadd: %v", err)
+	}
+
+	got, err := a.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	lives := strings.Split(got, ",")
+	if len(lives) != 20 {
+		t.Errorf("got %d lives, want 20: %v", len(lives), lives)
+	}
+}
+
+func TestZaddFailure(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+
+	s.FailCommand("EXEC", "ERR injected", 1)
+	if _, err := a.Zadd(ctx, 1, 10); err == nil {
+		t.Fatal("zadd succeeded with a failed EXEC")
+	}
+	if _, err := a.Get(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+		t.Errorf("get after a failed zadd: got %v, want ErrResourceNotFound", err)
+	}
+	if got := liveUsers(t, a, 10); len(got) != 0 {
+		t.Errorf("live users after a failed zadd = %v", got)
+	}
+}
@@ -0,0 +1,303 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+)
+
+var ErrOutboxClosed = errors.New("outbox closed")
+
+// KafkaOutbox publishes reservation events to Kafka with at-least-once delivery.
+//
+// Events are recorded in the outbox of their user by the reservation write itself, see
+// adapter.ReserveValkey.EnableOutbox. Flush moves them into a hash of payloads
+// (`<key>:events`) and a sorted set of pending ids scored by their last send time
+// (`<key>:pending`), and then hands them to the async producer. An event is removed from
+// valkey once Kafka acknowledges it. Events that were not acknowledged within
+// redeliverAfter, because the producer failed or the process restarted, are sent again,
+// and events left in an outbox by a failed Flush are moved on the same schedule, so
+// consumers must tolerate duplicates.
+type KafkaOutbox struct {
+	client         valkey.Client
+	source         *adapter.ReserveValkey
+	producer       sarama.AsyncProducer
+	topic          string
+	eventsKey      string
+	pendingKey     string
+	redeliverAfter time.Duration
+
+	cancel      context.CancelFunc
+	wg          *sync.WaitGroup
+	redeliverWg *sync.WaitGroup
+	// mu guards closed, and is held for reading while events are handed to the producer
+	// so that Close does not close it in the meantime.
+	mu     sync.RWMutex
+	closed bool
+
+	outboxMeasure *outboxMeasure
+}
+
+type outboxMeasure struct {
+	Sent        atomic.Int64
+	Acked       atomic.Int64
+	Failed      atomic.Int64
+	Redelivered atomic.Int64
+}
+
+// OutboxStats is a snapshot of the deliveries of the outbox.
+type OutboxStats struct {
+	Sent        int64 `json:"sent"`
+	Acked       int64 `json:"acked"`
+	Failed      int64 `json:"failed"`
+	Redelivered int64 `json:"redelivered"`
+}
+
+// NewKafkaOutbox creates an outbox delivering the events recorded by source to topic,
+// with a producer of its own connected to addrs. config, such as one built by
+// producer.BuildConfig, must set Producer.Return.Successes and Producer.Return.Errors,
+// as events are only acknowledged on success.
+func NewKafkaOutbox(ctx context.Context, client valkey.Client, source *adapter.ReserveValkey, addrs []string, config *sarama.Config, topic string, key string, redeliverAfter time.Duration) (*KafkaOutbox, error) {
+	if !config.Producer.Return.Successes || !config.Producer.Return.Errors {
+		return nil, fmt.Errorf("outbox: producer must return successes and errors")
+	}
+	if redeliverAfter < time.Millisecond {
+		return nil, fmt.Errorf("outbox: redeliverAfter must be at least 1ms, got %v", redeliverAfter)
+	}
+	producer, err := sarama.NewAsyncProducer(addrs, config)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: create producer: %v", err)
+	}
+	return newKafkaOutbox(ctx, client, source, producer, topic, key, redeliverAfter), nil
+}
+
+func newKafkaOutbox(ctx context.Context, client valkey.Client, source *adapter.ReserveValkey, producer sarama.AsyncProducer, topic string, key string, redeliverAfter time.Duration) *KafkaOutbox {
+	ctx, cancel := context.WithCancel(ctx)
+	o := &KafkaOutbox{
+		client:         client,
+		source:         source,
+		producer:       producer,
+		topic:          topic,
+		eventsKey:      key + ":events",
+		pendingKey:     key + ":pending",
+		redeliverAfter: redeliverAfter,
+
+		cancel:      cancel,
+		wg:          &sync.WaitGroup{},
+		redeliverWg: &sync.WaitGroup{},
+
+		outboxMeasure: &outboxMeasure{},
+	}
+
+	o.wg.Add(2)
+	go o.readSuccesses()
+	go o.readErrors()
+	o.redeliverWg.Add(1)
+	go o.redeliver(ctx)
+
+	return o
+}
+
+// Flush moves the events in the outbox of userId to the pending events and sends them.
+func (o *KafkaOutbox) Flush(ctx context.Context, userId uint64) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		return ErrOutboxClosed
+	}
+	_, err := o.flush(ctx, userId, time.Time{})
+	return err
+}
+
+// flush moves the events of userId recorded before the given time, or all of them if it is
+// zero, and returns how many were moved.
+func (o *KafkaOutbox) flush(ctx context.Context, userId uint64, before time.Time) (int, error) {
+	entries, err := o.source.Outbox(ctx, userId, before)
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range entries {
+		// the id keeps an event moved twice, by Flush and by redeliver, pending once
+		res := o.client.DoMulti(ctx,
+			o.client.B().Hset().Key(o.eventsKey).FieldValue().FieldValue(e.Event.Id, string(e.Payload)).Build(),
+			o.client.B().Zadd().Key(o.pendingKey).Nx().ScoreMember().ScoreMember(float64(time.Now().UnixMilli()), e.Event.Id).Build(),
+		)
+		for _, r := range res {
+			if r.Error() != nil {
+				return i, fmt.Errorf("outbox: persist event %s: %v", e.Event.Id, r.Error())
+			}
+		}
+		if err = o.source.RemoveOutbox(ctx, userId, e); err != nil {
+			return i, err
+		}
+		if err = o.send(ctx, e.Event.Id, e.Event.UserId, e.Payload); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+func (o *KafkaOutbox) send(ctx context.Context, id string, userId uint64, payload []byte) error {
+	msg := &sarama.ProducerMessage{
+		Topic:    o.topic,
+		Key:      sarama.StringEncoder(strconv.FormatUint(userId, 10)),
+		Value:    sarama.ByteEncoder(payload),
+		Metadata: id,
+	}
+	select {
+	case o.producer.Input() <- msg:
+		o.outboxMeasure.Sent.Add(1)
+		return nil
+	case <-ctx.Done():
+		// the event is persisted and will be redelivered
+		return nil
+	}
+}
+
+func (o *KafkaOutbox) ack(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res := o.client.DoMulti(ctx,
+		o.client.B().Zrem().Key(o.pendingKey).Member(id).Build(),
+		o.client.B().Hdel().Key(o.eventsKey).Field(id).Build(),
+	)
+	for _, r := range res {
+		if r.Error() != nil {
+			// the event stays pending and is delivered again
+			log.Printf("outbox: ack %s: %v\n", id, r.Error())
+			return
+		}
+	}
+	o.outboxMeasure.Acked.Add(1)
+}
+
+func (o *KafkaOutbox) readSuccesses() {
+	defer o.wg.Done()
+	for msg := range o.producer.Successes() {
+		if id, ok := msg.Metadata.(string); ok {
+			o.ack(id)
+		}
+	}
+}
+
+func (o *KafkaOutbox) readErrors() {
+	defer o.wg.Done()
+	for pe := range o.producer.Errors() {
+		o.outboxMeasure.Failed.Add(1)
+		log.Printf("outbox: produce: %v\n", pe.Error())
+	}
+}
+
+func (o *KafkaOutbox) redeliver(ctx context.Context) {
+	defer o.redeliverWg.Done()
+
+	ticker := time.NewTicker(o.redeliverAfter / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.flushLeftovers(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("outbox: flush leftovers: %v\n", err)
+			}
+			if err := o.redeliverPending(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("outbox: redeliver: %v\n", err)
+			}
+		}
+	}
+}
+
+// flushLeftovers moves the events left in the outboxes of users for redeliverAfter, which
+// happens when Flush fails or the process stops after a write has committed.
+func (o *KafkaOutbox) flushLeftovers(ctx context.Context) error {
+	before := time.Now().Add(-o.redeliverAfter)
+	return o.source.ScanOutboxes(ctx, 100, func(userId uint64) error {
+		n, err := o.flush(ctx, userId, before)
+		o.outboxMeasure.Redelivered.Add(int64(n))
+		return err
+	})
+}
+
+func (o *KafkaOutbox) redeliverPending(ctx context.Context) error {
+	deadline := time.Now().Add(-o.redeliverAfter).UnixMilli()
+	ids, err := o.client.Do(ctx, o.client.B().Zrange().Key(o.pendingKey).Min("-inf").Max(strconv.FormatInt(deadline, 10)).
+		Byscore().Limit(0, 100).Build()).AsStrSlice()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		payload, err := o.client.Do(ctx, o.client.B().Hget().Key(o.eventsKey).Field(id).Build()).AsBytes()
+		if err != nil {
+			if valkey.IsValkeyNil(err) {
+				// acknowledged in the meantime
+				o.client.Do(ctx, o.client.B().Zrem().Key(o.pendingKey).Member(id).Build())
+				continue
+			}
+			return err
+		}
+		var event adapter.ReserveEvent
+		if err = json.Unmarshal(payload, &event); err != nil {
+			return fmt.Errorf("unmarshal event %s: %v", id, err)
+		}
+
+		// postpone the next attempt before sending, only if it is still pending
+		err = o.client.Do(ctx, o.client.B().Zadd().Key(o.pendingKey).Xx().ScoreMember().
+			ScoreMember(float64(time.Now().UnixMilli()), id).Build()).Error()
+		if err != nil {
+			return err
+		}
+		if err = o.send(ctx, id, event.UserId, payload); err != nil {
+			return err
+		}
+		o.outboxMeasure.Redelivered.Add(1)
+	}
+	return nil
+}
+
+// Pending returns the number of events not yet acknowledged by Kafka.
+func (o *KafkaOutbox) Pending(ctx context.Context) (int64, error) {
+	return o.client.Do(ctx, o.client.B().Zcard().Key(o.pendingKey).Build()).AsInt64()
+}
+
+// Stats returns the events sent to the producer, acknowledged, failed and redelivered so far.
+func (o *KafkaOutbox) Stats() OutboxStats {
+	return OutboxStats{
+		Sent:        o.outboxMeasure.Sent.Load(),
+		Acked:       o.outboxMeasure.Acked.Load(),
+		Failed:      o.outboxMeasure.Failed.Load(),
+		Redelivered: o.outboxMeasure.Redelivered.Load(),
+	}
+}
+
+// Close stops redelivery, flushes the producer and waits for outstanding acknowledgements.
+// Events that are still pending are delivered by the next outbox using the same key.
+func (o *KafkaOutbox) Close() error {
+	// wait for Flush calls handing events to the producer
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	o.cancel()
+	o.redeliverWg.Wait()
+	err := o.producer.Close()
+	o.wg.Wait()
+	log.Printf("outbox: %+v\n", o.Stats())
+	return err
+}
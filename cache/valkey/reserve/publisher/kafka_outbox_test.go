@@ -0,0 +1,135 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+// anyReporter lets a mock producer take any number of messages.
+type anyReporter struct{}
+
+func (anyReporter) Errorf(string, ...any) {}
+
+func producerConfig() *sarama.Config {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return config
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKafkaOutbox(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+	a.EnableOutbox()
+
+	producer := mocks.NewAsyncProducer(t, producerConfig())
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	o := newKafkaOutbox(ctx, client, a, producer, "reserve-events", "outbox:reserve", 100*time.Millisecond)
+
+	// flushed right after the write
+	if _, err := a.CasZadd(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Flush(ctx, 1); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// left behind, as if the process stopped before Flush
+	if _, err := a.Zadd(ctx, 2, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "both events to be acknowledged", func() bool {
+		return o.Stats().Acked == 2
+	})
+	if n, err := o.Pending(ctx); err != nil || n != 0 {
+		t.Errorf("pending = %d, %v, want 0", n, err)
+	}
+	for _, userId := range []uint64{1, 2} {
+		if entries, err := a.Outbox(ctx, userId, time.Time{}); err != nil || len(entries) != 0 {
+			t.Errorf("outbox of %d = %+v, %v, want empty", userId, entries, err)
+		}
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := o.Flush(ctx, 1); !errors.Is(err, ErrOutboxClosed) {
+		t.Errorf("flush after close = %v, want ErrOutboxClosed", err)
+	}
+}
+
+func TestNewKafkaOutbox(t *testing.T) {
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+
+	// nothing would ever be acknowledged
+	config := sarama.NewConfig()
+	if _, err := NewKafkaOutbox(context.Background(), client, a, []string{"127.0.0.1:0"}, config, "reserve-events", "outbox:reserve", time.Minute); err == nil {
+		t.Error("want an error without Return.Successes")
+	}
+	config.Producer.Return.Successes = true
+	if _, err := NewKafkaOutbox(context.Background(), client, a, []string{"127.0.0.1:0"}, config, "reserve-events", "outbox:reserve", 0); err == nil {
+		t.Error("want an error without redeliverAfter")
+	}
+}
+
+func TestKafkaOutboxCloseWhileFlushing(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+	a.EnableOutbox()
+
+	const writes = 50
+	producer := mocks.NewAsyncProducer(anyReporter{}, producerConfig())
+	for i := 0; i < writes; i++ {
+		producer.ExpectInputAndSucceed()
+	}
+	o := newKafkaOutbox(ctx, client, a, producer, "reserve-events", "outbox:reserve", time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writes; i++ {
+		wg.Add(1)
+		go func(userId uint64) {
+			defer wg.Done()
+			if _, err := a.Zadd(ctx, userId, 10); err != nil {
+				t.Error(err)
+				return
+			}
+			// sends on the input of a closed producer would panic
+			err := o.Flush(ctx, userId)
+			if err != nil && !errors.Is(err, ErrOutboxClosed) {
+				t.Error(err)
+			}
+		}(uint64(i))
+	}
+	waitFor(t, "the first event to be sent", func() bool {
+		return o.Stats().Sent > 0
+	})
+	if err := o.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	wg.Wait()
+}
@@ -69,7 +69,7 @@ func (u *ApppushReserve) load(ctx context.Context, userId uint64) (string, error
 	// load from storage
 	fmt.Println("load from storage")
 
-	lockKey := fmt.Sprintf("reserve:%d", userId)
+	lockKey := u.a.Key(userId)
 	err := u.l.Lock(ctx, lockKey, "get-reserve-lock")
 	if err != nil {
 		v, err := u.a.Zrange(ctx, userId)
@@ -89,7 +89,7 @@ func (u *ApppushReserve) load(ctx context.Context, userId uint64) (string, error
 	// read from storage
 	var someLiveId uint64 = 90203
 	// cache the result from storage
-	res, err := u.a.CasZadd(ctx, userId, someLiveId)
+	res, err := u.a.CacheZadd(ctx, userId, someLiveId)
 	if err != nil {
 		return "", err
 	}
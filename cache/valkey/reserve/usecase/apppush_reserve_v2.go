@@ -4,18 +4,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/eapache/go-resiliency/breaker"
 	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
 	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
 	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/scheduler"
 )
 
 type ApppushReserveV2 struct {
 	loadLock   *distlock.DistLockValkeyV3
 	setLock    *distlock.DistLockValkeyV3
 	a          *adapter.ReserveValkey
-	setCnt     int64
-	setFailCnt int64
+	publisher  ReserveEventPublisher
+	freshTTL   time.Duration
+	refreshing sync.Map
+	breaker    *breaker.Breaker
+	brkMeasure *breakerMeasure
+	setCnt     atomic.Int64
+	setFailCnt atomic.Int64
+
+	reminders    *scheduler.Scheduler
+	remindBefore time.Duration
+	liveStartAt  LiveStartFunc
 }
 
 func NewApppushReserveV2(loadLock, setLock *distlock.DistLockValkeyV3, a *adapter.ReserveValkey) *ApppushReserveV2 {
@@ -26,7 +40,23 @@ func NewApppushReserveV2(loadLock, setLock *distlock.DistLockValkeyV3, a *adapte
 	}
 }
 
+// WithPublisher makes SetReserve and CancelReserve record a ReserveEvent in the outbox of
+// the user with each write, and hand it to p once the write has committed.
+func (u *ApppushReserveV2) WithPublisher(p ReserveEventPublisher) *ApppushReserveV2 {
+	u.publisher = p
+	u.a.EnableOutbox()
+	return u
+}
+
 func (u *ApppushReserveV2) GetReserve(ctx context.Context, userId uint64) (string, error) {
+	if u.staleWhileRevalidate() || u.breaker != nil {
+		res, err := u.Lookup(ctx, userId)
+		return res.Reserves, err
+	}
+	return u.getReserve(ctx, userId)
+}
+
+func (u *ApppushReserveV2) getReserve(ctx context.Context, userId uint64) (string, error) {
 	r, err := u.a.Zrange(ctx, userId)
 	if err != nil {
 		if !errors.Is(err, errorz.ErrResourceNotFound) {
@@ -55,6 +85,16 @@ func (u *ApppushReserveV2) GetReserve(ctx context.Context, userId uint64) (strin
 }
 
 func (u *ApppushReserveV2) SetReserve(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	var res string
+	err := u.guard(func() error {
+		var err error
+		res, err = u.setReserve(ctx, userId, liveId)
+		return err
+	})
+	return res, err
+}
+
+func (u *ApppushReserveV2) setReserve(ctx context.Context, userId uint64, liveId uint64) (string, error) {
 	var err error
 	err = u.a.Exists(ctx, userId)
 	if errors.Is(err, errorz.ErrResourceNotFound) {
@@ -63,10 +103,10 @@ func (u *ApppushReserveV2) SetReserve(ctx context.Context, userId uint64, liveId
 			return "", err
 		}
 	} else if err != nil {
-		return "", fmt.Errorf("set exists reserve: %v", err)
+		return "", fmt.Errorf("set exists reserve: %w", err)
 	}
 
-	lockKey := fmt.Sprintf("reserve:%d", userId)
+	lockKey := u.a.Key(userId)
 	err = u.setLock.Lock(ctx, lockKey, "set-reserve-lock")
 	if err != nil {
 		return "", err
@@ -75,17 +115,65 @@ func (u *ApppushReserveV2) SetReserve(ctx context.Context, userId uint64, liveId
 
 	_, err = u.a.Zadd(ctx, userId, liveId)
 	if err != nil {
-		u.setFailCnt++
+		u.setFailCnt.Add(1)
 		return "", err
 	}
-	u.setCnt++
+	u.setCnt.Add(1)
 	// fmt.Printf("applied: %v\n", applied)
-	return u.GetReserve(ctx, userId)
+	// the write has committed, so failing to hand it on must not fail the request
+	u.publish(ctx, userId)
+	if err = u.remind(ctx, adapter.EventReserved, userId, liveId); err != nil {
+		fmt.Printf("err: %v\n", err)
+	}
+	res, err := u.lookup(ctx, userId)
+	return res.Reserves, err
+}
+
+func (u *ApppushReserveV2) CancelReserve(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	var res string
+	err := u.guard(func() error {
+		var err error
+		res, err = u.cancelReserve(ctx, userId, liveId)
+		return err
+	})
+	return res, err
+}
+
+func (u *ApppushReserveV2) cancelReserve(ctx context.Context, userId uint64, liveId uint64) (string, error) {
+	var err error
+	err = u.a.Exists(ctx, userId)
+	if errors.Is(err, errorz.ErrResourceNotFound) {
+		_, err = u.load(ctx, userId)
+		if err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("cancel exists reserve: %w", err)
+	}
+
+	lockKey := u.a.Key(userId)
+	err = u.setLock.Lock(ctx, lockKey, "cancel-reserve-lock")
+	if err != nil {
+		return "", err
+	}
+	defer u.setLock.Unlock(ctx, lockKey, "cancel-reserve-unlock")
+
+	_, err = u.a.Zrem(ctx, userId, liveId)
+	if err != nil {
+		return "", err
+	}
+	// the write has committed, so failing to hand it on must not fail the request
+	u.publish(ctx, userId)
+	if err = u.remind(ctx, adapter.EventCancelled, userId, liveId); err != nil {
+		fmt.Printf("err: %v\n", err)
+	}
+	res, err := u.lookup(ctx, userId)
+	return res.Reserves, err
 }
 
 func (u *ApppushReserveV2) load(ctx context.Context, userId uint64) (string, error) {
 
-	lockKey := fmt.Sprintf("reserve:%d", userId)
+	lockKey := u.a.Key(userId)
 	err := u.loadLock.Lock(ctx, lockKey, "get-reserve-lock")
 	if err != nil {
 		v, err := u.a.Zrange(ctx, userId)
@@ -98,25 +186,66 @@ func (u *ApppushReserveV2) load(ctx context.Context, userId uint64) (string, err
 	}
 	defer u.loadLock.Unlock(ctx, lockKey, "get-reserve-unlock")
 
+	return u.loadFromStorage(ctx, userId)
+}
+
+// loadFromStorage caches the reservations of userId read from storage. It must be called
+// with the load lock held.
+func (u *ApppushReserveV2) loadFromStorage(ctx context.Context, userId uint64) (string, error) {
 	// load from storage
 	fmt.Println("load from storage")
+	loadedAt := time.Now()
+
+	lives, err := u.readStorage(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	// cache the result from storage
+	var res string
+	for _, liveId := range lives {
+		res, err = u.a.CacheZadd(ctx, userId, liveId)
+		if err != nil {
+			return "", err
+		}
+	}
+	if u.staleWhileRevalidate() {
+		if err = u.a.MarkLoaded(ctx, userId, loadedAt); err != nil {
+			return "", err
+		}
+	}
+	return res, nil
+}
 
+// StoredLives returns the lives reserved by userId in the backing store, such as for
+// ReserveValkey.ReconcileLiveIndex.
+func (u *ApppushReserveV2) StoredLives(ctx context.Context, userId uint64) ([]uint64, error) {
+	return u.readStorage(ctx, userId)
+}
+
+// readStorage returns the lives reserved by userId in the backing store.
+func (u *ApppushReserveV2) readStorage(ctx context.Context, userId uint64) ([]uint64, error) {
 	// read from storage
-	// return "", nil if no data found from storage
-	// return "", nil
+	// return nil, nil if no data found from storage
 
 	// read from storage
 	var someLiveId uint64 = 90203
-	// cache the result from storage
-	res, err := u.a.CasZadd(ctx, userId, someLiveId)
-	if err != nil {
-		return "", err
+	return []uint64{someLiveId}, nil
+}
+
+// publish hands the outbox of userId to the publisher. A failure is only logged, as the
+// publisher delivers the events left in the outbox later.
+func (u *ApppushReserveV2) publish(ctx context.Context, userId uint64) {
+	if u.publisher == nil {
+		return
+	}
+	if err := u.publisher.Flush(ctx, userId); err != nil {
+		fmt.Printf("err: publish reserve event: %v\n", err)
 	}
-	return res, nil
 }
+
 func (u *ApppushReserveV2) SetCnt() int64 {
-	return u.setCnt
+	return u.setCnt.Load()
 }
 func (u *ApppushReserveV2) SetFailCnt() int64 {
-	return u.setFailCnt
+	return u.setFailCnt.Load()
 }
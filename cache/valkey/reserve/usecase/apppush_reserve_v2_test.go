@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+type failingPublisher struct {
+	flushed int
+}
+
+func (p *failingPublisher) Flush(ctx context.Context, userId uint64) error {
+	p.flushed++
+	return errors.New("kafka down")
+}
+
+func TestWriteStandsWhenPublishFails(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	loadLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:load:", "chan:load:", time.Second, 0)
+	defer loadLock.Close()
+	setLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:set:", "chan:set:", time.Second, 3)
+	defer setLock.Close()
+
+	p := &failingPublisher{}
+	u := NewApppushReserveV2(loadLock, setLock, adapter.NewReserveValkey(client, "reserve:", 0)).
+		WithPublisher(p)
+
+	if _, err := u.SetReserve(ctx, 1, 10); err != nil {
+		t.Fatalf("set reserve: %v", err)
+	}
+	if res, err := u.CancelReserve(ctx, 1, 10); err != nil || res != "90203" {
+		t.Fatalf("cancel reserve = %q, %v, want the stored live", res, err)
+	}
+	if p.flushed != 2 {
+		t.Errorf("flushed %d times, want 2", p.flushed)
+	}
+}
+
+func TestSetCountsConcurrently(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	loadLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:load:", "chan:load:", time.Second, 0)
+	defer loadLock.Close()
+	setLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:set:", "chan:set:", 5*time.Second, 3)
+	defer setLock.Close()
+	u := NewApppushReserveV2(loadLock, setLock, adapter.NewReserveValkey(client, "reserve:", 10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(userId uint64) {
+			defer wg.Done()
+			if _, err := u.SetReserve(ctx, userId, 10); err != nil {
+				t.Error(err)
+			}
+		}(uint64(i%2 + 1))
+	}
+	wg.Wait()
+	if u.SetCnt() != 8 || u.SetFailCnt() != 0 {
+		t.Errorf("set %d times and failed %d, want 8 and 0", u.SetCnt(), u.SetFailCnt())
+	}
+}
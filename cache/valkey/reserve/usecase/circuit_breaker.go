@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/valkey-io/valkey-go"
+)
+
+type breakerMeasure struct {
+	// Failure counts the operations that failed because of valkey.
+	Failure atomic.Int64
+	// Rejected counts the operations not run because the breaker was open.
+	Rejected atomic.Int64
+	// Fallback counts the reads served from storage.
+	Fallback atomic.Int64
+}
+
+// BreakerStats is a snapshot of the circuit breaker of the use case.
+type BreakerStats struct {
+	State    string `json:"state"`
+	Failure  int64  `json:"failure"`
+	Rejected int64  `json:"rejected"`
+	Fallback int64  `json:"fallback"`
+}
+
+// WithCircuitBreaker guards every operation with a circuit breaker that opens after
+// errorThreshold valkey failures without a failure-free period of timeout, and closes
+// again after successThreshold successes once timeout has passed.
+// While it is open, writes fail with breaker.ErrBreakerOpen without touching valkey or
+// the locks, and reads are served from storage and reported as degraded.
+func (u *ApppushReserveV2) WithCircuitBreaker(errorThreshold, successThreshold int, timeout time.Duration) *ApppushReserveV2 {
+	u.breaker = breaker.New(errorThreshold, successThreshold, timeout)
+	u.brkMeasure = &breakerMeasure{}
+	return u
+}
+
+// BreakerStats returns the state of the circuit breaker, or a zero BreakerStats without
+// WithCircuitBreaker.
+func (u *ApppushReserveV2) BreakerStats() BreakerStats {
+	if u.breaker == nil {
+		return BreakerStats{}
+	}
+	return BreakerStats{
+		State:    breakerState(u.breaker.GetState()),
+		Failure:  u.brkMeasure.Failure.Load(),
+		Rejected: u.brkMeasure.Rejected.Load(),
+		Fallback: u.brkMeasure.Fallback.Load(),
+	}
+}
+
+func breakerState(s breaker.State) string {
+	switch s {
+	case breaker.Open:
+		return "open"
+	case breaker.HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// guard runs fn through the circuit breaker, counting only valkey failures against it.
+func (u *ApppushReserveV2) guard(fn func() error) error {
+	if u.breaker == nil {
+		return fn()
+	}
+
+	var err error
+	brkErr := u.breaker.Run(func() error {
+		err = fn()
+		if isValkeyFailure(err) {
+			u.brkMeasure.Failure.Add(1)
+			return err
+		}
+		return nil
+	})
+	if errors.Is(brkErr, breaker.ErrBreakerOpen) {
+		u.brkMeasure.Rejected.Add(1)
+		return brkErr
+	}
+	return err
+}
+
+// unavailable reports whether err means an operation guarded by the breaker could not
+// reach valkey.
+func (u *ApppushReserveV2) unavailable(err error) bool {
+	return u.breaker != nil && (errors.Is(err, breaker.ErrBreakerOpen) || isValkeyFailure(err))
+}
+
+// fallback reads the reservations of userId from storage.
+func (u *ApppushReserveV2) fallback(ctx context.Context, userId uint64) (ReserveResult, error) {
+	lives, err := u.readStorage(ctx, userId)
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	u.brkMeasure.Fallback.Add(1)
+
+	res := make([]string, 0, len(lives))
+	for _, liveId := range lives {
+		res = append(res, fmt.Sprintf("%d", liveId))
+	}
+	return ReserveResult{Reserves: strings.Join(res, ","), Degraded: true}, nil
+}
+
+// isValkeyFailure reports whether err means valkey could not be reached: an i/o error of
+// its connection, or a client left without one. Any other error, such as a missing key, a
+// transaction conflict, an exhausted retry, a held lock, an error reply of a healthy
+// server or a deadline of the caller, says nothing about the health of valkey.
+func isValkeyFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, valkey.ErrClosing),
+		errors.Is(err, valkey.ErrNoAddr),
+		errors.Is(err, valkey.ErrNoSlot),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed):
+		return true
+	}
+	if _, ok := valkey.IsValkeyErr(err); ok {
+		return false
+	}
+	// dial, read and write errors, including their timeouts
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
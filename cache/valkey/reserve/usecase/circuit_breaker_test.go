@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+// newClient connects a client to s that returns connection errors instead of retrying.
+func newClient(t *testing.T, s *valkeytest.Server) valkey.Client {
+	option := s.ClientOption()
+	option.DisableRetry = true
+	client, err := valkey.NewClient(option)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestIsValkeyFailure(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := newClient(t, s)
+
+	s.FailCommand("GET", "ERR injected", 1)
+	replyErr := client.Do(ctx, client.B().Get().Key("a").Build()).Error()
+	s.DropCommand("GET", 1)
+	dropErr := client.Do(ctx, client.B().Get().Key("a").Build()).Error()
+
+	down := valkeytest.Start(t)
+	downClient := newClient(t, down)
+	down.Close()
+	downErr := downClient.Do(ctx, downClient.B().Get().Key("a").Build()).Error()
+
+	deadline, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	<-deadline.Done()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not found", errorz.ErrResourceNotFound, false},
+		{"conflict", errorz.ErrNeedRetry, false},
+		{"retry limit", fmt.Errorf("set reserve: retry limit reached: %w", errorz.ErrNeedRetry), false},
+		{"lock timeout", distlock.NewAcquireLockError("timeout"), false},
+		{"lock deadline", distlock.AsAcquireLockError("context done: ", deadline.Err()), false},
+		{"deadline", fmt.Errorf("set exists reserve: %w", context.DeadlineExceeded), false},
+		{"canceled", context.Canceled, false},
+		{"error reply", fmt.Errorf("set exists reserve: %w", replyErr), false},
+		{"publisher", errors.New("outbox closed"), false},
+		{"dropped connection", fmt.Errorf("set exists reserve: %w", dropErr), true},
+		{"server down", fmt.Errorf("set exists reserve: %w", downErr), true},
+		{"lock of a server down", distlock.AsAcquireLockError("trying to acquire lock", downErr), true},
+		{"closed client", valkey.ErrClosing, true},
+	}
+	for _, tt := range tests {
+		if got := isValkeyFailure(tt.err); got != tt.want {
+			t.Errorf("%s: isValkeyFailure(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGuardCountsValkeyFailures(t *testing.T) {
+	u := (&ApppushReserveV2{}).WithCircuitBreaker(2, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		u.guard(func() error { return errorz.ErrNeedRetry })
+		u.guard(func() error { return context.DeadlineExceeded })
+	}
+	if got := u.BreakerStats(); got.State != "closed" || got.Failure != 0 {
+		t.Fatalf("breaker after outcomes of healthy valkey = %+v", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		u.guard(func() error { return valkey.ErrClosing })
+	}
+	if err := u.guard(func() error { return nil }); !errors.Is(err, breaker.ErrBreakerOpen) {
+		t.Errorf("guard after valkey failures: got %v, want ErrBreakerOpen", err)
+	}
+}
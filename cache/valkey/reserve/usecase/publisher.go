@@ -0,0 +1,15 @@
+package usecase
+
+import (
+	"context"
+)
+
+// ReserveEventPublisher delivers reservation changes to other services.
+//
+// The events of a user are recorded in their outbox by the reservation write itself, see
+// adapter.ReserveValkey.EnableOutbox. Flush hands the outbox of userId over for delivery
+// once the write has committed, and the publisher delivers events left behind by a failed
+// Flush on its own.
+type ReserveEventPublisher interface {
+	Flush(ctx context.Context, userId uint64) error
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/scheduler"
+)
+
+// Reminder is the payload of the job reminding a user of a live they reserved.
+type Reminder struct {
+	UserId  uint64    `json:"user_id"`
+	LiveId  uint64    `json:"live_id"`
+	StartAt time.Time `json:"start_at"`
+}
+
+// ReminderSender delivers a reminder to the user, such as by a push notification.
+type ReminderSender interface {
+	Send(ctx context.Context, r Reminder) error
+}
+
+// LiveStartFunc returns the time liveId starts.
+type LiveStartFunc func(ctx context.Context, liveId uint64) (time.Time, error)
+
+// WithReminders makes SetReserve schedule a reminder the given duration before the live
+// starts, and CancelReserve cancel it. Reminders are sent by running ReminderHandler on s.
+// Reminders are scheduled after the reservation has committed, so a failure to schedule or
+// cancel one is logged rather than returned.
+func (u *ApppushReserveV2) WithReminders(s *scheduler.Scheduler, before time.Duration, startAt LiveStartFunc) *ApppushReserveV2 {
+	u.reminders = s
+	u.remindBefore = before
+	u.liveStartAt = startAt
+	return u
+}
+
+// ReminderHandler returns a handler sending reminders with sender. Reminders of lives that
+// are no longer reserved, or that already started, are dropped.
+func (u *ApppushReserveV2) ReminderHandler(sender ReminderSender) scheduler.Handler {
+	return func(ctx context.Context, job scheduler.Job) error {
+		var r Reminder
+		if err := json.Unmarshal(job.Payload, &r); err != nil {
+			// retrying does not fix a broken payload
+			fmt.Printf("err: reminder %s: %v\n", job.ID, err)
+			return nil
+		}
+		if !time.Now().Before(r.StartAt) {
+			return nil
+		}
+
+		// the cached reservations may have expired since they were made, so read them through
+		reserves, err := u.GetReserve(ctx, r.UserId)
+		if err != nil {
+			return fmt.Errorf("reminder %s: %v", job.ID, err)
+		}
+		if !slices.Contains(strings.Split(reserves, ","), strconv.FormatUint(r.LiveId, 10)) {
+			return nil
+		}
+		return sender.Send(ctx, r)
+	}
+}
+
+func reminderId(userId uint64, liveId uint64) string {
+	return strconv.FormatUint(userId, 10) + ":" + strconv.FormatUint(liveId, 10)
+}
+
+// remind schedules or cancels the reminder of liveId as the event typ requires.
+func (u *ApppushReserveV2) remind(ctx context.Context, typ adapter.EventType, userId uint64, liveId uint64) error {
+	if u.reminders == nil {
+		return nil
+	}
+	id := reminderId(userId, liveId)
+	if typ == adapter.EventCancelled {
+		if err := u.reminders.Cancel(ctx, id); err != nil {
+			return fmt.Errorf("cancel reminder: %v", err)
+		}
+		return nil
+	}
+
+	startAt, err := u.liveStartAt(ctx, liveId)
+	if err != nil {
+		return fmt.Errorf("schedule reminder: live start: %v", err)
+	}
+	if !time.Now().Before(startAt) {
+		return nil
+	}
+	// a reservation made less than remindBefore ahead is reminded right away
+	payload, err := json.Marshal(Reminder{UserId: userId, LiveId: liveId, StartAt: startAt})
+	if err != nil {
+		return fmt.Errorf("schedule reminder: %v", err)
+	}
+	if err = u.reminders.Schedule(ctx, id, payload, startAt.Add(-u.remindBefore)); err != nil {
+		return fmt.Errorf("schedule reminder: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+)
+
+// refreshTimeout bounds a background refresh, which is not tied to any caller's context.
+const refreshTimeout = 10 * time.Second
+
+// ReserveResult is the reservations of a user as returned by Lookup.
+type ReserveResult struct {
+	Reserves string
+	// Stale is set when the reservations were loaded from storage more than the fresh TTL
+	// ago. A refresh has been started in the background.
+	Stale bool
+	// LoadedAt is when the reservations were loaded from storage, zero if unknown.
+	LoadedAt time.Time
+	// Degraded is set when valkey is unavailable and the reservations were read from
+	// storage, without the changes only written to valkey.
+	Degraded bool
+}
+
+// WithStaleWhileRevalidate makes reads serve cached reservations for freshTTL after they
+// were loaded from storage, then serve them as stale while a single caller reloads them in
+// the background. Reservations are only loaded in the foreground when nothing is cached.
+// freshTTL should be shorter than adapter.ReserveTTL, after which nothing is left to serve.
+func (u *ApppushReserveV2) WithStaleWhileRevalidate(freshTTL time.Duration) *ApppushReserveV2 {
+	u.freshTTL = freshTTL
+	return u
+}
+
+func (u *ApppushReserveV2) staleWhileRevalidate() bool {
+	return u.freshTTL > 0
+}
+
+// Lookup returns the reservations of userId and whether they are stale.
+// Without WithStaleWhileRevalidate it never reports stale reservations.
+// With WithCircuitBreaker it reads storage when valkey is unavailable.
+func (u *ApppushReserveV2) Lookup(ctx context.Context, userId uint64) (ReserveResult, error) {
+	var res ReserveResult
+	err := u.guard(func() error {
+		var err error
+		res, err = u.lookup(ctx, userId)
+		return err
+	})
+	if u.unavailable(err) {
+		return u.fallback(ctx, userId)
+	}
+	return res, err
+}
+
+func (u *ApppushReserveV2) lookup(ctx context.Context, userId uint64) (ReserveResult, error) {
+	if !u.staleWhileRevalidate() {
+		res, err := u.getReserve(ctx, userId)
+		return ReserveResult{Reserves: res}, err
+	}
+
+	res, loadedAt, err := u.a.ZrangeLoaded(ctx, userId)
+	if err == nil {
+		if !loadedAt.IsZero() && time.Since(loadedAt) < u.freshTTL {
+			return ReserveResult{Reserves: res, LoadedAt: loadedAt}, nil
+		}
+		u.revalidate(userId)
+		return ReserveResult{Reserves: res, Stale: true, LoadedAt: loadedAt}, nil
+	}
+	if !errors.Is(err, errorz.ErrResourceNotFound) {
+		return ReserveResult{}, err
+	}
+
+	// nothing to serve, so load in the foreground
+	res, err = u.load(ctx, userId)
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	return ReserveResult{Reserves: res, LoadedAt: time.Now()}, nil
+}
+
+// revalidate reloads the reservations of userId in the background unless this process is
+// already doing so. Other processes are kept out by the load lock.
+func (u *ApppushReserveV2) revalidate(userId uint64) {
+	if _, loading := u.refreshing.LoadOrStore(userId, struct{}{}); loading {
+		return
+	}
+
+	go func() {
+		defer u.refreshing.Delete(userId)
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		err := u.guard(func() error {
+			return u.refresh(ctx, userId)
+		})
+		if err != nil {
+			fmt.Printf("refresh reserve %d: %v\n", userId, err)
+		}
+	}()
+}
+
+func (u *ApppushReserveV2) refresh(ctx context.Context, userId uint64) error {
+	lockKey := u.a.Key(userId)
+	if err := u.loadLock.Lock(ctx, lockKey, "refresh-reserve-lock"); err != nil {
+		return err
+	}
+	defer u.loadLock.Unlock(ctx, lockKey, "refresh-reserve-unlock")
+
+	// another process may have refreshed while we waited for the lock
+	_, loadedAt, err := u.a.ZrangeLoaded(ctx, userId)
+	if err != nil && !errors.Is(err, errorz.ErrResourceNotFound) {
+		return err
+	}
+	if err == nil && !loadedAt.IsZero() && time.Since(loadedAt) < u.freshTTL {
+		return nil
+	}
+
+	// what is cached may hold lives cancelled in storage since the last load, so it is
+	// replaced rather than added to
+	_, err = u.a.ReplaceLoaded(ctx, userId, u.readStorage)
+	return err
+}
@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func TestRefreshReplacesCachedLives(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	loadLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:load:", "chan:load:", time.Second, 0)
+	defer loadLock.Close()
+	setLock := distlock.NewDistLockValkeyV3(ctx, client, "lock:set:", "chan:set:", time.Second, 3)
+	defer setLock.Close()
+	a := adapter.NewReserveValkey(client, "reserve:", 0)
+	u := NewApppushReserveV2(loadLock, setLock, a).WithStaleWhileRevalidate(time.Minute)
+
+	// live 10 was cancelled in storage since it was cached
+	for _, liveId := range []uint64{10, 90203} {
+		if _, err := a.CacheZadd(ctx, 1, liveId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := u.Lookup(ctx, 1)
+	if err != nil || res.Reserves != "10,90203" || !res.Stale {
+		t.Fatalf("lookup before the refresh = %+v, %v, want stale lives", res, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for res.Stale && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if res, err = u.Lookup(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if res.Stale || res.Reserves != "90203" || res.LoadedAt.IsZero() {
+		t.Errorf("lookup after the refresh = %+v, want the stored live only", res)
+	}
+	if n, err := client.Do(ctx, client.B().Scard().Key(a.LiveKey(10)).Build()).AsInt64(); err != nil || n != 0 {
+		t.Errorf("users of live 10 = %d, %v, want none", n, err)
+	}
+}
@@ -0,0 +1,432 @@
+// Package scheduler runs delayed jobs stored in valkey on a pool of workers across instances.
+//
+// Jobs wait in a sorted set scored by the time they are due. Claiming a job pushes its
+// score forward by the visibility timeout, so a job whose worker dies becomes due again
+// and is claimed by another worker. Failed jobs are retried with a backoff and moved to a
+// dead letter set once they run out of attempts.
+//
+// Due times are compared with the clock of the server, so instances scheduling jobs should
+// keep their clocks in sync with it.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// ErrJobNotClaimed is returned when a job is acked or failed by a worker whose claim expired.
+var ErrJobNotClaimed = errors.New("scheduler: job not claimed")
+
+// Job is a claimed job.
+type Job struct {
+	ID      string
+	Payload []byte
+	// Attempt counts the claims of the job, starting at 1. It also identifies the claim.
+	Attempt int64
+}
+
+// Handler runs a job. The job is acked if it returns nil and retried otherwise. ctx is
+// cancelled when the visibility timeout expires.
+type Handler func(ctx context.Context, job Job) error
+
+type schedulerMeasure struct {
+	Scheduled atomic.Int64
+	Claimed   atomic.Int64
+	Acked     atomic.Int64
+	Retried   atomic.Int64
+	Released  atomic.Int64
+	Dead      atomic.Int64
+}
+
+func (m *schedulerMeasure) String() string {
+	return fmt.Sprintf("scheduled: %d, claimed: %d, acked: %d, retried: %d, released: %d, dead: %d",
+		m.Scheduled.Load(), m.Claimed.Load(), m.Acked.Load(), m.Retried.Load(), m.Released.Load(), m.Dead.Load())
+}
+
+// claimScript claims up to count due jobs for the visibility timeout. It returns the id,
+// attempt and payload of each job. Jobs without a payload are dropped, and jobs whose
+// workers kept dying before they could fail them are dead lettered.
+//
+// KEYS[1] due, KEYS[2] payloads, KEYS[3] attempts, KEYS[4] dead
+// ARGV[1] count, ARGV[2] visibility timeout in milliseconds, ARGV[3] max attempts
+var claimScript = valkey.NewLuaScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, tonumber(ARGV[1]))
+local res = {}
+for _, id in ipairs(ids) do
+	local payload = redis.call('HGET', KEYS[2], id)
+	local attempt = tonumber(redis.call('HGET', KEYS[3], id) or '0')
+	if not payload then
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('HDEL', KEYS[3], id)
+	elseif attempt >= tonumber(ARGV[3]) then
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('ZADD', KEYS[4], now, id)
+	else
+		redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), id)
+		redis.call('HSET', KEYS[3], id, attempt + 1)
+		table.insert(res, id)
+		table.insert(res, attempt + 1)
+		table.insert(res, payload)
+	end
+end
+return res
+`)
+
+// ackScript removes a job if its claim is still current.
+//
+// KEYS[1] due, KEYS[2] payloads, KEYS[3] attempts
+// ARGV[1] id, ARGV[2] attempt
+var ackScript = valkey.NewLuaScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// failScript makes a job due again after the backoff, or moves it to the dead letter set
+// once it ran out of attempts, if its claim is still current. It returns 1 on retry and 2
+// on dead lettering.
+//
+// KEYS[1] due, KEYS[2] attempts, KEYS[3] dead
+// ARGV[1] id, ARGV[2] attempt, ARGV[3] max attempts, ARGV[4] backoff in milliseconds
+var failScript = valkey.NewLuaScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+if tonumber(ARGV[2]) >= tonumber(ARGV[3]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	redis.call('ZADD', KEYS[3], now, ARGV[1])
+	return 2
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[4]), ARGV[1])
+return 1
+`)
+
+// releaseScript makes a job due right away and takes back its attempt, if its claim is
+// still current.
+//
+// KEYS[1] due, KEYS[2] attempts
+// ARGV[1] id, ARGV[2] attempt
+var releaseScript = valkey.NewLuaScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+if tonumber(ARGV[2]) <= 1 then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+else
+	redis.call('HSET', KEYS[2], ARGV[1], tonumber(ARGV[2]) - 1)
+end
+redis.call('ZADD', KEYS[1], now, ARGV[1])
+return 1
+`)
+
+// Scheduler is a queue of delayed jobs. Its keys share a hash tag, so it works in cluster
+// mode too.
+type Scheduler struct {
+	client      valkey.Client
+	dueKey      string
+	payloadKey  string
+	attemptKey  string
+	deadKey     string
+	visibility  time.Duration
+	maxAttempts int64
+	backoff     func(attempt int64) time.Duration
+	poll        time.Duration
+	batch       int64
+
+	measure *schedulerMeasure
+}
+
+// NewScheduler creates a Scheduler for the queue name, whose jobs may run for up to
+// visibility before they are claimed again. Jobs are tried 5 times with an exponential
+// backoff starting at a second.
+func NewScheduler(client valkey.Client, prefix, name string, visibility time.Duration) *Scheduler {
+	tag := prefix + "{" + name + "}"
+	return &Scheduler{
+		client:      client,
+		dueKey:      tag + ":due",
+		payloadKey:  tag + ":payload",
+		attemptKey:  tag + ":attempt",
+		deadKey:     tag + ":dead",
+		visibility:  visibility,
+		maxAttempts: 5,
+		backoff: func(attempt int64) time.Duration {
+			return time.Second << min(attempt-1, 16)
+		},
+		poll:    time.Second,
+		batch:   10,
+		measure: &schedulerMeasure{},
+	}
+}
+
+// WithMaxAttempts dead letters jobs after n failed attempts.
+func (s *Scheduler) WithMaxAttempts(n int64) *Scheduler {
+	s.maxAttempts = n
+	return s
+}
+
+// WithBackoff retries a job that failed its attempt after backoff(attempt).
+func (s *Scheduler) WithBackoff(backoff func(attempt int64) time.Duration) *Scheduler {
+	s.backoff = backoff
+	return s
+}
+
+// WithPoll makes idle workers look for due jobs every d, and each claim up to batch jobs.
+func (s *Scheduler) WithPoll(d time.Duration, batch int64) *Scheduler {
+	s.poll = d
+	s.batch = batch
+	return s
+}
+
+func (s *Scheduler) String() string {
+	return s.measure.String()
+}
+
+// Schedule makes the job id with payload due at. Scheduling an id again replaces its
+// payload and due time, and resets its attempts.
+func (s *Scheduler) Schedule(ctx context.Context, id string, payload []byte, at time.Time) error {
+	res := s.client.DoMulti(ctx,
+		s.client.B().Multi().Build(),
+		s.client.B().Hset().Key(s.payloadKey).FieldValue().FieldValue(id, valkey.BinaryString(payload)).Build(),
+		s.client.B().Hdel().Key(s.attemptKey).Field(id).Build(),
+		s.client.B().Zrem().Key(s.deadKey).Member(id).Build(),
+		s.client.B().Zadd().Key(s.dueKey).ScoreMember().ScoreMember(float64(at.UnixMilli()), id).Build(),
+		s.client.B().Exec().Build(),
+	)
+	for i, r := range res {
+		if r.Error() != nil {
+			return fmt.Errorf("schedule %s(resInd=%d): %w", id, i, r.Error())
+		}
+	}
+	s.measure.Scheduled.Add(1)
+	return nil
+}
+
+// Cancel removes the job id, whether it is waiting, running or dead. A running job is
+// still finished by its worker, but not retried.
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	res := s.client.DoMulti(ctx,
+		s.client.B().Multi().Build(),
+		s.client.B().Zrem().Key(s.dueKey).Member(id).Build(),
+		s.client.B().Zrem().Key(s.deadKey).Member(id).Build(),
+		s.client.B().Hdel().Key(s.payloadKey).Field(id).Build(),
+		s.client.B().Hdel().Key(s.attemptKey).Field(id).Build(),
+		s.client.B().Exec().Build(),
+	)
+	for i, r := range res {
+		if r.Error() != nil {
+			return fmt.Errorf("cancel %s(resInd=%d): %w", id, i, r.Error())
+		}
+	}
+	return nil
+}
+
+// Claim claims up to count due jobs for the visibility timeout.
+func (s *Scheduler) Claim(ctx context.Context, count int64) ([]Job, error) {
+	values, err := claimScript.Exec(ctx, s.client, []string{s.dueKey, s.payloadKey, s.attemptKey, s.deadKey}, []string{
+		strconv.FormatInt(count, 10),
+		strconv.FormatInt(s.visibility.Milliseconds(), 10),
+		strconv.FormatInt(s.maxAttempts, 10),
+	}).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("claim: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		id, err := values[i].ToString()
+		if err != nil {
+			return nil, fmt.Errorf("claim: %w", err)
+		}
+		attempt, err := values[i+1].AsInt64()
+		if err != nil {
+			return nil, fmt.Errorf("claim %s: %w", id, err)
+		}
+		payload, err := values[i+2].AsBytes()
+		if err != nil {
+			return nil, fmt.Errorf("claim %s: %w", id, err)
+		}
+		jobs = append(jobs, Job{ID: id, Payload: payload, Attempt: attempt})
+	}
+	s.measure.Claimed.Add(int64(len(jobs)))
+	return jobs, nil
+}
+
+// Ack removes a job that ran. It returns ErrJobNotClaimed if the claim expired, in which
+// case the job may run again.
+func (s *Scheduler) Ack(ctx context.Context, job Job) error {
+	n, err := ackScript.Exec(ctx, s.client, []string{s.dueKey, s.payloadKey, s.attemptKey}, []string{
+		job.ID,
+		strconv.FormatInt(job.Attempt, 10),
+	}).AsInt64()
+	if err != nil {
+		return fmt.Errorf("ack %s: %w", job.ID, err)
+	}
+	if n == 0 {
+		return ErrJobNotClaimed
+	}
+	s.measure.Acked.Add(1)
+	return nil
+}
+
+// Fail retries a job that failed after the backoff, or dead letters it once it ran out of
+// attempts, reporting whether it did. It returns ErrJobNotClaimed if the claim expired.
+func (s *Scheduler) Fail(ctx context.Context, job Job) (dead bool, err error) {
+	n, err := failScript.Exec(ctx, s.client, []string{s.dueKey, s.attemptKey, s.deadKey}, []string{
+		job.ID,
+		strconv.FormatInt(job.Attempt, 10),
+		strconv.FormatInt(s.maxAttempts, 10),
+		strconv.FormatInt(s.backoff(job.Attempt).Milliseconds(), 10),
+	}).AsInt64()
+	if err != nil {
+		return false, fmt.Errorf("fail %s: %w", job.ID, err)
+	}
+	switch n {
+	case 0:
+		return false, ErrJobNotClaimed
+	case 2:
+		s.measure.Dead.Add(1)
+		return true, nil
+	default:
+		s.measure.Retried.Add(1)
+		return false, nil
+	}
+}
+
+// Release gives back a claimed job that did not run, making it due right away without
+// using up an attempt. It returns ErrJobNotClaimed if the claim expired.
+func (s *Scheduler) Release(ctx context.Context, job Job) error {
+	n, err := releaseScript.Exec(ctx, s.client, []string{s.dueKey, s.attemptKey}, []string{
+		job.ID,
+		strconv.FormatInt(job.Attempt, 10),
+	}).AsInt64()
+	if err != nil {
+		return fmt.Errorf("release %s: %w", job.ID, err)
+	}
+	if n == 0 {
+		return ErrJobNotClaimed
+	}
+	s.measure.Released.Add(1)
+	return nil
+}
+
+// DeadLetters returns the ids of up to count dead jobs, oldest first.
+func (s *Scheduler) DeadLetters(ctx context.Context, count int64) ([]string, error) {
+	ids, err := s.client.Do(ctx, s.client.B().Zrange().Key(s.deadKey).Min("0").Max(strconv.FormatInt(count-1, 10)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("dead letters: %w", err)
+	}
+	return ids, nil
+}
+
+// Requeue makes the dead job id due at with its attempts reset.
+func (s *Scheduler) Requeue(ctx context.Context, id string, at time.Time) error {
+	res := s.client.DoMulti(ctx,
+		s.client.B().Multi().Build(),
+		s.client.B().Zrem().Key(s.deadKey).Member(id).Build(),
+		s.client.B().Hdel().Key(s.attemptKey).Field(id).Build(),
+		s.client.B().Zadd().Key(s.dueKey).ScoreMember().ScoreMember(float64(at.UnixMilli()), id).Build(),
+		s.client.B().Exec().Build(),
+	)
+	for i, r := range res {
+		if r.Error() != nil {
+			return fmt.Errorf("requeue %s(resInd=%d): %w", id, i, r.Error())
+		}
+	}
+	return nil
+}
+
+// Run runs due jobs with h on workers goroutines until ctx is done. Jobs still running
+// when ctx is done are cancelled and become due again when their claim expires, and jobs
+// claimed but not started yet are released.
+func (s *Scheduler) Run(ctx context.Context, workers int, h Handler) error {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, h)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Scheduler) work(ctx context.Context, h Handler) {
+	for {
+		// the claim of every job in the batch expires at the same time
+		deadline := time.Now().Add(s.visibility)
+		jobs, err := s.Claim(ctx, s.batch)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("err: %v\n", err)
+		}
+		for i, job := range jobs {
+			if ctx.Err() != nil || time.Now().After(deadline) {
+				// jobs left behind by slow ones are given back instead of waiting for their
+				// claim to expire and losing an attempt
+				s.release(jobs[i:])
+				break
+			}
+			s.run(ctx, h, job, deadline)
+		}
+		if len(jobs) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.poll):
+		}
+	}
+}
+
+// run runs a job claimed until deadline.
+func (s *Scheduler) run(ctx context.Context, h Handler, job Job, deadline time.Time) {
+	jobCtx, cancel := context.WithDeadline(ctx, deadline)
+	err := h(jobCtx, job)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		err = s.Ack(ctx, job)
+	} else {
+		_, err = s.Fail(ctx, job)
+	}
+	if err != nil && !errors.Is(err, ErrJobNotClaimed) {
+		fmt.Printf("err: %v\n", err)
+	}
+}
+
+// release gives back jobs that were claimed but not run, even once the workers are stopping.
+func (s *Scheduler) release(jobs []Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, job := range jobs {
+		if err := s.Release(ctx, job); err != nil && !errors.Is(err, ErrJobNotClaimed) {
+			fmt.Printf("err: %v\n", err)
+		}
+	}
+}
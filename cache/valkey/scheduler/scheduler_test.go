@@ -0,0 +1,205 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wonksing/go-tutorials/cache/valkey/scheduler"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func claimIds(t *testing.T, s *scheduler.Scheduler) []string {
+	t.Helper()
+	jobs, err := s.Claim(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestDelayedVisibility(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	s := scheduler.NewScheduler(client, "job:", "delayed", 200*time.Millisecond)
+
+	if err := s.Schedule(ctx, "later", []byte("p"), time.Now().Add(200*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Schedule(ctx, "now", []byte("p"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := s.Claim(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "now" || jobs[0].Attempt != 1 || string(jobs[0].Payload) != "p" {
+		t.Fatalf("claim = %+v, want the due job only", jobs)
+	}
+	// a claimed job is hidden until its claim expires
+	if ids := claimIds(t, s); len(ids) != 0 {
+		t.Fatalf("claim while claimed = %v, want none", ids)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	jobs, err = s.Claim(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := map[string]int64{}
+	for _, job := range jobs {
+		attempts[job.ID] = job.Attempt
+	}
+	// the claim of "now" expired as if its worker died
+	if len(attempts) != 2 || attempts["later"] != 1 || attempts["now"] != 2 {
+		t.Fatalf("claim after the delay = %v, want later at attempt 1 and now at attempt 2", attempts)
+	}
+	// the expired claim can no longer be acked
+	if err = s.Ack(ctx, scheduler.Job{ID: "now", Attempt: 1}); !errors.Is(err, scheduler.ErrJobNotClaimed) {
+		t.Errorf("ack of an expired claim: %v, want ErrJobNotClaimed", err)
+	}
+	for _, job := range jobs {
+		if err = s.Ack(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(250 * time.Millisecond)
+	if ids := claimIds(t, s); len(ids) != 0 {
+		t.Errorf("claim after ack = %v, want none", ids)
+	}
+}
+
+func TestRetryUntilDead(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	var backoffs []int64
+	s := scheduler.NewScheduler(client, "job:", "retry", time.Minute).
+		WithMaxAttempts(3).
+		WithBackoff(func(attempt int64) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return time.Duration(attempt) * 100 * time.Millisecond
+		})
+
+	if err := s.Schedule(ctx, "flaky", []byte("p"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := int64(1); attempt <= 3; attempt++ {
+		var jobs []scheduler.Job
+		// due after the backoff of the previous attempt
+		deadline := time.Now().Add(time.Second)
+		for len(jobs) == 0 && time.Now().Before(deadline) {
+			var err error
+			if jobs, err = s.Claim(ctx, 10); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(jobs) != 1 || jobs[0].Attempt != attempt {
+			t.Fatalf("claim %d = %+v, want attempt %d", attempt, jobs, attempt)
+		}
+		failedAt := time.Now()
+
+		dead, err := s.Fail(ctx, jobs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dead != (attempt == 3) {
+			t.Fatalf("fail of attempt %d: dead = %v", attempt, dead)
+		}
+		if dead {
+			break
+		}
+		// not before the backoff
+		time.Sleep(time.Duration(attempt)*100*time.Millisecond - time.Since(failedAt) - 20*time.Millisecond)
+		if ids := claimIds(t, s); len(ids) != 0 {
+			t.Fatalf("claim within the backoff of attempt %d = %v, want none", attempt, ids)
+		}
+	}
+	if len(backoffs) != 3 || backoffs[0] != 1 || backoffs[1] != 2 {
+		t.Errorf("backoffs of attempts = %v, want [1 2 3]", backoffs)
+	}
+
+	dead, err := s.DeadLetters(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0] != "flaky" {
+		t.Fatalf("dead letters = %v, %v, want [flaky]", dead, err)
+	}
+	if ids := claimIds(t, s); len(ids) != 0 {
+		t.Fatalf("claim of a dead job = %v, want none", ids)
+	}
+
+	if err = s.Requeue(ctx, "flaky", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := s.Claim(ctx, 10)
+	if err != nil || len(jobs) != 1 || jobs[0].Attempt != 1 {
+		t.Fatalf("claim after requeue = %+v, %v, want attempt 1", jobs, err)
+	}
+}
+
+func TestReleaseOnStop(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	s := scheduler.NewScheduler(client, "job:", "stop", time.Minute).WithPoll(10*time.Millisecond, 3)
+
+	at := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		// claimed in this order
+		if err := s.Schedule(ctx, id, []byte(id), at.Add(time.Duration(i-3)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	started := make(chan string, 3)
+	var mu sync.Mutex
+	var ran []string
+	done := make(chan error)
+	go func() {
+		done <- s.Run(runCtx, 1, func(ctx context.Context, job scheduler.Job) error {
+			mu.Lock()
+			ran = append(ran, job.ID)
+			mu.Unlock()
+			started <- job.ID
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	if id := <-started; id != "a" {
+		t.Fatalf("first job = %s, want a", id)
+	}
+	stop()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run: %v", err)
+	}
+	if len(ran) != 1 {
+		t.Fatalf("ran %v, want only a", ran)
+	}
+	if !strings.Contains(s.String(), "released: 2") {
+		t.Errorf("measure = %s, want 2 released", s)
+	}
+
+	// the jobs that did not start are due right away without using up an attempt, while
+	// the interrupted one waits for its claim to expire
+	jobs, err := s.Claim(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := map[string]int64{}
+	for _, job := range jobs {
+		attempts[job.ID] = job.Attempt
+	}
+	if len(attempts) != 2 || attempts["b"] != 1 || attempts["c"] != 1 {
+		t.Errorf("claim after stop = %v, want b and c at attempt 1", attempts)
+	}
+}
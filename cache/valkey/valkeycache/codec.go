@@ -0,0 +1,61 @@
+package valkeycache
+
+import (
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec converts values to and from the bytes stored in valkey.
+type Codec[V any] interface {
+	Marshal(v V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// JSONCodec stores values as JSON.
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(v V) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// MsgpackCodec stores values as MessagePack, which is smaller and faster to decode than JSON.
+type MsgpackCodec[V any] struct{}
+
+func (MsgpackCodec[V]) Marshal(v V) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
+
+// ProtoCodec stores protobuf messages in their wire format.
+type ProtoCodec[V proto.Message] struct {
+	newMessage func() V
+}
+
+// NewProtoCodec creates a ProtoCodec decoding into messages created by newMessage,
+// such as func() *pb.User { return &pb.User{} }.
+func NewProtoCodec[V proto.Message](newMessage func() V) ProtoCodec[V] {
+	return ProtoCodec[V]{newMessage: newMessage}
+}
+
+func (c ProtoCodec[V]) Marshal(v V) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (c ProtoCodec[V]) Unmarshal(data []byte) (V, error) {
+	v := c.newMessage()
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
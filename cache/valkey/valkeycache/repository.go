@@ -0,0 +1,305 @@
+package valkeycache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"golang.org/x/sync/singleflight"
+)
+
+// LoadFunc reads the value of a key from the backing store. It returns
+// errorz.ErrResourceNotFound if there is none.
+type LoadFunc[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadMultiFunc reads the values of keys from the backing store, leaving out the keys
+// that have none.
+type LoadMultiFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type repositoryMeasure struct {
+	Hit  atomic.Int64
+	Miss atomic.Int64
+	Load atomic.Int64
+}
+
+func (m *repositoryMeasure) String() string {
+	return fmt.Sprintf("hit: %d, miss: %d, load: %d", m.Hit.Load(), m.Miss.Load(), m.Load.Load())
+}
+
+// Repository is a cache-aside store of values of type V in valkey, keyed by K.
+// Each value is stored under its own string key, so batches work in cluster mode too.
+type Repository[K comparable, V any] struct {
+	client   valkey.Client
+	prefix   string
+	codec    Codec[V]
+	ttl      time.Duration
+	keyFunc  func(K) string
+	cacheTTL time.Duration
+
+	group   singleflight.Group
+	measure *repositoryMeasure
+}
+
+// NewRepository creates a Repository storing values encoded by codec under prefix followed
+// by the key, for ttl. A zero ttl keeps values until they are invalidated. ttl is stored
+// in milliseconds, so a positive ttl under a millisecond is raised to one.
+func NewRepository[K comparable, V any](client valkey.Client, prefix string, codec Codec[V], ttl time.Duration) *Repository[K, V] {
+	if ttl > 0 && ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return &Repository[K, V]{
+		client:  client,
+		prefix:  prefix,
+		codec:   codec,
+		ttl:     ttl,
+		keyFunc: func(k K) string { return fmt.Sprint(k) },
+		measure: &repositoryMeasure{},
+	}
+}
+
+// WithKeyFunc makes the repository format keys with fn instead of fmt.Sprint.
+// Wrapping the result in braces, like "{" + id + "}", places related keys in one cluster slot.
+func (r *Repository[K, V]) WithKeyFunc(fn func(K) string) *Repository[K, V] {
+	r.keyFunc = fn
+	return r
+}
+
+// WithClientCache serves reads from the server-assisted client side cache for up to
+// cacheTTL. The client must be created without ClientOption.DisableCache.
+func (r *Repository[K, V]) WithClientCache(cacheTTL time.Duration) *Repository[K, V] {
+	r.cacheTTL = cacheTTL
+	return r
+}
+
+// Key returns the valkey key of k.
+func (r *Repository[K, V]) Key(k K) string {
+	return r.prefix + r.keyFunc(k)
+}
+
+func (r *Repository[K, V]) Hits() int64 {
+	return r.measure.Hit.Load()
+}
+
+func (r *Repository[K, V]) Misses() int64 {
+	return r.measure.Miss.Load()
+}
+
+func (r *Repository[K, V]) Loads() int64 {
+	return r.measure.Load.Load()
+}
+
+func (r *Repository[K, V]) String() string {
+	return r.measure.String()
+}
+
+// Get returns the cached value of k, or errorz.ErrResourceNotFound if there is none.
+func (r *Repository[K, V]) Get(ctx context.Context, k K) (V, error) {
+	var zero V
+	key := r.Key(k)
+
+	var res valkey.ValkeyResult
+	if r.cacheTTL > 0 {
+		res = r.client.DoCache(ctx, r.client.B().Get().Key(key).Cache(), r.cacheTTL)
+	} else {
+		res = r.client.Do(ctx, r.client.B().Get().Key(key).Build())
+	}
+	v, found, err := r.decode(key, res)
+	if err != nil {
+		return zero, err
+	}
+	if !found {
+		return zero, errorz.ErrResourceNotFound
+	}
+	return v, nil
+}
+
+// Set caches v as the value of k.
+func (r *Repository[K, V]) Set(ctx context.Context, k K, v V) error {
+	cmd, err := r.setCmd(k, v)
+	if err != nil {
+		return err
+	}
+	return r.client.Do(ctx, cmd).Error()
+}
+
+// GetMulti returns the cached values of keys. Keys without a cached value are left out.
+func (r *Repository[K, V]) GetMulti(ctx context.Context, keys []K) (map[K]V, error) {
+	if len(keys) == 0 {
+		return map[K]V{}, nil
+	}
+
+	var res []valkey.ValkeyResult
+	if r.cacheTTL > 0 {
+		cmds := make([]valkey.CacheableTTL, 0, len(keys))
+		for _, k := range keys {
+			cmds = append(cmds, valkey.CT(r.client.B().Get().Key(r.Key(k)).Cache(), r.cacheTTL))
+		}
+		res = r.client.DoMultiCache(ctx, cmds...)
+	} else {
+		cmds := make(valkey.Commands, 0, len(keys))
+		for _, k := range keys {
+			cmds = append(cmds, r.client.B().Get().Key(r.Key(k)).Build())
+		}
+		res = r.client.DoMulti(ctx, cmds...)
+	}
+
+	values := make(map[K]V, len(keys))
+	for i, k := range keys {
+		v, found, err := r.decode(r.Key(k), res[i])
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// SetMulti caches every value of values.
+func (r *Repository[K, V]) SetMulti(ctx context.Context, values map[K]V) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	cmds := make(valkey.Commands, 0, len(values))
+	for k, v := range values {
+		cmd, err := r.setCmd(k, v)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, res := range r.client.DoMulti(ctx, cmds...) {
+		if err := res.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate removes the cached values of keys, so that the next read loads them again.
+// Client side caches are invalidated by the server.
+func (r *Repository[K, V]) Invalidate(ctx context.Context, keys ...K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	cmds := make(valkey.Commands, 0, len(keys))
+	for _, k := range keys {
+		key := r.Key(k)
+		// later reads must not join a load that started before the invalidation
+		r.group.Forget(key)
+		cmds = append(cmds, r.client.B().Del().Key(key).Build())
+	}
+	for _, res := range r.client.DoMulti(ctx, cmds...) {
+		if err := res.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrLoad returns the cached value of k, loading and caching it on a miss. Concurrent
+// misses of the same key in this process share a single load. If valkey fails, the value
+// is loaded the same way, so an outage does not send every concurrent read to the backing
+// store, and caching it is attempted.
+//
+// A load that overlaps an Invalidate of its key may cache the value read before the
+// invalidation; it lives until ttl expires.
+func (r *Repository[K, V]) GetOrLoad(ctx context.Context, k K, load LoadFunc[K, V]) (V, error) {
+	var zero V
+	v, err := r.Get(ctx, k)
+	if err == nil {
+		return v, nil
+	}
+
+	ch := r.group.DoChan(r.Key(k), func() (any, error) {
+		// the load is shared, so it must not be cancelled with the caller who started it
+		ctx := context.WithoutCancel(ctx)
+		r.measure.Load.Add(1)
+		v, err := load(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		// a value that cannot be cached is still a valid result
+		_ = r.Set(ctx, k, v)
+		return v, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		v, _ := res.Val.(V)
+		return v, nil
+	}
+}
+
+// GetMultiOrLoad returns the values of keys, loading the missing ones with a single call
+// of load and caching them. Keys without a value are left out.
+func (r *Repository[K, V]) GetMultiOrLoad(ctx context.Context, keys []K, load LoadMultiFunc[K, V]) (map[K]V, error) {
+	values, err := r.GetMulti(ctx, keys)
+	if err != nil {
+		return load(ctx, keys)
+	}
+
+	missing := make([]K, 0, len(keys)-len(values))
+	for _, k := range keys {
+		if _, ok := values[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	r.measure.Load.Add(1)
+	loaded, err := load(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.SetMulti(ctx, loaded)
+	for k, v := range loaded {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (r *Repository[K, V]) setCmd(k K, v V) (valkey.Completed, error) {
+	key := r.Key(k)
+	data, err := r.codec.Marshal(v)
+	if err != nil {
+		return valkey.Completed{}, fmt.Errorf("encode %s: %v", key, err)
+	}
+	if r.ttl > 0 {
+		return r.client.B().Set().Key(key).Value(valkey.BinaryString(data)).Px(r.ttl).Build(), nil
+	}
+	return r.client.B().Set().Key(key).Value(valkey.BinaryString(data)).Build(), nil
+}
+
+// decode returns the value of a GET reply, counting hits and misses.
+func (r *Repository[K, V]) decode(key string, res valkey.ValkeyResult) (V, bool, error) {
+	var zero V
+	data, err := res.AsBytes()
+	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			r.measure.Miss.Add(1)
+			return zero, false, nil
+		}
+		return zero, false, err
+	}
+	r.measure.Hit.Add(1)
+
+	v, err := r.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false, fmt.Errorf("decode %s: %v", key, err)
+	}
+	return v, true, nil
+}
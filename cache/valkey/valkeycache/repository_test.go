@@ -0,0 +1,254 @@
+package valkeycache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeycache"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Id   int64  `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func newRepository(t *testing.T, ttl time.Duration) (*valkeycache.Repository[int64, user], *valkeytest.Server, valkey.Client) {
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	return valkeycache.NewRepository[int64, user](client, "user:", valkeycache.JSONCodec[user]{}, ttl), s, client
+}
+
+func TestGetSet(t *testing.T) {
+	ctx := context.Background()
+	r, _, _ := newRepository(t, 0)
+
+	if _, err := r.Get(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+		t.Fatalf("get before set: %v, want ErrResourceNotFound", err)
+	}
+	if err := r.Set(ctx, 1, user{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Get(ctx, 1)
+	if err != nil || v != (user{Id: 1, Name: "a"}) {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+	if r.Hits() != 1 || r.Misses() != 1 {
+		t.Errorf("hits = %d, misses = %d, want 1 and 1", r.Hits(), r.Misses())
+	}
+
+	if err = r.Invalidate(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Get(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+		t.Fatalf("get after invalidate: %v, want ErrResourceNotFound", err)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+	want := user{Id: 7, Name: "codec"}
+
+	for name, codec := range map[string]valkeycache.Codec[user]{
+		"json":    valkeycache.JSONCodec[user]{},
+		"msgpack": valkeycache.MsgpackCodec[user]{},
+	} {
+		r := valkeycache.NewRepository[int64, user](client, name+":", codec, 0)
+		if err := r.Set(ctx, want.Id, want); err != nil {
+			t.Fatalf("%s: set: %v", name, err)
+		}
+		if v, err := r.Get(ctx, want.Id); err != nil || v != want {
+			t.Errorf("%s: get = %v, %v, want %v", name, v, err, want)
+		}
+	}
+
+	r := valkeycache.NewRepository[int64, *wrapperspb.StringValue](client, "proto:",
+		valkeycache.NewProtoCodec(func() *wrapperspb.StringValue { return &wrapperspb.StringValue{} }), 0)
+	if err := r.Set(ctx, 1, wrapperspb.String("proto")); err != nil {
+		t.Fatalf("proto: set: %v", err)
+	}
+	if v, err := r.Get(ctx, 1); err != nil || !proto.Equal(v, wrapperspb.String("proto")) {
+		t.Errorf("proto: get = %v, %v", v, err)
+	}
+
+	// a value that cannot be decoded is an error, not a miss
+	if err := client.Do(ctx, client.B().Set().Key("json:8").Value("{").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	js := valkeycache.NewRepository[int64, user](client, "json:", valkeycache.JSONCodec[user]{}, 0)
+	if _, err := js.Get(ctx, 8); err == nil || errors.Is(err, errorz.ErrResourceNotFound) {
+		t.Errorf("get of a corrupt value: %v, want a decode error", err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	// shorter than a second, which must not be truncated to EX 0
+	r, _, client := newRepository(t, 200*time.Millisecond)
+
+	if err := r.Set(ctx, 1, user{Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+	pttl, err := client.Do(ctx, client.B().Pttl().Key(r.Key(1)).Build()).AsInt64()
+	if err != nil || pttl <= 0 || pttl > 200 {
+		t.Fatalf("pttl = %d, %v, want (0, 200]", pttl, err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, err = r.Get(ctx, 1); !errors.Is(err, errorz.ErrResourceNotFound) {
+		t.Fatalf("get after ttl: %v, want ErrResourceNotFound", err)
+	}
+
+	if err = r.SetMulti(ctx, map[int64]user{2: {Id: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if pttl, _ = client.Do(ctx, client.B().Pttl().Key(r.Key(2)).Build()).AsInt64(); pttl <= 0 {
+		t.Errorf("pttl of SetMulti = %d, want a ttl", pttl)
+	}
+
+	// without ttl values stay
+	r, _, client = newRepository(t, 0)
+	if err = r.Set(ctx, 1, user{Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if pttl, _ = client.Do(ctx, client.B().Pttl().Key(r.Key(1)).Build()).AsInt64(); pttl != -1 {
+		t.Errorf("pttl without ttl = %d, want -1", pttl)
+	}
+}
+
+// loadConcurrently calls GetOrLoad of key 1 from n goroutines. The load blocks until the
+// server has answered n GETs, so that every call finds the shared load running.
+func loadConcurrently(t *testing.T, r *valkeycache.Repository[int64, user], s *valkeytest.Server, n int, fault *valkeytest.Fault) int64 {
+	var gets atomic.Int64
+	allGot := make(chan struct{})
+	s.SetFault(func(cmd []string) *valkeytest.Fault {
+		if cmd[0] != "GET" {
+			return nil
+		}
+		if gets.Add(1) == int64(n) {
+			close(allGot)
+		}
+		return fault
+	})
+	defer s.ClearFaults()
+
+	var loads atomic.Int64
+	load := func(ctx context.Context, k int64) (user, error) {
+		loads.Add(1)
+		<-allGot
+		time.Sleep(50 * time.Millisecond)
+		return user{Id: k, Name: "loaded"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := r.GetOrLoad(context.Background(), 1, load)
+			if err != nil || v.Name != "loaded" {
+				t.Errorf("get or load = %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return loads.Load()
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	r, s, _ := newRepository(t, time.Minute)
+
+	if loads := loadConcurrently(t, r, s, 10, nil); loads != 1 {
+		t.Errorf("loads of concurrent misses = %d, want 1", loads)
+	}
+	// the loaded value is cached
+	if v, err := r.Get(ctx, 1); err != nil || v.Name != "loaded" {
+		t.Fatalf("get after load = %v, %v", v, err)
+	}
+	v, err := r.GetOrLoad(ctx, 1, func(ctx context.Context, k int64) (user, error) {
+		t.Error("loaded a cached value")
+		return user{}, nil
+	})
+	if err != nil || v.Name != "loaded" {
+		t.Fatalf("get or load of a cached value = %v, %v", v, err)
+	}
+
+	wantErr := errors.New("store down")
+	_, err = r.GetOrLoad(ctx, 2, func(ctx context.Context, k int64) (user, error) {
+		return user{}, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("get or load of a failed load: %v, want %v", err, wantErr)
+	}
+}
+
+func TestGetOrLoadValkeyFailure(t *testing.T) {
+	r, s, _ := newRepository(t, time.Minute)
+
+	// concurrent reads still share a load while valkey fails
+	if loads := loadConcurrently(t, r, s, 10, &valkeytest.Fault{Err: "ERR down"}); loads != 1 {
+		t.Errorf("loads while valkey fails = %d, want 1", loads)
+	}
+}
+
+func TestGetMultiOrLoad(t *testing.T) {
+	ctx := context.Background()
+	r, _, _ := newRepository(t, time.Minute)
+
+	if err := r.SetMulti(ctx, map[int64]user{1: {Id: 1, Name: "cached"}, 2: {Id: 2, Name: "cached"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := r.GetMulti(ctx, []int64{1, 2, 3})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("get multi = %v, %v, want keys 1 and 2", values, err)
+	}
+
+	var loaded [][]int64
+	load := func(ctx context.Context, keys []int64) (map[int64]user, error) {
+		loaded = append(loaded, keys)
+		values := map[int64]user{}
+		for _, k := range keys {
+			// 4 is in neither valkey nor the store
+			if k != 4 {
+				values[k] = user{Id: k, Name: "loaded"}
+			}
+		}
+		return values, nil
+	}
+	values, err = r.GetMultiOrLoad(ctx, []int64{1, 2, 3, 4}, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]string{1: "cached", 2: "cached", 3: "loaded"}
+	if len(values) != len(want) {
+		t.Fatalf("get multi or load = %v, want %v", values, want)
+	}
+	for k, name := range want {
+		if values[k].Name != name {
+			t.Errorf("value of %d = %v, want %s", k, values[k], name)
+		}
+	}
+	if len(loaded) != 1 || len(loaded[0]) != 2 || loaded[0][0] != 3 || loaded[0][1] != 4 {
+		t.Errorf("loaded keys = %v, want [[3 4]]", loaded)
+	}
+
+	// 3 was cached by the load, 4 is loaded again
+	loaded = nil
+	if _, err = r.GetMultiOrLoad(ctx, []int64{3, 4}, load); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || len(loaded[0]) != 1 || loaded[0][0] != 4 {
+		t.Errorf("loaded keys = %v, want [[4]]", loaded)
+	}
+}
@@ -0,0 +1,862 @@
+package valkeytest
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type commandSpec struct {
+	// arity follows valkey: a positive arity is exact, a negative one is a minimum,
+	// both counting the command name.
+	arity int
+	fn    func(ks *keyspace, args []string) any
+}
+
+func (c commandSpec) arityOk(n int) bool {
+	if c.arity >= 0 {
+		return n == c.arity
+	}
+	return n >= -c.arity
+}
+
+var commands map[string]commandSpec
+
+func init() {
+	commands = map[string]commandSpec{
+		"PING":             {-1, cmdPing},
+		"SELECT":           {2, func(ks *keyspace, args []string) any { return ok }},
+		"CLIENT":           {-2, func(ks *keyspace, args []string) any { return ok }},
+		"FLUSHALL":         {-1, cmdFlushAll},
+		"DBSIZE":           {1, cmdDbSize},
+		"GET":              {2, cmdGet},
+		"SET":              {-3, cmdSet},
+		"DEL":              {-2, cmdDel},
+		"EXISTS":           {-2, cmdExists},
+		"TYPE":             {2, cmdType},
+		"EXPIRE":           {-3, cmdExpire},
+		"PEXPIRE":          {-3, cmdExpire},
+		"TIME":             {1, cmdTime},
+		"TTL":              {2, cmdTtl},
+		"PTTL":             {2, cmdTtl},
+		"SCAN":             {-2, cmdScan},
+		"ZADD":             {-4, cmdZadd},
+		"ZRANGE":           {-4, cmdZrange},
+		"ZRANGEBYSCORE":    {-4, cmdZrangeByScore},
+		"ZREM":             {-3, cmdZrem},
+		"ZREMRANGEBYSCORE": {4, cmdZremRangeByScore},
+		"ZCARD":            {2, cmdZcard},
+		"ZSCORE":           {3, cmdZscore},
+		"SADD":             {-3, cmdSadd},
+		"SREM":             {-3, cmdSrem},
+		"SCARD":            {2, cmdScard},
+		"SMEMBERS":         {2, cmdSmembers},
+		"SISMEMBER":        {3, cmdSismember},
+		"SSCAN":            {-3, cmdSscan},
+		"HSET":             {-4, cmdHset},
+		"HGET":             {3, cmdHget},
+		"HDEL":             {-3, cmdHdel},
+		"HLEN":             {2, cmdHlen},
+		"XADD":             {-5, cmdXadd},
+		"XLEN":             {2, cmdXlen},
+		"XRANGE":           {-4, cmdXrange},
+		"EVAL":             {-3, cmdEval},
+		"EVALSHA":          {-3, cmdEval},
+		"SCRIPT":           {-2, cmdScript},
+	}
+}
+
+func cmdPing(ks *keyspace, args []string) any {
+	if len(args) > 1 {
+		return args[1]
+	}
+	return simpleString("PONG")
+}
+
+func cmdFlushAll(ks *keyspace, args []string) any {
+	for key := range ks.keys {
+		ks.del(key)
+	}
+	return ok
+}
+
+func cmdDbSize(ks *keyspace, args []string) any {
+	return int64(len(ks.sortedKeys()))
+}
+
+func cmdGet(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return null
+	}
+	if e.kind != kindString {
+		return errWrongType
+	}
+	return e.str
+}
+
+func cmdSet(ks *keyspace, args []string) any {
+	key, value := args[1], args[2]
+	var nx, xx, get, keepTtl bool
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTtl = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errorString("ERR invalid expire time in 'set' command")
+			}
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+
+	old := ks.get(key)
+	if old != nil && get && old.kind != kindString {
+		return errWrongType
+	}
+	var prev any = null
+	if old != nil && get {
+		prev = old.str
+	}
+	if (nx && old != nil) || (xx && old == nil) {
+		if get {
+			return prev
+		}
+		return null
+	}
+
+	e := &entry{kind: kindString, str: value}
+	if ttl > 0 {
+		e.expireAt = ks.now().Add(ttl)
+	} else if keepTtl && old != nil {
+		e.expireAt = old.expireAt
+	}
+	ks.keys[key] = e
+	ks.touch(key)
+	if get {
+		return prev
+	}
+	return ok
+}
+
+func cmdDel(ks *keyspace, args []string) any {
+	var n int64
+	for _, key := range args[1:] {
+		if ks.get(key) != nil && ks.del(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(ks *keyspace, args []string) any {
+	var n int64
+	for _, key := range args[1:] {
+		if ks.get(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return simpleString("none")
+	}
+	return simpleString(e.kind.String())
+}
+
+func cmdExpire(ks *keyspace, args []string) any {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	unit := time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	var nx, xx, gt, lt bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return errorf("ERR Unsupported option %s", opt)
+		}
+	}
+
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	at := ks.now().Add(time.Duration(n) * unit)
+	hasTtl := !e.expireAt.IsZero()
+	switch {
+	case nx && hasTtl,
+		xx && !hasTtl,
+		gt && (!hasTtl || !at.After(e.expireAt)),
+		lt && hasTtl && !at.Before(e.expireAt):
+		return int64(0)
+	}
+	if n <= 0 {
+		ks.del(args[1])
+		return int64(1)
+	}
+	e.expireAt = at
+	ks.touch(args[1])
+	return int64(1)
+}
+
+func cmdTime(ks *keyspace, args []string) any {
+	now := ks.now()
+	return []any{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+}
+
+func cmdTtl(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(-2)
+	}
+	if e.expireAt.IsZero() {
+		return int64(-1)
+	}
+	left := e.expireAt.Sub(ks.now())
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return left.Milliseconds()
+	}
+	return int64(math.Round(left.Seconds()))
+}
+
+// scanArgs parses the MATCH, COUNT and TYPE options of the SCAN family.
+func scanArgs(args []string) (match string, count int, typ string, err any) {
+	count = 10
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", 0, "", errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			n, e := strconv.Atoi(args[i+1])
+			if e != nil || n <= 0 {
+				return "", 0, "", errSyntax
+			}
+			count = n
+		case "TYPE":
+			typ = strings.ToLower(args[i+1])
+		default:
+			return "", 0, "", errSyntax
+		}
+	}
+	return match, count, typ, nil
+}
+
+// scanPage returns the page of sorted items starting at cursor. The cursor is the index
+// of the next item, which is stable as long as the items do not change.
+func scanPage(items []string, cursor int, count int, keep func(string) bool) any {
+	var page []string
+	i := cursor
+	for ; i < len(items) && i < cursor+count; i++ {
+		if keep(items[i]) {
+			page = append(page, items[i])
+		}
+	}
+	next := strconv.Itoa(i)
+	if i >= len(items) {
+		next = "0"
+	}
+	if page == nil {
+		page = []string{}
+	}
+	return []any{next, page}
+}
+
+// globMatch matches s against a pattern of valkey, where unlike path.Match '*' also
+// matches '/'.
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			var matched bool
+			matched, pattern = matchClass(pattern[1:], s[0])
+			if !matched {
+				return false
+			}
+			s = s[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass matches c against the character class at the start of pattern, just after
+// its '[', and returns the rest of the pattern after the closing ']'.
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// the closing ']'
+		pattern = pattern[1:]
+	}
+	return matched != negate, pattern
+}
+
+func cmdScan(ks *keyspace, args []string) any {
+	cursor, err := strconv.Atoi(args[1])
+	if err != nil || cursor < 0 {
+		return errorString("ERR invalid cursor")
+	}
+	match, count, typ, e := scanArgs(args[2:])
+	if e != nil {
+		return e
+	}
+	return scanPage(ks.sortedKeys(), cursor, count, func(key string) bool {
+		if !globMatch(match, key) {
+			return false
+		}
+		if typ != "" {
+			entry := ks.get(key)
+			return entry != nil && entry.kind.String() == typ
+		}
+		return true
+	})
+}
+
+func parseScore(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "+inf", "inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func cmdZadd(ks *keyspace, args []string) any {
+	var nx, xx, gt, lt, ch bool
+	i := 2
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			return errorString("ERR INCR is not supported by valkeytest")
+		default:
+			break loop
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) || (nx && (gt || lt)) {
+		return errSyntax
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		f, ok := parseScore(pairs[j])
+		if !ok {
+			return errNotFloat
+		}
+		scores = append(scores, f)
+	}
+
+	if e := ks.get(args[1]); e != nil && e.kind != kindZset {
+		return errWrongType
+	}
+	if xx && ks.get(args[1]) == nil {
+		return int64(0)
+	}
+	e := ks.getOrCreate(args[1], kindZset)
+
+	var added, changed int64
+	for j := 0; j < len(pairs); j += 2 {
+		member, score := pairs[j+1], scores[j/2]
+		old, exists := e.zset[member]
+		switch {
+		case exists && nx, !exists && xx:
+			continue
+		case exists && gt && score <= old, exists && lt && score >= old:
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		e.zset[member] = score
+	}
+	ks.removeIfEmpty(args[1], e)
+	if added+changed > 0 {
+		ks.touch(args[1])
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZrange(ks *keyspace, args []string) any {
+	var byScore, rev, withScores, limit bool
+	var offset, count int
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			byScore = true
+		case "BYLEX":
+			return errorString("ERR BYLEX is not supported by valkeytest")
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return errNotInt
+			}
+			limit = true
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	if limit && !byScore {
+		return errorString("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+
+	e := ks.get(args[1])
+	if e == nil {
+		return []any{}
+	}
+	if e.kind != kindZset {
+		return errWrongType
+	}
+	members := sortedZset(e.zset)
+	if rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+
+	var selected []scoredMember
+	if byScore {
+		minArg, maxArg := args[2], args[3]
+		if rev {
+			minArg, maxArg = maxArg, minArg
+		}
+		min, minExcl, ok1 := parseRangeScore(minArg)
+		max, maxExcl, ok2 := parseRangeScore(maxArg)
+		if !ok1 || !ok2 {
+			return errorString("ERR min or max is not a float")
+		}
+		for _, m := range members {
+			if m.score < min || (minExcl && m.score == min) || m.score > max || (maxExcl && m.score == max) {
+				continue
+			}
+			selected = append(selected, m)
+		}
+		if limit {
+			if offset < 0 || offset >= len(selected) {
+				selected = nil
+			} else {
+				selected = selected[offset:]
+				if count >= 0 && count < len(selected) {
+					selected = selected[:count]
+				}
+			}
+		}
+	} else {
+		start, err1 := strconv.Atoi(args[2])
+		stop, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			return errNotInt
+		}
+		n := len(members)
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= n {
+			stop = n - 1
+		}
+		if start <= stop {
+			selected = members[start : stop+1]
+		}
+	}
+
+	res := make([]any, 0, len(selected))
+	for _, m := range selected {
+		if withScores {
+			res = append(res, []any{m.member, double(m.score)})
+			continue
+		}
+		res = append(res, m.member)
+	}
+	return res
+}
+
+// cmdZrangeByScore runs ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count] as
+// ZRANGE key min max BYSCORE.
+func cmdZrangeByScore(ks *keyspace, args []string) any {
+	zrange := append([]string{"ZRANGE", args[1], args[2], args[3], "BYSCORE"}, args[4:]...)
+	return cmdZrange(ks, zrange)
+}
+
+func cmdZremRangeByScore(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindZset {
+		return errWrongType
+	}
+	min, minExcl, ok1 := parseRangeScore(args[2])
+	max, maxExcl, ok2 := parseRangeScore(args[3])
+	if !ok1 || !ok2 {
+		return errorString("ERR min or max is not a float")
+	}
+	var n int64
+	for m, score := range e.zset {
+		if score < min || (minExcl && score == min) || score > max || (maxExcl && score == max) {
+			continue
+		}
+		delete(e.zset, m)
+		n++
+	}
+	if n > 0 {
+		ks.removeIfEmpty(args[1], e)
+		ks.touch(args[1])
+	}
+	return n
+}
+
+func parseRangeScore(s string) (float64, bool, bool) {
+	excl := strings.HasPrefix(s, "(")
+	f, ok := parseScore(strings.TrimPrefix(s, "("))
+	return f, excl, ok
+}
+
+func cmdZrem(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindZset {
+		return errWrongType
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	if n > 0 {
+		ks.removeIfEmpty(args[1], e)
+		ks.touch(args[1])
+	}
+	return n
+}
+
+func cmdZcard(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindZset {
+		return errWrongType
+	}
+	return int64(len(e.zset))
+}
+
+func cmdZscore(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return null
+	}
+	if e.kind != kindZset {
+		return errWrongType
+	}
+	score, ok := e.zset[args[2]]
+	if !ok {
+		return null
+	}
+	return double(score)
+}
+
+func cmdSadd(ks *keyspace, args []string) any {
+	e := ks.getOrCreate(args[1], kindSet)
+	if e == nil {
+		return errWrongType
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := e.set[m]; !ok {
+			e.set[m] = struct{}{}
+			n++
+		}
+	}
+	if n > 0 {
+		ks.touch(args[1])
+	}
+	return n
+}
+
+func cmdSrem(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindSet {
+		return errWrongType
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := e.set[m]; ok {
+			delete(e.set, m)
+			n++
+		}
+	}
+	if n > 0 {
+		ks.removeIfEmpty(args[1], e)
+		ks.touch(args[1])
+	}
+	return n
+}
+
+func cmdScard(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindSet {
+		return errWrongType
+	}
+	return int64(len(e.set))
+}
+
+func cmdSmembers(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return []string{}
+	}
+	if e.kind != kindSet {
+		return errWrongType
+	}
+	return sortedSet(e.set)
+}
+
+func cmdSismember(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindSet {
+		return errWrongType
+	}
+	if _, ok := e.set[args[2]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func cmdSscan(ks *keyspace, args []string) any {
+	cursor, err := strconv.Atoi(args[2])
+	if err != nil || cursor < 0 {
+		return errorString("ERR invalid cursor")
+	}
+	match, count, typ, e := scanArgs(args[3:])
+	if e != nil {
+		return e
+	}
+	if typ != "" {
+		return errSyntax
+	}
+	entry := ks.get(args[1])
+	if entry == nil {
+		return []any{"0", []string{}}
+	}
+	if entry.kind != kindSet {
+		return errWrongType
+	}
+	return scanPage(sortedSet(entry.set), cursor, count, func(m string) bool {
+		return globMatch(match, m)
+	})
+}
+
+func cmdHset(ks *keyspace, args []string) any {
+	if len(args)%2 != 0 {
+		return wrongArgs(args[0])
+	}
+	e := ks.getOrCreate(args[1], kindHash)
+	if e == nil {
+		return errWrongType
+	}
+	var n int64
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := e.hash[args[i]]; !ok {
+			n++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	ks.touch(args[1])
+	return n
+}
+
+func cmdHget(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return null
+	}
+	if e.kind != kindHash {
+		return errWrongType
+	}
+	v, ok := e.hash[args[2]]
+	if !ok {
+		return null
+	}
+	return v
+}
+
+func cmdHdel(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindHash {
+		return errWrongType
+	}
+	var n int64
+	for _, f := range args[2:] {
+		if _, ok := e.hash[f]; ok {
+			delete(e.hash, f)
+			n++
+		}
+	}
+	if n > 0 {
+		ks.removeIfEmpty(args[1], e)
+		ks.touch(args[1])
+	}
+	return n
+}
+
+func cmdHlen(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindHash {
+		return errWrongType
+	}
+	return int64(len(e.hash))
+}
@@ -0,0 +1,94 @@
+package valkeytest
+
+import (
+	"strings"
+)
+
+// Fault is what the server does instead of executing a command.
+type Fault struct {
+	// Err is replied in place of the result of the command, such as "ERR injected".
+	Err string
+	// Drop closes the connection without replying.
+	Drop bool
+}
+
+type faultRule struct {
+	fault Fault
+	// times is the number of commands left to fail; a negative value never runs out.
+	times int
+}
+
+// SetFault calls fn before executing each command, failing the command with the
+// returned Fault unless it is nil. It replaces faults set by FailCommand and DropCommand.
+func (s *Server) SetFault(fn func(cmd []string) *Fault) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.fault = fn
+	s.faultRules = nil
+}
+
+// FailCommand makes the next times calls of the command name reply msg, or every call
+// if times is negative.
+func (s *Server) FailCommand(name string, msg string, times int) {
+	s.addFaultRule(name, faultRule{fault: Fault{Err: msg}, times: times})
+}
+
+// DropCommand makes the next times calls of the command name close their connection,
+// or every call if times is negative.
+func (s *Server) DropCommand(name string, times int) {
+	s.addFaultRule(name, faultRule{fault: Fault{Drop: true}, times: times})
+}
+
+// ClearFaults removes every fault.
+func (s *Server) ClearFaults() {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.fault = nil
+	s.faultRules = nil
+}
+
+// DropConnections closes the connection of every client. Clients are still able to
+// reconnect.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.nc.Close()
+	}
+}
+
+func (s *Server) addFaultRule(name string, rule faultRule) {
+	if rule.times == 0 {
+		return
+	}
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.fault = nil
+	if s.faultRules == nil {
+		s.faultRules = make(map[string]*faultRule)
+	}
+	s.faultRules[strings.ToUpper(name)] = &rule
+}
+
+// faultFor returns the fault to inject for cmd, if any.
+func (s *Server) faultFor(cmd []string) *Fault {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	if s.fault != nil {
+		return s.fault(cmd)
+	}
+
+	name := strings.ToUpper(cmd[0])
+	rule, ok := s.faultRules[name]
+	if !ok {
+		return nil
+	}
+	if rule.times > 0 {
+		rule.times--
+		if rule.times == 0 {
+			delete(s.faultRules, name)
+		}
+	}
+	f := rule.fault
+	return &f
+}
@@ -0,0 +1,151 @@
+package valkeytest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Reply values written back to clients. Plain Go values are used where the RESP type
+// is unambiguous: int64 is an integer, string a bulk string and []any an array.
+type (
+	simpleString string
+	errorString  string
+	double       float64
+	nilReply     struct{}
+	pushReply    []any
+	mapReply     []any // key, value, key, value...
+)
+
+var (
+	ok     = simpleString("OK")
+	queued = simpleString("QUEUED")
+	null   = nilReply{}
+)
+
+func errorf(format string, args ...any) errorString {
+	return errorString(fmt.Sprintf(format, args...))
+}
+
+func wrongArgs(cmd string) errorString {
+	return errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+var (
+	errSyntax    = errorString("ERR syntax error")
+	errWrongType = errorString("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errorString("ERR value is not an integer or out of range")
+	errNotFloat  = errorString("ERR value is not a valid float")
+)
+
+// readCommand reads a command sent as an array of bulk strings, or as an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid multibulk length: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected bulk string: %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk length: %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+// writeReply serializes v in RESP3, or in RESP2 if resp3 is false.
+func writeReply(w *bufio.Writer, v any, resp3 bool) {
+	switch v := v.(type) {
+	case simpleString:
+		w.WriteString("+" + string(v) + "\r\n")
+	case errorString:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case double:
+		s := strconv.FormatFloat(float64(v), 'f', -1, 64)
+		if resp3 {
+			w.WriteString("," + s + "\r\n")
+		} else {
+			w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+		}
+	case nilReply:
+		if resp3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(w, e, resp3)
+		}
+	case []string:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(w, e, resp3)
+		}
+	case pushReply:
+		if resp3 {
+			w.WriteString(">" + strconv.Itoa(len(v)) + "\r\n")
+		} else {
+			w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		}
+		for _, e := range v {
+			writeReply(w, e, resp3)
+		}
+	case mapReply:
+		if resp3 {
+			w.WriteString("%" + strconv.Itoa(len(v)/2) + "\r\n")
+		} else {
+			w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		}
+		for _, e := range v {
+			writeReply(w, e, resp3)
+		}
+	default:
+		panic(fmt.Sprintf("valkeytest: unsupported reply type %T", v))
+	}
+}
@@ -0,0 +1,276 @@
+package valkeytest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// scriptSha returns the name of src in EVALSHA.
+func scriptSha(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func cmdEval(ks *keyspace, args []string) any {
+	src := args[1]
+	if strings.ToUpper(args[0]) == "EVALSHA" {
+		var ok bool
+		if src, ok = ks.scripts[strings.ToLower(args[1])]; !ok {
+			return errorString("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	} else {
+		ks.scripts[scriptSha(src)] = src
+	}
+
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 {
+		return errorString("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-3 {
+		return errorString("ERR Number of keys can't be greater than number of args")
+	}
+	return runScript(ks, src, args[3:3+numKeys], args[3+numKeys:])
+}
+
+func cmdScript(ks *keyspace, args []string) any {
+	switch strings.ToUpper(args[1]) {
+	case "LOAD":
+		if len(args) != 3 {
+			return wrongArgs("script|load")
+		}
+		sha := scriptSha(args[2])
+		ks.scripts[sha] = args[2]
+		return sha
+	case "EXISTS":
+		res := make([]any, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			if _, ok := ks.scripts[strings.ToLower(sha)]; ok {
+				res = append(res, int64(1))
+			} else {
+				res = append(res, int64(0))
+			}
+		}
+		return res
+	case "FLUSH":
+		ks.scripts = make(map[string]string)
+		return ok
+	default:
+		return errSyntax
+	}
+}
+
+// runScript runs a script the way valkey does, with the commands it calls executed on ks
+// in between no other command, and their replies converted as in RESP2.
+func runScript(ks *keyspace, src string, keys, argv []string) any {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	L.SetGlobal("KEYS", luaStrings(L, keys))
+	L.SetGlobal("ARGV", luaStrings(L, argv))
+	redis := L.NewTable()
+	L.SetField(redis, "call", L.NewFunction(func(L *lua.LState) int { return scriptCall(L, ks, true) }))
+	L.SetField(redis, "pcall", L.NewFunction(func(L *lua.LState) int { return scriptCall(L, ks, false) }))
+	L.SetField(redis, "status_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		L.SetField(t, "ok", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetField(redis, "error_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		L.SetField(t, "err", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetGlobal("redis", redis)
+
+	fn, err := L.LoadString(src)
+	if err != nil {
+		return errorf("ERR Error compiling script: %v", err)
+	}
+	L.Push(fn)
+	if err = L.PCall(0, 1, nil); err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			// errors of redis.call are raised without the position, like valkey replies them
+			if msg, ok := apiErr.Object.(lua.LString); ok {
+				return errorString(msg)
+			}
+		}
+		return errorf("ERR Error running script: %v", err)
+	}
+	return fromLua(L.Get(-1))
+}
+
+// scriptCall executes the command given to redis.call or redis.pcall. An error reply is
+// raised by redis.call and returned as {err = ...} by redis.pcall.
+func scriptCall(L *lua.LState, ks *keyspace, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+	}
+	cmd := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			cmd[i-1] = string(v)
+		case lua.LNumber:
+			cmd[i-1] = formatLuaNumber(float64(v))
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+
+	name := strings.ToUpper(cmd[0])
+	var reply any
+	spec, ok := commands[name]
+	switch {
+	case !ok || name == "EVAL" || name == "EVALSHA" || name == "SCRIPT":
+		reply = errorString("ERR Unknown Redis command called from script")
+	case !spec.arityOk(len(cmd)):
+		reply = wrongArgs(name)
+	default:
+		reply = spec.fn(ks, cmd)
+	}
+
+	if e, failed := reply.(errorString); failed {
+		if raise {
+			L.Error(lua.LString(e), 0)
+			return 0
+		}
+		t := L.NewTable()
+		L.SetField(t, "err", lua.LString(e))
+		L.Push(t)
+		return 1
+	}
+	if withScores(cmd) {
+		reply = flattenPairs(reply)
+	}
+	L.Push(toLua(L, reply))
+	return 1
+}
+
+// formatLuaNumber formats a number argument like valkey, as an integer if it is one.
+func formatLuaNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// withScores reports whether cmd asks for the scores of a sorted set range, which RESP2
+// replies as a flat array instead of pairs.
+func withScores(cmd []string) bool {
+	for _, arg := range cmd[1:] {
+		if strings.EqualFold(arg, "WITHSCORES") {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenPairs(reply any) any {
+	pairs, ok := reply.([]any)
+	if !ok {
+		return reply
+	}
+	flat := make([]any, 0, len(pairs)*2)
+	for _, p := range pairs {
+		if pair, ok := p.([]any); ok {
+			flat = append(flat, pair...)
+		} else {
+			flat = append(flat, p)
+		}
+	}
+	return flat
+}
+
+func luaStrings(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// toLua converts a reply to the value redis.call returns.
+func toLua(L *lua.LState, reply any) lua.LValue {
+	switch v := reply.(type) {
+	case int64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case simpleString:
+		t := L.NewTable()
+		L.SetField(t, "ok", lua.LString(v))
+		return t
+	case double:
+		return lua.LString(formatScore(float64(v)))
+	case nilReply:
+		return lua.LFalse
+	case []string:
+		return luaStrings(L, v)
+	case []any:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(toLua(L, e))
+		}
+		return t
+	case mapReply:
+		return toLua(L, []any(v))
+	default:
+		return lua.LFalse
+	}
+}
+
+// fromLua converts the value returned by a script to its reply.
+func fromLua(v lua.LValue) any {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		if v {
+			return int64(1)
+		}
+		return null
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return errorString(e)
+		}
+		if s, ok := v.RawGetString("ok").(lua.LString); ok {
+			return simpleString(s)
+		}
+		// an array ends at its first nil
+		res := []any{}
+		for i := 1; ; i++ {
+			e := v.RawGetInt(i)
+			if e == lua.LNil {
+				return res
+			}
+			res = append(res, fromLua(e))
+		}
+	default:
+		return null
+	}
+}
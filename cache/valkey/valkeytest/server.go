@@ -0,0 +1,439 @@
+package valkeytest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server is an in-memory server speaking RESP2 and RESP3, implementing the subset of
+// valkey commands used by the cache packages. Commands are executed one at a time like
+// in valkey, so MULTI/EXEC and WATCH behave atomically.
+type Server struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	ks       *keyspace
+	conns    map[*conn]struct{}
+	channels map[string]map[*conn]struct{}
+
+	// tracking holds the connections tracking each key for client side caching.
+	tracking map[string]map[*conn]struct{}
+
+	hooksMu    sync.RWMutex
+	delay      func(cmd []string) time.Duration
+	fault      func(cmd []string) *Fault
+	faultRules map[string]*faultRule
+
+	nextId atomic.Int64
+	wg     sync.WaitGroup
+	closed atomic.Bool
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		ks:       newKeyspace(time.Now),
+		conns:    make(map[*conn]struct{}),
+		channels: make(map[string]map[*conn]struct{}),
+		tracking: make(map[string]map[*conn]struct{}),
+	}
+	s.ks.onTouch = s.invalidate
+
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// SetDelay makes the server sleep for the returned duration before executing each
+// command, which widens the windows in which concurrent clients interleave.
+// The delay is applied per connection, so it does not slow down other clients.
+func (s *Server) SetDelay(fn func(cmd []string) time.Duration) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.delay = fn
+}
+
+// FlushAll removes every key.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.ks.keys {
+		s.ks.del(key)
+	}
+}
+
+func (s *Server) Close() error {
+	if !s.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{
+			s:        s,
+			id:       s.nextId.Add(1),
+			nc:       nc,
+			w:        bufio.NewWriter(nc),
+			channels: make(map[string]struct{}),
+		}
+
+		s.mu.Lock()
+		if s.closed.Load() {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go c.serve()
+	}
+}
+
+func (s *Server) delayFor(cmd []string) time.Duration {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	if s.delay == nil {
+		return 0
+	}
+	return s.delay(cmd)
+}
+
+type conn struct {
+	s  *Server
+	id int64
+	nc net.Conn
+
+	wmu   sync.Mutex
+	w     *bufio.Writer
+	resp3 bool
+
+	// transaction state
+	multi   bool
+	dirty   bool
+	queued  [][]string
+	watched map[string]uint64
+
+	channels map[string]struct{}
+
+	// client side caching state
+	tracking bool
+	caching  bool
+	tracked  map[string]struct{}
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer c.close()
+
+	r := bufio.NewReader(c.nc)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(cmd) == 0 {
+			continue
+		}
+
+		if d := c.s.delayFor(cmd); d > 0 {
+			time.Sleep(d)
+		}
+
+		c.s.mu.Lock()
+		var replies []any
+		if f := c.s.faultFor(cmd); f == nil {
+			replies = c.handle(cmd)
+		} else if f.Drop {
+			c.s.mu.Unlock()
+			return
+		} else {
+			// like any command rejected while queuing, a failure aborts the transaction
+			switch strings.ToUpper(cmd[0]) {
+			case "EXEC", "DISCARD":
+				c.resetTx()
+			default:
+				c.dirty = c.dirty || c.multi
+			}
+			replies = []any{errorString(f.Err)}
+		}
+		c.s.mu.Unlock()
+
+		c.wmu.Lock()
+		for _, reply := range replies {
+			writeReply(c.w, reply, c.resp3)
+		}
+		// flush once a pipeline has been drained
+		if r.Buffered() == 0 {
+			err = c.w.Flush()
+		}
+		c.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.nc.Close()
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for ch := range c.channels {
+		c.s.unsubscribe(c, ch)
+	}
+	c.untrackAll()
+	delete(c.s.conns, c)
+}
+
+// push writes an out of band message, such as a published message, to the client.
+func (c *conn) push(v pushReply) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	writeReply(c.w, v, c.resp3)
+	c.w.Flush()
+}
+
+// handle executes cmd and returns its replies. It must be called with s.mu held.
+func (c *conn) handle(cmd []string) []any {
+	replies := c.dispatch(cmd)
+	// CLIENT CACHING YES applies to the next command, or to the next transaction
+	if name := strings.ToUpper(cmd[0]); name != "CLIENT" && !c.multi {
+		c.caching = false
+	}
+	return replies
+}
+
+func (c *conn) dispatch(cmd []string) []any {
+	name := strings.ToUpper(cmd[0])
+
+	if c.multi {
+		switch name {
+		case "EXEC", "DISCARD", "MULTI", "WATCH":
+		default:
+			spec, ok := commands[name]
+			if !ok {
+				c.dirty = true
+				return []any{errorf("ERR unknown command '%s'", cmd[0])}
+			}
+			if !spec.arityOk(len(cmd)) {
+				c.dirty = true
+				return []any{wrongArgs(name)}
+			}
+			c.queued = append(c.queued, cmd)
+			return []any{queued}
+		}
+	}
+
+	switch name {
+	case "HELLO":
+		return []any{c.hello(cmd)}
+	case "CLIENT":
+		return []any{c.client(cmd)}
+	case "MULTI":
+		if c.multi {
+			return []any{errorString("ERR MULTI calls can not be nested")}
+		}
+		c.multi = true
+		return []any{ok}
+	case "EXEC":
+		return []any{c.exec()}
+	case "DISCARD":
+		if !c.multi {
+			return []any{errorString("ERR DISCARD without MULTI")}
+		}
+		c.resetTx()
+		return []any{ok}
+	case "WATCH":
+		if c.multi {
+			return []any{errorString("ERR WATCH inside MULTI is not allowed")}
+		}
+		if len(cmd) < 2 {
+			return []any{wrongArgs(name)}
+		}
+		if c.watched == nil {
+			c.watched = make(map[string]uint64)
+		}
+		for _, key := range cmd[1:] {
+			if _, ok := c.watched[key]; !ok {
+				c.watched[key] = c.s.ks.version(key)
+			}
+		}
+		return []any{ok}
+	case "UNWATCH":
+		c.watched = nil
+		return []any{ok}
+	case "SUBSCRIBE":
+		if len(cmd) < 2 {
+			return []any{wrongArgs(name)}
+		}
+		replies := make([]any, 0, len(cmd)-1)
+		for _, ch := range cmd[1:] {
+			c.s.subscribe(c, ch)
+			replies = append(replies, pushReply{"subscribe", ch, int64(len(c.channels))})
+		}
+		return replies
+	case "UNSUBSCRIBE":
+		channels := cmd[1:]
+		if len(channels) == 0 {
+			for ch := range c.channels {
+				channels = append(channels, ch)
+			}
+		}
+		if len(channels) == 0 {
+			return []any{pushReply{"unsubscribe", null, int64(0)}}
+		}
+		replies := make([]any, 0, len(channels))
+		for _, ch := range channels {
+			c.s.unsubscribe(c, ch)
+			replies = append(replies, pushReply{"unsubscribe", ch, int64(len(c.channels))})
+		}
+		return replies
+	case "PUNSUBSCRIBE", "SUNSUBSCRIBE":
+		return []any{pushReply{strings.ToLower(name), null, int64(len(c.channels))}}
+	case "PUBLISH":
+		if len(cmd) != 3 {
+			return []any{wrongArgs(name)}
+		}
+		return []any{c.s.publish(cmd[1], cmd[2])}
+	}
+
+	return []any{c.execute(cmd)}
+}
+
+// execute runs a data command, tracking the key it reads if client side caching asks for it.
+func (c *conn) execute(cmd []string) any {
+	reply := c.s.execute(cmd)
+	if c.caching && trackable[strings.ToUpper(cmd[0])] && len(cmd) > 1 {
+		if _, failed := reply.(errorString); !failed {
+			c.track(cmd[1])
+		}
+	}
+	return reply
+}
+
+func (c *conn) hello(cmd []string) any {
+	proto := int64(2)
+	if c.resp3 {
+		proto = 3
+	}
+	if len(cmd) > 1 {
+		switch cmd[1] {
+		case "2":
+			proto = 2
+		case "3":
+			proto = 3
+		default:
+			return errorString("NOPROTO unsupported protocol version")
+		}
+	}
+	c.resp3 = proto == 3
+	return mapReply{
+		"server", "valkey",
+		"version", "7.2.4",
+		"proto", proto,
+		"id", c.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", []any{},
+	}
+}
+
+func (c *conn) exec() any {
+	if !c.multi {
+		return errorString("ERR EXEC without MULTI")
+	}
+	defer c.resetTx()
+
+	if c.dirty {
+		return errorString("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for key, v := range c.watched {
+		if c.s.ks.version(key) != v {
+			return null
+		}
+	}
+
+	replies := make([]any, 0, len(c.queued))
+	for _, cmd := range c.queued {
+		replies = append(replies, c.execute(cmd))
+	}
+	return replies
+}
+
+func (c *conn) resetTx() {
+	c.multi = false
+	c.dirty = false
+	c.queued = nil
+	c.watched = nil
+}
+
+func (s *Server) execute(cmd []string) any {
+	name := strings.ToUpper(cmd[0])
+	spec, ok := commands[name]
+	if !ok {
+		return errorf("ERR unknown command '%s'", cmd[0])
+	}
+	if !spec.arityOk(len(cmd)) {
+		return wrongArgs(name)
+	}
+	return spec.fn(s.ks, cmd)
+}
+
+func (s *Server) subscribe(c *conn, ch string) {
+	subs, ok := s.channels[ch]
+	if !ok {
+		subs = make(map[*conn]struct{})
+		s.channels[ch] = subs
+	}
+	subs[c] = struct{}{}
+	c.channels[ch] = struct{}{}
+}
+
+func (s *Server) unsubscribe(c *conn, ch string) {
+	delete(c.channels, ch)
+	if subs, ok := s.channels[ch]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(s.channels, ch)
+		}
+	}
+}
+
+func (s *Server) publish(ch string, msg string) any {
+	subs := s.channels[ch]
+	for c := range subs {
+		c.push(pushReply{"message", ch, msg})
+	}
+	return int64(len(subs))
+}
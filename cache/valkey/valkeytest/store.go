@@ -0,0 +1,172 @@
+package valkeytest
+
+import (
+	"sort"
+	"time"
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindZset
+	kindSet
+	kindHash
+	kindStream
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindZset:
+		return "zset"
+	case kindSet:
+		return "set"
+	case kindHash:
+		return "hash"
+	case kindStream:
+		return "stream"
+	default:
+		return "string"
+	}
+}
+
+type entry struct {
+	kind     kind
+	str      string
+	zset     map[string]float64
+	set      map[string]struct{}
+	hash     map[string]string
+	stream   stream
+	expireAt time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// keyspace holds the data of the server. It is not safe for concurrent use; the server
+// serializes commands the same way valkey does.
+type keyspace struct {
+	keys map[string]*entry
+	// versions is bumped on every modification of a key, which is what WATCH observes.
+	versions map[string]uint64
+	now      func() time.Time
+	// onTouch is called with every modified key.
+	onTouch func(key string)
+	// scripts are the scripts loaded for EVALSHA by their sha1, which FLUSHALL keeps.
+	scripts map[string]string
+}
+
+func newKeyspace(now func() time.Time) *keyspace {
+	return &keyspace{
+		keys:     make(map[string]*entry),
+		versions: make(map[string]uint64),
+		now:      now,
+		scripts:  make(map[string]string),
+	}
+}
+
+// get returns the live entry of key, removing it first if it has expired.
+func (ks *keyspace) get(key string) *entry {
+	e, ok := ks.keys[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(ks.now()) {
+		ks.del(key)
+		return nil
+	}
+	return e
+}
+
+// getOrCreate returns the entry of key, creating an empty one of kind k if missing.
+// It returns nil if key holds a value of another kind.
+func (ks *keyspace) getOrCreate(key string, k kind) *entry {
+	e := ks.get(key)
+	if e == nil {
+		e = &entry{kind: k}
+		switch k {
+		case kindZset:
+			e.zset = make(map[string]float64)
+		case kindSet:
+			e.set = make(map[string]struct{})
+		case kindHash:
+			e.hash = make(map[string]string)
+		}
+		ks.keys[key] = e
+		return e
+	}
+	if e.kind != k {
+		return nil
+	}
+	return e
+}
+
+func (ks *keyspace) del(key string) bool {
+	if _, ok := ks.keys[key]; !ok {
+		return false
+	}
+	delete(ks.keys, key)
+	ks.touch(key)
+	return true
+}
+
+func (ks *keyspace) touch(key string) {
+	ks.versions[key]++
+	if ks.onTouch != nil {
+		ks.onTouch(key)
+	}
+}
+
+func (ks *keyspace) version(key string) uint64 {
+	// an expired key counts as modified
+	ks.get(key)
+	return ks.versions[key]
+}
+
+// removeIfEmpty deletes a collection once its last member is gone, as valkey does.
+func (ks *keyspace) removeIfEmpty(key string, e *entry) {
+	if (e.kind == kindZset && len(e.zset) == 0) || (e.kind == kindSet && len(e.set) == 0) ||
+		(e.kind == kindHash && len(e.hash) == 0) {
+		delete(ks.keys, key)
+	}
+}
+
+func (ks *keyspace) sortedKeys() []string {
+	keys := make([]string, 0, len(ks.keys))
+	for k, e := range ks.keys {
+		if !e.expired(ks.now()) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type scoredMember struct {
+	member string
+	score  float64
+}
+
+func sortedZset(z map[string]float64) []scoredMember {
+	members := make([]scoredMember, 0, len(z))
+	for m, s := range z {
+		members = append(members, scoredMember{member: m, score: s})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func sortedSet(s map[string]struct{}) []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
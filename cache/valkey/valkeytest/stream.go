@@ -0,0 +1,164 @@
+package valkeytest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// streamId is the id of a stream entry, its milliseconds and sequence number.
+type streamId struct {
+	ms, seq uint64
+}
+
+func (id streamId) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamId) less(o streamId) bool {
+	return id.ms < o.ms || (id.ms == o.ms && id.seq < o.seq)
+}
+
+// parseStreamId parses an id of XRANGE, where a missing sequence number is seq.
+func parseStreamId(v string, seq uint64) (streamId, bool) {
+	ms, s, found := strings.Cut(v, "-")
+	id := streamId{seq: seq}
+	var err error
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return streamId{}, false
+	}
+	if found {
+		if id.seq, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return streamId{}, false
+		}
+	}
+	return id, true
+}
+
+type streamEntry struct {
+	id     streamId
+	fields []string
+}
+
+// stream is the value of a stream key, its entries in the order of their ids.
+type stream struct {
+	entries []streamEntry
+	lastId  streamId
+}
+
+func cmdXadd(ks *keyspace, args []string) any {
+	key := args[1]
+	var noMkStream bool
+	maxLen := -1
+	i := 2
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			continue
+		case "MAXLEN":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				i++
+			}
+			if i >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return errNotInt
+			}
+			maxLen = n
+			continue
+		}
+		break
+	}
+	fields := args[min(i+1, len(args)):]
+	if i >= len(args) || len(fields) == 0 || len(fields)%2 != 0 {
+		return wrongArgs("xadd")
+	}
+
+	if noMkStream && ks.get(key) == nil {
+		return null
+	}
+	e := ks.getOrCreate(key, kindStream)
+	if e == nil {
+		return errWrongType
+	}
+	id := streamId{ms: uint64(ks.now().UnixMilli())}
+	if args[i] == "*" {
+		if !e.stream.lastId.less(id) {
+			id = streamId{ms: e.stream.lastId.ms, seq: e.stream.lastId.seq + 1}
+		}
+	} else {
+		var ok bool
+		if id, ok = parseStreamId(args[i], 0); !ok {
+			return errorString("ERR Invalid stream ID specified as stream command argument")
+		}
+		if !e.stream.lastId.less(id) {
+			return errorString("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+	e.stream.entries = append(e.stream.entries, streamEntry{id: id, fields: append([]string(nil), fields...)})
+	e.stream.lastId = id
+	if maxLen >= 0 && len(e.stream.entries) > maxLen {
+		e.stream.entries = e.stream.entries[len(e.stream.entries)-maxLen:]
+	}
+	ks.touch(key)
+	return id.String()
+}
+
+func cmdXlen(ks *keyspace, args []string) any {
+	e := ks.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	if e.kind != kindStream {
+		return errWrongType
+	}
+	return int64(len(e.stream.entries))
+}
+
+func cmdXrange(ks *keyspace, args []string) any {
+	start, end := streamId{}, streamId{ms: ^uint64(0), seq: ^uint64(0)}
+	var ok bool
+	if args[2] != "-" {
+		if start, ok = parseStreamId(args[2], 0); !ok {
+			return errorString("ERR Invalid stream ID specified as stream command argument")
+		}
+	}
+	if args[3] != "+" {
+		if end, ok = parseStreamId(args[3], ^uint64(0)); !ok {
+			return errorString("ERR Invalid stream ID specified as stream command argument")
+		}
+	}
+	count := -1
+	if len(args) > 4 {
+		if len(args) != 6 || strings.ToUpper(args[4]) != "COUNT" {
+			return errSyntax
+		}
+		n, err := strconv.Atoi(args[5])
+		if err != nil {
+			return errNotInt
+		}
+		count = n
+	}
+
+	res := []any{}
+	e := ks.get(args[1])
+	if e == nil {
+		return res
+	}
+	if e.kind != kindStream {
+		return errWrongType
+	}
+	for _, se := range e.stream.entries {
+		if count >= 0 && len(res) == count {
+			break
+		}
+		if se.id.less(start) || end.less(se.id) {
+			continue
+		}
+		res = append(res, []any{se.id.String(), append([]string(nil), se.fields...)})
+	}
+	return res
+}
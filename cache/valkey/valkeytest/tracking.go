@@ -0,0 +1,104 @@
+package valkeytest
+
+import (
+	"strings"
+)
+
+// trackable lists the read commands whose key is tracked for client side caching.
+var trackable = map[string]bool{
+	"GET":       true,
+	"EXISTS":    true,
+	"TYPE":      true,
+	"TTL":       true,
+	"PTTL":      true,
+	"ZRANGE":    true,
+	"ZCARD":     true,
+	"ZSCORE":    true,
+	"SCARD":     true,
+	"SMEMBERS":  true,
+	"SISMEMBER": true,
+}
+
+// client handles the CLIENT subcommands that depend on the connection.
+func (c *conn) client(cmd []string) any {
+	if len(cmd) < 2 {
+		return wrongArgs("client")
+	}
+	switch strings.ToUpper(cmd[1]) {
+	case "ID":
+		return c.id
+	case "TRACKING":
+		if len(cmd) < 3 {
+			return wrongArgs("client|tracking")
+		}
+		switch strings.ToUpper(cmd[2]) {
+		case "ON":
+			if !c.resp3 {
+				return errorString("ERR Keys tracking without RESP3 redirection is not supported by valkeytest")
+			}
+			for _, opt := range cmd[3:] {
+				if strings.ToUpper(opt) != "OPTIN" {
+					return errorf("ERR Unsupported tracking option %s", opt)
+				}
+			}
+			c.tracking = true
+		case "OFF":
+			c.tracking = false
+			c.caching = false
+			c.untrackAll()
+		default:
+			return errSyntax
+		}
+		return ok
+	case "CACHING":
+		if !c.tracking {
+			return errorString("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+		}
+		if len(cmd) != 3 {
+			return wrongArgs("client|caching")
+		}
+		c.caching = strings.ToUpper(cmd[2]) == "YES"
+		return ok
+	default:
+		return ok
+	}
+}
+
+func (c *conn) track(key string) {
+	conns, ok := c.s.tracking[key]
+	if !ok {
+		conns = make(map[*conn]struct{})
+		c.s.tracking[key] = conns
+	}
+	conns[c] = struct{}{}
+	if c.tracked == nil {
+		c.tracked = make(map[string]struct{})
+	}
+	c.tracked[key] = struct{}{}
+}
+
+func (c *conn) untrackAll() {
+	for key := range c.tracked {
+		if conns, ok := c.s.tracking[key]; ok {
+			delete(conns, c)
+			if len(conns) == 0 {
+				delete(c.s.tracking, key)
+			}
+		}
+	}
+	c.tracked = nil
+}
+
+// invalidate tells the connections tracking key that it was modified. Like valkey, a key
+// stops being tracked once invalidated, until it is read again.
+func (s *Server) invalidate(key string) {
+	conns, ok := s.tracking[key]
+	if !ok {
+		return
+	}
+	delete(s.tracking, key)
+	for c := range conns {
+		delete(c.tracked, key)
+		c.push(pushReply{"invalidate", []string{key}})
+	}
+}
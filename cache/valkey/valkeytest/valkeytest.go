@@ -0,0 +1,44 @@
+// Package valkeytest provides an in-memory valkey server for tests of the cache packages.
+//
+// The server supports the commands used by distlock and reserve: strings with SET NX EX,
+// sorted sets, sets, hashes, streams with XADD and XRANGE, expiry, SCAN, WATCH/MULTI/EXEC,
+// PUBLISH/SUBSCRIBE, Lua scripts with EVAL and EVALSHA, and client side caching with RESP3
+// invalidation. Faults can be injected with SetDelay, SetFault,
+// FailCommand, DropCommand and DropConnections.
+package valkeytest
+
+import (
+	"testing"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Start starts a server that is closed when the test ends.
+func Start(tb testing.TB) *Server {
+	tb.Helper()
+	s, err := NewServer()
+	if err != nil {
+		tb.Fatalf("valkeytest: start server: %v", err)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s
+}
+
+// ClientOption returns the options to connect a client to the server.
+func (s *Server) ClientOption() valkey.ClientOption {
+	return valkey.ClientOption{
+		InitAddress:       []string{s.Addr()},
+		ForceSingleClient: true,
+	}
+}
+
+// NewClient connects a client to s that is closed when the test ends.
+func NewClient(tb testing.TB, s *Server) valkey.Client {
+	tb.Helper()
+	client, err := valkey.NewClient(s.ClientOption())
+	if err != nil {
+		tb.Fatalf("valkeytest: connect: %v", err)
+	}
+	tb.Cleanup(client.Close)
+	return client
+}
@@ -0,0 +1,384 @@
+package valkeytest_test
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+)
+
+func scanAll(t *testing.T, client valkey.Client, match string) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	var keys []string
+	var cursor uint64
+	for {
+		entry, err := client.Do(ctx, client.B().Scan().Cursor(cursor).Match(match).Count(2).Build()).AsScanEntry()
+		if err != nil {
+			t.Fatalf("scan %s: %v", match, err)
+		}
+		keys = append(keys, entry.Elements...)
+		if entry.Cursor == 0 {
+			break
+		}
+		cursor = entry.Cursor
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	for _, key := range []string{"reserve:1", "reserve:2", "reserve:10", "reserve:1:loaded", "reserve:{3}", "live:1", "path/a/b"} {
+		if err := client.Do(ctx, client.B().Set().Key(key).Value("v").Build()).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		match string
+		want  []string
+	}{
+		{"", []string{"live:1", "path/a/b", "reserve:1", "reserve:10", "reserve:1:loaded", "reserve:2", "reserve:{3}"}},
+		{"reserve:*", []string{"reserve:1", "reserve:10", "reserve:1:loaded", "reserve:2", "reserve:{3}"}},
+		{"reserve:?", []string{"reserve:1", "reserve:2"}},
+		{"reserve:[12]", []string{"reserve:1", "reserve:2"}},
+		{"reserve:[^1]", []string{"reserve:2"}},
+		{"reserve:*:loaded", []string{"reserve:1:loaded"}},
+		{"reserve:\\{3\\}", []string{"reserve:{3}"}},
+		{"path/*", []string{"path/a/b"}},
+		{"none:*", nil},
+	}
+	for _, tt := range tests {
+		got := scanAll(t, client, tt.match)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("scan %q: got %v, want %v", tt.match, got, tt.want)
+		}
+	}
+}
+
+func TestScanType(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	client.Do(ctx, client.B().Set().Key("string").Value("v").Build())
+	client.Do(ctx, client.B().Zadd().Key("zset").ScoreMember().ScoreMember(1, "m").Build())
+	client.Do(ctx, client.B().Sadd().Key("set").Member("m").Build())
+
+	entry, err := client.Do(ctx, client.B().Scan().Cursor(0).Type("zset").Build()).AsScanEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Elements) != 1 || entry.Elements[0] != "zset" {
+		t.Errorf("got %v, want [zset]", entry.Elements)
+	}
+}
+
+func TestMultiExec(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	res := client.DoMulti(ctx,
+		client.B().Multi().Build(),
+		client.B().Set().Key("a").Value("1").Build(),
+		client.B().Zadd().Key("z").ScoreMember().ScoreMember(1, "m").Build(),
+		client.B().Get().Key("a").Build(),
+		client.B().Exec().Build(),
+	)
+	replies, err := res[len(res)-1].ToArray()
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("got %d replies, want 3", len(replies))
+	}
+	if v, _ := replies[2].ToString(); v != "1" {
+		t.Errorf("get in transaction: got %q, want 1", v)
+	}
+}
+
+func TestMultiExecAbortsOnQueueError(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	res := client.DoMulti(ctx,
+		client.B().Multi().Build(),
+		client.B().Set().Key("a").Value("1").Build(),
+		client.B().Arbitrary("NOSUCHCOMMAND").Build(),
+		client.B().Exec().Build(),
+	)
+	err := res[len(res)-1].Error()
+	if err == nil || !strings.HasPrefix(err.Error(), "EXECABORT") {
+		t.Fatalf("exec: got %v, want EXECABORT", err)
+	}
+	if err = client.Do(ctx, client.B().Get().Key("a").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get a: got %v, want nil", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	c, cancel := client.Dedicate()
+	defer cancel()
+
+	if err := c.Do(ctx, c.B().Watch().Key("a").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	// a write by another connection aborts the transaction
+	if err := client.Do(ctx, client.B().Set().Key("a").Value("other").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	res := c.DoMulti(ctx,
+		c.B().Multi().Build(),
+		c.B().Set().Key("a").Value("mine").Build(),
+		c.B().Exec().Build(),
+	)
+	if err := res[len(res)-1].Error(); !valkey.IsValkeyNil(err) {
+		t.Fatalf("exec: got %v, want nil reply", err)
+	}
+	if v, _ := client.Do(ctx, client.B().Get().Key("a").Build()).ToString(); v != "other" {
+		t.Errorf("got %q, want other", v)
+	}
+
+	// the watch is cleared by EXEC, so the next transaction commits
+	if err := c.Do(ctx, c.B().Watch().Key("a").Build()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	res = c.DoMulti(ctx,
+		c.B().Multi().Build(),
+		c.B().Set().Key("a").Value("mine").Build(),
+		c.B().Exec().Build(),
+	)
+	if err := res[len(res)-1].Error(); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if v, _ := client.Do(ctx, client.B().Get().Key("a").Build()).ToString(); v != "mine" {
+		t.Errorf("got %q, want mine", v)
+	}
+}
+
+func TestHash(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	n, err := client.Do(ctx, client.B().Hset().Key("h").FieldValue().FieldValue("a", "1").FieldValue("b", "2").Build()).AsInt64()
+	if err != nil || n != 2 {
+		t.Fatalf("hset: got %d, %v, want 2", n, err)
+	}
+	if v, _ := client.Do(ctx, client.B().Hget().Key("h").Field("b").Build()).ToString(); v != "2" {
+		t.Errorf("hget b: got %q, want 2", v)
+	}
+	if err = client.Do(ctx, client.B().Hget().Key("h").Field("c").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("hget c: got %v, want nil", err)
+	}
+	if err = client.Do(ctx, client.B().Get().Key("h").Build()).Error(); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Errorf("get of a hash: got %v, want WRONGTYPE", err)
+	}
+
+	client.Do(ctx, client.B().Hdel().Key("h").Field("a", "b").Build())
+	if n, _ = client.Do(ctx, client.B().Exists().Key("h").Build()).AsInt64(); n != 0 {
+		t.Errorf("hash without fields still exists")
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := client.Do(ctx, client.B().Xadd().Key("st").Maxlen().Almost().Threshold("2").Id("*").FieldValue().
+			FieldValue("n", strconv.Itoa(i)).Build()).ToString()
+		if err != nil {
+			t.Fatalf("xadd %d: %v", i, err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Errorf("ids %v are not unique", ids)
+	}
+	if err := client.Do(ctx, client.B().Xadd().Key("st").Id("1-1").FieldValue().FieldValue("n", "old").Build()).Error(); err == nil {
+		t.Error("xadd of an old id succeeded")
+	}
+
+	// trimmed to the last two entries
+	if n, err := client.Do(ctx, client.B().Xlen().Key("st").Build()).AsInt64(); err != nil || n != 2 {
+		t.Errorf("xlen = %d, %v, want 2", n, err)
+	}
+	entries, err := client.Do(ctx, client.B().Xrange().Key("st").Start("-").End("+").Build()).AsXRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[1] || entries[0].FieldValues["n"] != "1" || entries[1].FieldValues["n"] != "2" {
+		t.Errorf("xrange = %+v, want entries 1 and 2", entries)
+	}
+	entries, err = client.Do(ctx, client.B().Xrange().Key("st").Start(ids[2]).End("+").Count(5).Build()).AsXRange()
+	if err != nil || len(entries) != 1 || entries[0].ID != ids[2] {
+		t.Errorf("xrange from the last id = %+v, %v", entries, err)
+	}
+	if typ, _ := client.Do(ctx, client.B().Type().Key("st").Build()).ToString(); typ != "stream" {
+		t.Errorf("type = %s, want stream", typ)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	client.Do(ctx, client.B().Set().Key("a").Value("1").Build())
+	if n, _ := client.Do(ctx, client.B().Pexpire().Key("a").Milliseconds(50).Build()).AsInt64(); n != 1 {
+		t.Fatalf("pexpire: got %d, want 1", n)
+	}
+	if ttl, _ := client.Do(ctx, client.B().Pttl().Key("a").Build()).AsInt64(); ttl <= 0 || ttl > 50 {
+		t.Errorf("pttl: got %d", ttl)
+	}
+	// NX leaves an existing expiry alone
+	if n, _ := client.Do(ctx, client.B().Expire().Key("a").Seconds(100).Nx().Build()).AsInt64(); n != 0 {
+		t.Errorf("expire nx: got %d, want 0", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := client.Do(ctx, client.B().Get().Key("a").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get after expiry: got %v, want nil", err)
+	}
+}
+
+func TestFailCommand(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	s.FailCommand("set", "ERR injected", 2)
+	for i := 0; i < 2; i++ {
+		err := client.Do(ctx, client.B().Set().Key("a").Value("1").Build()).Error()
+		if err == nil || !strings.Contains(err.Error(), "injected") {
+			t.Fatalf("set %d: got %v, want injected", i, err)
+		}
+	}
+	if err := client.Do(ctx, client.B().Set().Key("a").Value("1").Build()).Error(); err != nil {
+		t.Fatalf("set after the faults ran out: %v", err)
+	}
+}
+
+func TestFailCommandInTransaction(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	s.FailCommand("EXEC", "ERR injected", 1)
+	res := client.DoMulti(ctx,
+		client.B().Multi().Build(),
+		client.B().Set().Key("a").Value("1").Build(),
+		client.B().Exec().Build(),
+	)
+	if err := res[len(res)-1].Error(); err == nil || !strings.Contains(err.Error(), "injected") {
+		t.Fatalf("exec: got %v, want injected", err)
+	}
+	if err := client.Do(ctx, client.B().Get().Key("a").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get a: got %v, want nil", err)
+	}
+}
+
+func TestSetFault(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	s.SetFault(func(cmd []string) *valkeytest.Fault {
+		if len(cmd) > 1 && cmd[1] == "broken" {
+			return &valkeytest.Fault{Err: "ERR broken"}
+		}
+		return nil
+	})
+	if err := client.Do(ctx, client.B().Get().Key("broken").Build()).Error(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("get broken: got %v, want broken", err)
+	}
+	if err := client.Do(ctx, client.B().Get().Key("fine").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get fine: got %v, want nil", err)
+	}
+
+	s.ClearFaults()
+	if err := client.Do(ctx, client.B().Get().Key("broken").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get after clearing: got %v, want nil", err)
+	}
+}
+
+func TestDropCommand(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	s.DropCommand("GET", 1)
+	err := client.Do(ctx, client.B().Get().Key("a").Build()).Error()
+	if _, ok := valkey.IsValkeyErr(err); err == nil || ok {
+		t.Fatalf("get: got %v, want a connection error", err)
+	}
+	// the client reconnects
+	if err = client.Do(ctx, client.B().Get().Key("a").Build()).Error(); !valkey.IsValkeyNil(err) {
+		t.Errorf("get after reconnecting: got %v, want nil", err)
+	}
+}
+
+func TestScript(t *testing.T) {
+	ctx := context.Background()
+	s := valkeytest.Start(t)
+	client := valkeytest.NewClient(t, s)
+
+	// loaded by EVAL after EVALSHA fails with NOSCRIPT
+	script := valkey.NewLuaScript(`
+redis.call('ZADD', KEYS[1], 2, 'b', 1, 'a')
+local first = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local missing = redis.call('GET', KEYS[2])
+local t = redis.call('TIME')
+return {first[1], first[2], tostring(missing), tonumber(ARGV[1]) * 2, #t, redis.call('SET', KEYS[2], 'v')['ok']}
+`)
+	for i := 0; i < 2; i++ {
+		values, err := script.Exec(ctx, client, []string{"z", "s"}, []string{"21"}).ToArray()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, v := range values {
+			if s, err := v.ToString(); err == nil {
+				got = append(got, s)
+			} else if n, err := v.AsInt64(); err == nil {
+				got = append(got, strconv.FormatInt(n, 10))
+			}
+		}
+		if want := "a 1 false 42 2 OK"; strings.Join(got, " ") != want {
+			t.Fatalf("script = %v, want %s", got, want)
+		}
+		client.Do(ctx, client.B().Del().Key("s").Build())
+	}
+
+	err := client.Do(ctx, client.B().Eval().Script(`return redis.call('HGET', KEYS[1], 'f')`).Numkeys(1).Key("z").Build()).Error()
+	if err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Errorf("redis.call of a failing command: %v, want WRONGTYPE", err)
+	}
+	n, err := client.Do(ctx, client.B().Eval().Script(`
+local res = redis.pcall('HGET', KEYS[1], 'f')
+if res.err then return 1 end
+return 0
+`).Numkeys(1).Key("z").Build()).AsInt64()
+	if err != nil || n != 1 {
+		t.Errorf("redis.pcall of a failing command = %d, %v, want the error as a table", n, err)
+	}
+}
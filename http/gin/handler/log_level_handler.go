@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+type logLevelHandler struct {
+	lv port.Leveler
+}
+
+func NewLogLevelHandler(lv port.Leveler) *logLevelHandler {
+	return &logLevelHandler{lv: lv}
+}
+
+type LogLevelRes struct {
+	Level types.Level            `json:"level"`
+	Named map[string]types.Level `json:"named"`
+}
+
+type LogLevelReq struct {
+	// Name is the logger whose level is overridden, or empty for the global level.
+	Name string `json:"name"`
+	// Level is the new level. An empty level removes the override of Name.
+	Level types.Level `json:"level"`
+}
+
+// GetLevel returns the global level and the levels of named loggers.
+func (h *logLevelHandler) GetLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, h.levelRes())
+}
+
+// SetLevel changes the global level, or the level of a named logger.
+func (h *logLevelHandler) SetLevel(c *gin.Context) {
+	var req LogLevelReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &ErrorRes{Error: err.Error()})
+		return
+	}
+
+	var err error
+	switch {
+	case req.Name == "":
+		err = h.lv.SetLevel(req.Level)
+	case req.Level == "":
+		h.lv.UnsetNamedLevel(req.Name)
+	default:
+		err = h.lv.SetNamedLevel(req.Name, req.Level)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &ErrorRes{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, h.levelRes())
+}
+
+func (h *logLevelHandler) levelRes() *LogLevelRes {
+	return &LogLevelRes{
+		Level: h.lv.GetLevel(),
+		Named: h.lv.NamedLevels(),
+	}
+}
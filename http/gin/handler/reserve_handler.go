@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/usecase"
+)
+
+type reserveHandler struct {
+	u *usecase.ApppushReserveV2
+}
+
+func NewReserveHandler(u *usecase.ApppushReserveV2) *reserveHandler {
+	return &reserveHandler{u: u}
+}
+
+func (h *reserveHandler) GetReservations(c *gin.Context) {
+	userId, ok := parseIdParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	res, err := h.u.Lookup(c.Request.Context(), userId)
+	if err != nil {
+		abortWithReserveError(c, err)
+		return
+	}
+	body := newReservationsRes(userId, res.Reserves)
+	body.Stale = res.Stale
+	body.Degraded = res.Degraded
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *reserveHandler) AddReservation(c *gin.Context) {
+	userId, ok := parseIdParam(c, "userId")
+	if !ok {
+		return
+	}
+	liveId, ok := parseIdParam(c, "liveId")
+	if !ok {
+		return
+	}
+
+	res, err := h.u.SetReserve(c.Request.Context(), userId, liveId)
+	if err != nil {
+		abortWithReserveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newReservationsRes(userId, res))
+}
+
+func (h *reserveHandler) CancelReservation(c *gin.Context) {
+	userId, ok := parseIdParam(c, "userId")
+	if !ok {
+		return
+	}
+	liveId, ok := parseIdParam(c, "liveId")
+	if !ok {
+		return
+	}
+
+	res, err := h.u.CancelReserve(c.Request.Context(), userId, liveId)
+	if err != nil {
+		abortWithReserveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newReservationsRes(userId, res))
+}
+
+// GetBreaker returns the state of the circuit breaker guarding valkey.
+func (h *reserveHandler) GetBreaker(c *gin.Context) {
+	c.JSON(http.StatusOK, h.u.BreakerStats())
+}
+
+type ReservationsRes struct {
+	UserID  uint64   `json:"user_id"`
+	LiveIDs []uint64 `json:"live_ids"`
+	// Stale is set when the reservations are being refreshed from storage.
+	Stale bool `json:"stale,omitempty"`
+	// Degraded is set when the reservations were read from storage because valkey is unavailable.
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+func newReservationsRes(userId uint64, lives string) *ReservationsRes {
+	res := &ReservationsRes{
+		UserID:  userId,
+		LiveIDs: []uint64{},
+	}
+	for _, v := range strings.Split(lives, ",") {
+		liveId, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		res.LiveIDs = append(res.LiveIDs, liveId)
+	}
+	return res
+}
+
+type ErrorRes struct {
+	Error string `json:"error"`
+}
+
+func parseIdParam(c *gin.Context, name string) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &ErrorRes{Error: name + " is invalid"})
+		return 0, false
+	}
+	return id, true
+}
+
+// abortWithReserveError maps errors of the reserve use case to HTTP status codes.
+func abortWithReserveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errorz.ErrResourceNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, &ErrorRes{Error: err.Error()})
+	case errors.Is(err, distlock.ErrLockNotAcquired), errors.Is(err, errorz.ErrNeedRetry):
+		// another request held the lock of the same user, or changed their reservations
+		// first, for as long as this one waited
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, &ErrorRes{Error: err.Error()})
+	case errors.Is(err, breaker.ErrBreakerOpen):
+		// valkey is unavailable
+		c.Header("Retry-After", "10")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, &ErrorRes{Error: err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, &ErrorRes{Error: err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, &ErrorRes{Error: err.Error()})
+	}
+}
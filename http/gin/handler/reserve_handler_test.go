@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/errorz"
+)
+
+func TestAbortWithReserveError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name       string
+		err        error
+		want       int
+		retryAfter string
+	}{
+		{"not found", errorz.ErrResourceNotFound, http.StatusNotFound, ""},
+		{"lock held", fmt.Errorf("set reserve: %w", distlock.AsAcquireLockError("retry limit reached", &distlock.AcquireLockError{Msg: "timeout", Err: distlock.ErrLockNotAcquired})), http.StatusConflict, "1"},
+		{"conflict", fmt.Errorf("set reserve: retry limit reached: %w", errorz.ErrNeedRetry), http.StatusConflict, "1"},
+		{"lock of a server down", distlock.AsAcquireLockError("trying to acquire lock", connErr), http.StatusInternalServerError, ""},
+		{"lock deadline", distlock.AsAcquireLockError("context done: ", context.DeadlineExceeded), http.StatusGatewayTimeout, ""},
+		{"breaker open", breaker.ErrBreakerOpen, http.StatusServiceUnavailable, "10"},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		abortWithReserveError(c, tt.err)
+		if w.Code != tt.want || w.Header().Get("Retry-After") != tt.retryAfter {
+			t.Errorf("%s: status = %d with retry after %q, want %d with %q", tt.name, w.Code, w.Header().Get("Retry-After"), tt.want, tt.retryAfter)
+		}
+	}
+}
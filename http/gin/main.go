@@ -3,16 +3,32 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
+	"github.com/valkey-io/valkey-go"
+	"github.com/wonksing/go-tutorials/cache/valkey/distlock"
+	"github.com/wonksing/go-tutorials/cache/valkey/factory"
+	"github.com/wonksing/go-tutorials/cache/valkey/leader"
+	"github.com/wonksing/go-tutorials/cache/valkey/ratelimit"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/adapter"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/publisher"
+	"github.com/wonksing/go-tutorials/cache/valkey/reserve/usecase"
 	"github.com/wonksing/go-tutorials/http/gin/handler"
 	"github.com/wonksing/go-tutorials/http/gin/middleware"
+	"github.com/wonksing/go-tutorials/kafka/sarama/async-producer/producer"
+	mylogger "github.com/wonksing/go-tutorials/logger/mylogger/logger"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
 )
 
 /*
@@ -31,6 +47,66 @@ func main() {
 	userHandler := handler.NewUserHandler()
 	r.GET("/users/:userId", middleware.NoCache(), userHandler.GetUser)
 
+	appLogger, err := mylogger.LoggerFactory(types.ZapLoggerType,
+		mylogger.WithLevel(types.InfoLevel),
+		mylogger.WithStdOut(true),
+		mylogger.WithServiceName("reserve-api"))
+	if err != nil {
+		log.Fatalf("failed to create logger: %v\n", err)
+	}
+	mylogger.SetDefault(appLogger)
+	leveler := appLogger.(port.Leveler)
+	stopToggle := mylogger.ToggleDebugOnSIGUSR2(leveler)
+	defer stopToggle()
+
+	// operational endpoints expose and change the state of the server, so they take the
+	// admin token
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Fatalf("ADMIN_TOKEN is required to serve admin endpoints\n")
+	}
+	admin := r.Group("", middleware.NoCache(), middleware.AuthBearerKey(adminToken))
+
+	logLevelHandler := handler.NewLogLevelHandler(leveler)
+	admin.GET("/log/level", logLevelHandler.GetLevel)
+	admin.PUT("/log/level", logLevelHandler.SetLevel)
+
+	config, err := factory.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load valkey config: %v\n", err)
+	}
+	client, err := factory.NewClient(config)
+	if err != nil {
+		log.Fatalf("failed to create valkey client: %v\n", err)
+	}
+	defer client.Close()
+
+	reserveUsecase, closeReserve := newReserveUsecase(context.Background(), client, config)
+	defer closeReserve()
+
+	authSecret := os.Getenv("AUTH_SECRET")
+	if authSecret == "" {
+		log.Fatalf("AUTH_SECRET is required to authenticate users\n")
+	}
+	authUser := middleware.AuthUser([]byte(authSecret), "userId")
+
+	ipLimiter, err := ratelimit.NewGCRA(client, "ratelimit:ip:", 20, time.Second, 40)
+	if err != nil {
+		log.Fatalf("failed to create ip rate limiter: %v\n", err)
+	}
+	userLimiter, err := ratelimit.NewSlidingWindowLog(client, "ratelimit:user:", 10, time.Minute)
+	if err != nil {
+		log.Fatalf("failed to create user rate limiter: %v\n", err)
+	}
+	ipLimit := middleware.RateLimit(ipLimiter, middleware.ByClientIP)
+	userLimit := middleware.RateLimit(userLimiter, middleware.ByAuthUser)
+
+	reserveHandler := handler.NewReserveHandler(reserveUsecase)
+	r.GET("/users/:userId/reservations", middleware.NoCache(), ipLimit, authUser, reserveHandler.GetReservations)
+	r.POST("/users/:userId/reservations/:liveId", middleware.NoCache(), ipLimit, authUser, userLimit, reserveHandler.AddReservation)
+	r.DELETE("/users/:userId/reservations/:liveId", middleware.NoCache(), ipLimit, authUser, userLimit, reserveHandler.CancelReservation)
+	admin.GET("/reservations/breaker", reserveHandler.GetBreaker)
+
 	server := &http.Server{
 		Addr:         ":8080",
 		TLSConfig:    &tls.Config{},
@@ -46,6 +122,138 @@ func main() {
 
 }
 
+func newReserveUsecase(ctx context.Context, client valkey.Client, config factory.Config) (*usecase.ApppushReserveV2, func()) {
+	timeout := 3 * time.Second
+	loadLock := distlock.NewDistLockValkeyV3(ctx, client, "key-prefix:load:", "chan-prefix:load:", timeout, 0)
+	setLock := distlock.NewDistLockValkeyV3(ctx, client, "key-prefix:zadd:", "chan-prefix:zadd:", timeout, 3)
+	schema := adapter.NewKeySchema("reserve:")
+	if config.Cluster() {
+		loadLock.WithHashTag()
+		setLock.WithHashTag()
+		schema.HashTag = true
+	}
+	if err := config.RequireHashTag(schema.HashTag); err != nil {
+		log.Fatalf("reserve key schema: %v\n", err)
+	}
+	a := adapter.NewReserveValkeyWithSchema(client, schema, 10)
+	u := usecase.NewApppushReserveV2(loadLock, setLock, a).
+		WithStaleWhileRevalidate(time.Minute).
+		WithCircuitBreaker(5, 2, 10*time.Second)
+	stopJobs := startLeaderJobs(ctx, client, a, u.StoredLives)
+
+	var outbox *publisher.KafkaOutbox
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		var err error
+		outbox, err = newReserveOutbox(ctx, client, a, strings.Split(brokers, ","))
+		if err != nil {
+			log.Fatalf("failed to create reserve outbox: %v\n", err)
+		}
+		u.WithPublisher(outbox)
+	}
+
+	closeFn := func() {
+		stopJobs()
+		if outbox != nil {
+			outbox.Close()
+		}
+		loadLock.Close()
+		setLock.Close()
+	}
+	return u, closeFn
+}
+
+// newReserveOutbox creates the publisher of reservation events to Kafka.
+func newReserveOutbox(ctx context.Context, client valkey.Client, a *adapter.ReserveValkey, brokers []string) (*publisher.KafkaOutbox, error) {
+	version := os.Getenv("KAFKA_VERSION")
+	if version == "" {
+		version = sarama.DefaultVersion.String()
+	}
+	config, err := producer.BuildConfig("reserve-api", version)
+	if err != nil {
+		return nil, err
+	}
+	// events are acknowledged once they are produced
+	config.Producer.Return.Successes = true
+	return publisher.NewKafkaOutbox(ctx, client, a, brokers, config, "reserve-events", "outbox:reserve", time.Minute)
+}
+
+// startLeaderJobs runs the jobs that must run on a single instance while this instance is
+// the leader, and returns a function stopping them.
+func startLeaderJobs(ctx context.Context, client valkey.Client, a *adapter.ReserveValkey, stored adapter.StoredLivesFunc) func() {
+	hostname, _ := os.Hostname()
+	id := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+
+	ctx, cancel := context.WithCancel(ctx)
+	lock := distlock.NewDistLockValkeyV3(ctx, client, "key-prefix:leader:", "chan-prefix:leader:", 10*time.Second, 0)
+	jobLogger := mylogger.Named("jobs").With(types.WithStringField("instance", id))
+	election := leader.NewElection(lock, "reserve:jobs", id, 15*time.Second).
+		WithOnElected(func(term context.Context) {
+			jobLogger.Info(term, "leading reserve jobs")
+			go applyPendingChanges(term, jobLogger, a, time.Minute)
+			reconcileLiveIndex(term, jobLogger, a, stored, 10*time.Minute)
+		}).
+		WithOnRevoked(func() {
+			jobLogger.Info(ctx, "no longer leading reserve jobs")
+		})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := election.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			jobLogger.Error(ctx, "leader election failed", types.WithStringField("error", err.Error()))
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		lock.Close()
+	}
+}
+
+// applyPendingChanges applies the reservation changes left behind by writes that failed to
+// apply them every interval until ctx is done.
+func applyPendingChanges(ctx context.Context, logger port.Logger, a *adapter.ReserveValkey, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		applied, err := a.ApplyPendingChanges(ctx, 100)
+		if err != nil && ctx.Err() == nil {
+			logger.Error(ctx, "apply pending changes failed", types.WithStringField("error", err.Error()))
+		} else if applied > 0 {
+			logger.Info(ctx, "applied pending changes", types.WithInt64Field("applied", applied))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileLiveIndex repairs the reverse index of reservations every interval until ctx is done.
+func reconcileLiveIndex(ctx context.Context, logger port.Logger, a *adapter.ReserveValkey, stored adapter.StoredLivesFunc, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		added, removed, err := a.ReconcileLiveIndex(ctx, 100, stored)
+		if err != nil && ctx.Err() == nil {
+			logger.Error(ctx, "reconcile live index failed", types.WithStringField("error", err.Error()))
+		} else if added > 0 || removed > 0 {
+			logger.Info(ctx, "reconciled live index", types.WithInt64Field("added", added), types.WithInt64Field("removed", removed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func handleSignals(ctx context.Context, httpServer *http.Server, signals ...os.Signal) {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, signals...)
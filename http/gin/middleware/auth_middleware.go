@@ -1,47 +1,109 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// authUserKey is the key of the gin context holding the user authenticated by AuthUser.
+const authUserKey = "authUser"
+
+// AuthBearerKey lets through requests bearing token, which must not be empty.
 func AuthBearerKey(token string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// w := c.Writer
 		// r := c.Request
 		// ctx := r.Context()
 
-		value := c.GetHeader("Authorization")
-		if value == "" {
-			// oerr := dto.OAuth2ErrorInvalidRequest(http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			// log.Error(ctx, http.StatusText(http.StatusBadRequest), logger.UrlField(r.URL.String()))
-			// http.Error(w, oerr.Error(), oerr.GetStatusCode())
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+		value, ok := bearerToken(c)
+		if !ok {
 			return
 		}
 
-		arr := strings.Split(value, " ")
-		if len(arr) != 2 || !strings.EqualFold(arr[0], "Bearer") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(token)) != 1 {
 			// oerr := dto.OAuth2ErrorInvalidRequest(http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			// log.Error(ctx, http.StatusText(http.StatusBadRequest), logger.UrlField(r.URL.String()))
+			// log.Error(ctx, http.StatusText(http.StatusUnauthorized), logger.UrlField(r.URL.String()))
 			// http.Error(w, oerr.Error(), oerr.GetStatusCode())
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is invalid"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization key is invalid"})
 			c.Abort()
 			return
 		}
 
-		if arr[1] != token {
-			// oerr := dto.OAuth2ErrorInvalidRequest(http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			// log.Error(ctx, http.StatusText(http.StatusUnauthorized), logger.UrlField(r.URL.String()))
-			// http.Error(w, oerr.Error(), oerr.GetStatusCode())
+		c.Next()
+	}
+}
+
+// AuthUser authenticates the user of a request by a bearer token signed with secret, see
+// SignUserToken, and rejects requests whose path parameter userParam names another user.
+// Handlers and RateLimit with ByAuthUser read the user with AuthUserId.
+func AuthUser(secret []byte, userParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		userId, sig, found := strings.Cut(token, ".")
+		mac, err := base64.RawURLEncoding.DecodeString(sig)
+		if !found || userId == "" || err != nil || !hmac.Equal(mac, userMac(secret, userId)) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization key is invalid"})
 			c.Abort()
 			return
 		}
+		if p := c.Param(userParam); p != "" && p != userId {
+			c.JSON(http.StatusForbidden, gin.H{"error": "user is not allowed"})
+			c.Abort()
+			return
+		}
 
+		c.Set(authUserKey, userId)
 		c.Next()
 	}
 }
+
+// SignUserToken returns the bearer token authenticating userId to AuthUser.
+func SignUserToken(secret []byte, userId string) string {
+	return userId + "." + base64.RawURLEncoding.EncodeToString(userMac(secret, userId))
+}
+
+// AuthUserId returns the user authenticated by AuthUser, or an empty string.
+func AuthUserId(c *gin.Context) string {
+	return c.GetString(authUserKey)
+}
+
+func userMac(secret []byte, userId string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(userId))
+	return h.Sum(nil)
+}
+
+// bearerToken returns the token of the Authorization header, aborting the request if
+// there is none.
+func bearerToken(c *gin.Context) (string, bool) {
+	value := c.GetHeader("Authorization")
+	if value == "" {
+		// oerr := dto.OAuth2ErrorInvalidRequest(http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		// log.Error(ctx, http.StatusText(http.StatusBadRequest), logger.UrlField(r.URL.String()))
+		// http.Error(w, oerr.Error(), oerr.GetStatusCode())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is required"})
+		c.Abort()
+		return "", false
+	}
+
+	arr := strings.Split(value, " ")
+	if len(arr) != 2 || !strings.EqualFold(arr[0], "Bearer") {
+		// oerr := dto.OAuth2ErrorInvalidRequest(http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		// log.Error(ctx, http.StatusText(http.StatusBadRequest), logger.UrlField(r.URL.String()))
+		// http.Error(w, oerr.Error(), oerr.GetStatusCode())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is invalid"})
+		c.Abort()
+		return "", false
+	}
+	return arr[1], true
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/http/gin/middleware"
+)
+
+func TestAuthUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("secret")
+
+	var limited string
+	r := gin.New()
+	r.GET("/users/:userId", middleware.AuthUser(secret, "userId"), func(c *gin.Context) {
+		limited = middleware.ByAuthUser(c)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"own user", "/users/1", "Bearer " + middleware.SignUserToken(secret, "1"), http.StatusOK},
+		{"another user", "/users/2", "Bearer " + middleware.SignUserToken(secret, "1"), http.StatusForbidden},
+		{"forged user", "/users/2", "Bearer 2." + middleware.SignUserToken(secret, "1")[2:], http.StatusUnauthorized},
+		{"other secret", "/users/1", "Bearer " + middleware.SignUserToken([]byte("other"), "1"), http.StatusUnauthorized},
+		{"no signature", "/users/1", "Bearer 1", http.StatusUnauthorized},
+		{"no header", "/users/1", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		limited = ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && limited != "1" {
+			t.Errorf("%s: rate limit key = %q, want 1", tt.name, limited)
+		}
+	}
+}
+
+func TestAuthBearerKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/log/level", middleware.AuthBearerKey("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"Bearer admin", http.StatusOK},
+		{"Bearer other", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"admin", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/log/level", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%q: status = %d, want %d", tt.header, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/cache/valkey/ratelimit"
+)
+
+// RateLimit rejects requests with 429 once the limiter denies the key returned by keyFn.
+// Requests with an empty key are not limited. If the limiter fails, requests are let
+// through rather than turning an outage of valkey into an outage of the api.
+func RateLimit(l ratelimit.Limiter, keyFn func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFn(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		res, err := l.Allow(c.Request.Context(), key)
+		if err != nil {
+			log.Printf("rate limit %s: %v\n", key, err)
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+		h.Set("X-RateLimit-Reset", seconds(res.ResetAfter))
+		if !res.Allowed {
+			h.Set("Retry-After", seconds(res.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ByClientIP limits requests per client ip.
+func ByClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// ByAuthUser limits requests per user authenticated by AuthUser, which must run first.
+// Path parameters are chosen by the client, so limiting by them would let anyone use up
+// the quota of another user.
+func ByAuthUser(c *gin.Context) string {
+	return AuthUserId(c)
+}
+
+// seconds rounds d up to whole seconds, so clients retrying after it are not denied again.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonksing/go-tutorials/cache/valkey/ratelimit"
+	"github.com/wonksing/go-tutorials/cache/valkey/valkeytest"
+	"github.com/wonksing/go-tutorials/http/gin/middleware"
+)
+
+// limiterFunc decides requests with a function.
+type limiterFunc func(ctx context.Context, key string) (ratelimit.Result, error)
+
+func (f limiterFunc) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	return f(ctx, key)
+}
+
+func newRateLimitRouter(l ratelimit.Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", middleware.RateLimit(l, func(c *gin.Context) string {
+		return c.Query("key")
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	r := newRateLimitRouter(limiterFunc(func(ctx context.Context, key string) (ratelimit.Result, error) {
+		switch key {
+		case "denied":
+			return ratelimit.Result{Limit: 5, RetryAfter: 1500 * time.Millisecond, ResetAfter: 3 * time.Second}, nil
+		case "failing":
+			return ratelimit.Result{}, errors.New("valkey down")
+		default:
+			return ratelimit.Result{Allowed: true, Limit: 5, Remaining: 4, ResetAfter: 200 * time.Millisecond}, nil
+		}
+	}))
+
+	tests := []struct {
+		name       string
+		key        string
+		want       int
+		retryAfter string
+		remaining  string
+		reset      string
+	}{
+		{"allowed", "allowed", http.StatusOK, "", "4", "1"},
+		// retry after is rounded up to whole seconds
+		{"denied", "denied", http.StatusTooManyRequests, "2", "0", "3"},
+		{"limiter fails", "failing", http.StatusOK, "", "", ""},
+		{"no key", "", http.StatusOK, "", "", ""},
+	}
+	for _, tt := range tests {
+		w := get(r, "/?key="+tt.key)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		h := w.Header()
+		if h.Get("Retry-After") != tt.retryAfter || h.Get("X-RateLimit-Remaining") != tt.remaining || h.Get("X-RateLimit-Reset") != tt.reset {
+			t.Errorf("%s: headers = %v, want retry after %q, remaining %q and reset %q", tt.name, h, tt.retryAfter, tt.remaining, tt.reset)
+		}
+	}
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	client := valkeytest.NewClient(t, valkeytest.Start(t))
+	l, err := ratelimit.NewSlidingWindowLog(client, "ratelimit:", 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRateLimitRouter(l)
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := get(r, "/?key=a")
+		if w.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests {
+			if got := w.Header().Get("Retry-After"); got != "60" {
+				t.Errorf("retry after = %q, want 60", got)
+			}
+			if got := w.Body.String(); got != `{"error":"too many requests"}` {
+				t.Errorf("body = %s", got)
+			}
+		}
+	}
+	if w := get(r, "/?key=b"); w.Code != http.StatusOK {
+		t.Errorf("request of another key: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
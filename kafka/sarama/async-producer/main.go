@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/wonksing/go-tutorials/kafka/sarama/async-producer/producer"
 )
 
 // Sarama configuration options
@@ -53,7 +54,7 @@ func main() {
 		sarama.Logger = log.New(os.Stdout, "[sarama] ", log.LstdFlags)
 	}
 
-	config, err := buildConfig()
+	config, err := producer.BuildConfig("test_retry", version)
 	if err != nil {
 		log.Printf("failed to build config: %v\n", err)
 		os.Exit(1)
@@ -131,50 +132,3 @@ func main() {
 	wgErr.Wait()
 	fmt.Printf("finished producing messages: sent=%d, success=%d, failure=%d\n", sent, success, failure)
 }
-
-func buildConfig() (*sarama.Config, error) {
-	version, err := sarama.ParseKafkaVersion(version)
-	if err != nil {
-		// log.Panicf("Error parsing Kafka version: %v", err)
-		return nil, err
-	}
-
-	config := sarama.NewConfig()
-	config.ClientID = "test_retry"
-	config.Version = version
-
-	config.ChannelBufferSize = 1024
-
-	config.Net.ReadTimeout = 30 * time.Second
-	config.Net.WriteTimeout = 30 * time.Second
-	config.Net.DialTimeout = 30 * time.Second
-	config.Net.MaxOpenRequests = 1
-
-	config.Producer.Timeout = 30 * time.Second
-	config.Producer.Idempotent = true
-	config.Producer.Retry.Max = 10
-	config.Producer.Retry.BackoffFunc = func(retries int, maxRetries int) time.Duration {
-		v := (1 << retries) * 250 * time.Millisecond
-		if v > 10000*time.Millisecond {
-			v = 10000 * time.Millisecond
-		}
-		return v
-	}
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Return.Successes = false
-	config.Producer.Return.Errors = true
-	config.Producer.Flush.Frequency = 3 * time.Second
-	config.Producer.Flush.Messages = 512
-	config.Producer.Flush.MaxMessages = 1024
-
-	config.Metadata.Retry.Max = 10
-	config.Metadata.Retry.BackoffFunc = func(retries int, maxRetries int) time.Duration {
-		v := (1 << retries) * 250 * time.Millisecond
-		if v > 10000*time.Millisecond {
-			v = 10000 * time.Millisecond
-		}
-		return v
-	}
-	config.Metadata.RefreshFrequency = 5 * time.Minute
-	return config, nil
-}
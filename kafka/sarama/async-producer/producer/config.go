@@ -0,0 +1,57 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// BuildConfig returns the configuration of an idempotent async producer.
+// Only errors are returned on the producer's channels; set config.Producer.Return.Successes
+// to learn about acknowledged messages.
+func BuildConfig(clientId string, version string) (*sarama.Config, error) {
+	kafkaVersion, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		// log.Panicf("Error parsing Kafka version: %v", err)
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.ClientID = clientId
+	config.Version = kafkaVersion
+
+	config.ChannelBufferSize = 1024
+
+	config.Net.ReadTimeout = 30 * time.Second
+	config.Net.WriteTimeout = 30 * time.Second
+	config.Net.DialTimeout = 30 * time.Second
+	config.Net.MaxOpenRequests = 1
+
+	config.Producer.Timeout = 30 * time.Second
+	config.Producer.Idempotent = true
+	config.Producer.Retry.Max = 10
+	config.Producer.Retry.BackoffFunc = func(retries int, maxRetries int) time.Duration {
+		v := (1 << retries) * 250 * time.Millisecond
+		if v > 10000*time.Millisecond {
+			v = 10000 * time.Millisecond
+		}
+		return v
+	}
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = false
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Frequency = 3 * time.Second
+	config.Producer.Flush.Messages = 512
+	config.Producer.Flush.MaxMessages = 1024
+
+	config.Metadata.Retry.Max = 10
+	config.Metadata.Retry.BackoffFunc = func(retries int, maxRetries int) time.Duration {
+		v := (1 << retries) * 250 * time.Millisecond
+		if v > 10000*time.Millisecond {
+			v = 10000 * time.Millisecond
+		}
+		return v
+	}
+	config.Metadata.RefreshFrequency = 5 * time.Minute
+	return config, nil
+}
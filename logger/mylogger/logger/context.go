@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields along with those already in ctx.
+// Every entry logged with the returned context includes them.
+func WithFields(ctx context.Context, fields ...types.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	parent := ContextFields(ctx)
+	merged := make([]types.Field, 0, len(parent)+len(fields))
+	merged = append(merged, parent...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// ContextFields returns the fields attached to ctx by WithFields.
+func ContextFields(ctx context.Context) []types.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]types.Field)
+	return fields
+}
+
+func RequestIdField(value string) types.Field {
+	return types.WithStringField("request_id", value)
+}
+
+func UserIdField(value string) types.Field {
+	return types.WithStringField("user_id", value)
+}
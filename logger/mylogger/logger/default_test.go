@@ -0,0 +1,49 @@
+package logger_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+func TestDefaultWarnsBeforeSetDefault(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	// the factory leaves the default alone, so both entries are discarded with a single warning
+	if _, err = logger.LoggerFactory(types.ZapLoggerType, logger.WithLevel(types.InfoLevel)); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info(context.Background(), "lost")
+	logger.Info(context.Background(), "lost again")
+	os.Stderr = stderr
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "before SetDefault"); n != 1 {
+		t.Errorf("stderr = %q, want a single warning", out)
+	}
+
+	roller := &memRoller{path: "default"}
+	l, err := logger.LoggerFactory(types.ZapLoggerType, logger.WithLevel(types.InfoLevel), logger.WithRoller(roller))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetDefault(l)
+	defer logger.SetDefault(nil)
+	logger.Info(context.Background(), "kept")
+	if entries := decode(t, roller); len(entries) != 1 || entries[0]["msg"] != "kept" {
+		t.Errorf("entries = %v, want the entry of the default", entries)
+	}
+}
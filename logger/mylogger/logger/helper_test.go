@@ -0,0 +1,36 @@
+package logger_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// memRoller keeps what is written to it in memory, under a path of its own.
+type memRoller struct {
+	path string
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (r *memRoller) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+func (r *memRoller) Close() error    { return nil }
+func (r *memRoller) Rotate() error   { return nil }
+func (r *memRoller) Sync() error     { return nil }
+func (r *memRoller) GetPath() string { return r.path }
+
+// lines returns the entries written so far.
+func (r *memRoller) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := strings.TrimSpace(r.buf.String())
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
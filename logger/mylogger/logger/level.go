@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+var _ port.Leveler = (*Logger)(nil)
+var _ port.LevelEnabler = (*Logger)(nil)
+
+// SetLevel sets the level of the default logger.
+func SetLevel(level types.Level) error {
+	lv, ok := Default().(port.Leveler)
+	if !ok {
+		return fmt.Errorf("logger %T does not support changing levels", Default())
+	}
+	return lv.SetLevel(level)
+}
+
+// GetLevel returns the level of the default logger, or an empty level if it has none.
+func GetLevel() types.Level {
+	lv, ok := Default().(port.Leveler)
+	if !ok {
+		return ""
+	}
+	return lv.GetLevel()
+}
+
+func (l *Logger) leveler() (port.Leveler, error) {
+	lv, ok := l.l.(port.Leveler)
+	if !ok {
+		return nil, fmt.Errorf("logger %T does not support changing levels", l.l)
+	}
+	return lv, nil
+}
+
+func (l *Logger) SetLevel(level types.Level) error {
+	lv, err := l.leveler()
+	if err != nil {
+		return err
+	}
+	return lv.SetLevel(level)
+}
+
+// GetLevel returns the level the logger was created with if it cannot change levels.
+func (l *Logger) GetLevel() types.Level {
+	lv, err := l.leveler()
+	if err != nil {
+		return l.level
+	}
+	return lv.GetLevel()
+}
+
+func (l *Logger) SetNamedLevel(name string, level types.Level) error {
+	lv, err := l.leveler()
+	if err != nil {
+		return err
+	}
+	return lv.SetNamedLevel(name, level)
+}
+
+func (l *Logger) UnsetNamedLevel(name string) {
+	if lv, err := l.leveler(); err == nil {
+		lv.UnsetNamedLevel(name)
+	}
+}
+
+// Enabled reports true if the logger cannot tell whether it writes entries of level.
+func (l *Logger) Enabled(level types.Level) bool {
+	if e, ok := l.l.(port.LevelEnabler); ok {
+		return e.Enabled(level)
+	}
+	return true
+}
+
+func (l *Logger) NamedLevels() map[string]types.Level {
+	lv, err := l.leveler()
+	if err != nil {
+		return map[string]types.Level{}
+	}
+	return lv.NamedLevels()
+}
+
+// ToggleDebugOnSignal switches lv to the debug level whenever one of sigs is received, and
+// back to the level it had before on the next one. The returned function stops it.
+func ToggleDebugOnSignal(lv port.Leveler, sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+
+	go func() {
+		previous := lv.GetLevel()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+			}
+
+			current := lv.GetLevel()
+			next := types.DebugLevel
+			if current == types.DebugLevel {
+				next = previous
+			}
+			previous = current
+			if err := lv.SetLevel(next); err != nil {
+				fmt.Printf("err: toggle debug: %v\n", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
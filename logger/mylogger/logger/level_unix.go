@@ -0,0 +1,15 @@
+//go:build unix
+
+package logger
+
+import (
+	"syscall"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+)
+
+// ToggleDebugOnSIGUSR2 switches lv between the debug level and its own level on SIGUSR2,
+// as in `kill -USR2 <pid>`.
+func ToggleDebugOnSIGUSR2(lv port.Leveler) (stop func()) {
+	return ToggleDebugOnSignal(lv, syscall.SIGUSR2)
+}
@@ -3,68 +3,141 @@ package logger
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/wrapper"
 )
 
+// defaultLogger holds the logger of the package level functions, so that it can be swapped
+// while they run. set tells whether SetDefault installed it.
+type defaultLogger struct {
+	l   port.Logger
+	set bool
+}
+
 var (
-	_globalLogger port.Logger
-	_serviceName  string
+	_defaultLogger atomic.Pointer[defaultLogger]
+	_serviceName   atomic.Value
+	_unsetWarning  sync.Once
 )
 
+func init() {
+	_defaultLogger.Store(&defaultLogger{l: wrapper.NewNopLogger()})
+}
+
+// SetServiceName sets the service name of loggers created without WithServiceName.
 func SetServiceName(serviceName string) {
-	_serviceName = serviceName
+	_serviceName.Store(serviceName)
+}
+
+// Default returns the logger of the package level functions, which discards every entry
+// until SetDefault is called. Using it before then warns once on stderr, as LoggerFactory
+// used to install the logger it created and callers relying on that would lose their logs
+// silently.
+func Default() port.Logger {
+	d := _defaultLogger.Load()
+	if !d.set {
+		_unsetWarning.Do(func() {
+			fmt.Fprintln(os.Stderr, "mylogger: the default logger is used before SetDefault and discards every entry; LoggerFactory does not set it")
+		})
+	}
+	return d.l
+}
+
+// SetDefault makes l the logger of the package level functions. A nil l discards entries.
+// It is safe to call while they run.
+func SetDefault(l port.Logger) {
+	if l == nil {
+		l = wrapper.NewNopLogger()
+	}
+	_defaultLogger.Store(&defaultLogger{l: l, set: true})
+}
+
+// NewNop returns a logger that discards every entry.
+func NewNop() port.Logger {
+	return wrapper.NewNopLogger()
 }
 
 func Debug(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Debug(ctx, message, fields...)
+	Default().Debug(ctx, message, fields...)
 }
 
 func Info(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Info(ctx, message, fields...)
+	Default().Info(ctx, message, fields...)
 }
 
 func Warn(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Warn(ctx, message, fields...)
+	Default().Warn(ctx, message, fields...)
 }
 
 func Error(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Error(ctx, message, fields...)
+	Default().Error(ctx, message, fields...)
 }
 
 func Fatal(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Fatal(ctx, message, fields...)
+	Default().Fatal(ctx, message, fields...)
 }
 
 func Panic(ctx context.Context, message string, fields ...types.Field) {
-	_globalLogger.Panic(ctx, message, fields...)
+	Default().Panic(ctx, message, fields...)
+}
+
+// With returns a child of the default logger adding fields to every entry.
+func With(fields ...types.Field) port.Logger {
+	return Default().With(fields...)
+}
+
+// Named returns a child of the default logger whose name is extended by name.
+func Named(name string) port.Logger {
+	return Default().Named(name)
 }
 
 type Logger struct {
 	l port.Logger
+	// bound are the fields added by With, which l adds by itself.
+	bound []types.Field
 
-	roller port.Roller
-	level  types.Level
-	stdOut bool
+	roller      port.Roller
+	level       types.Level
+	stdOut      bool
+	spanEvents  bool
+	serviceName string
+	encoder     types.EncoderConfig
+	sinks       []port.Sink
 }
 
+// LoggerFactory creates a logger of loggerType. It does not change the default logger;
+// pass it to SetDefault for that.
 func LoggerFactory(loggerType types.LoggerType, opts ...LoggerOption) (port.Logger, error) {
 	switch loggerType {
 	case types.ZapLoggerType:
-		logger := &Logger{}
+		logger := &Logger{encoder: types.DefaultEncoderConfig()}
 		for _, opt := range opts {
 			opt.apply(logger)
 		}
 
-		zl, err := wrapper.NewZapLogger(logger.level, logger.stdOut, logger.roller)
+		zl, err := wrapper.NewZapLogger(logger.level, logger.allSinks(), logger.encoder)
 		if err != nil {
 			return nil, err
 		}
 		logger.l = zl
 
-		_globalLogger = logger
+		return logger, nil
+	case types.SlogLoggerType:
+		logger := &Logger{encoder: types.DefaultEncoderConfig()}
+		for _, opt := range opts {
+			opt.apply(logger)
+		}
+
+		sl, err := wrapper.NewSlogLogger(logger.level, logger.allSinks(), logger.encoder)
+		if err != nil {
+			return nil, err
+		}
+		logger.l = sl
 
 		return logger, nil
 	default:
@@ -72,39 +145,91 @@ func LoggerFactory(loggerType types.LoggerType, opts ...LoggerOption) (port.Logg
 	}
 }
 
+// allSinks returns the sinks of WithRoller and WithStdOut, written at the level and with the
+// encoder of the logger, followed by those of WithSink.
+func (l *Logger) allSinks() []port.Sink {
+	var sinks []port.Sink
+	if l.roller != nil {
+		sinks = append(sinks, port.Sink{Roller: l.roller})
+	}
+	if l.stdOut {
+		sinks = append(sinks, port.Sink{})
+	}
+	return append(sinks, l.sinks...)
+}
+
+func (l *Logger) With(fields ...types.Field) port.Logger {
+	child := *l
+	child.l = l.l.With(fields...)
+	child.bound = append(l.bound[:len(l.bound):len(l.bound)], fields...)
+	return &child
+}
+
+func (l *Logger) Named(name string) port.Logger {
+	child := *l
+	child.l = l.l.Named(name)
+	return &child
+}
+
+// WithoutCaller returns a child logger that leaves the caller out of its entries, if the
+// underlying logger supports it.
+func (l *Logger) WithoutCaller() port.Logger {
+	child := *l
+	if o, ok := l.l.(port.CallerOmitter); ok {
+		child.l = o.WithoutCaller()
+	}
+	return &child
+}
+
 func (l *Logger) Debug(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.DebugLevel, message, fields)
 	l.l.Debug(ctx, message, fields...)
 }
 
 func (l *Logger) Info(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.InfoLevel, message, fields)
 	l.l.Info(ctx, message, fields...)
 }
 
 func (l *Logger) Warn(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.WarnLevel, message, fields)
 	l.l.Warn(ctx, message, fields...)
 }
 
 func (l *Logger) Error(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.ErrorLevel, message, fields)
 	l.l.Error(ctx, message, fields...)
 }
 
 func (l *Logger) Fatal(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.FatalLevel, message, fields)
 	l.l.Fatal(ctx, message, fields...)
 }
 
 func (l *Logger) Panic(ctx context.Context, message string, fields ...types.Field) {
-	fields = _appendFields(fields...)
+	fields = l.appendFields(ctx, fields...)
+	l.addSpanEvent(ctx, types.PanicLevel, message, fields)
 	l.l.Panic(ctx, message, fields...)
 }
 
-func _appendFields(fields ...types.Field) []types.Field {
-	if _serviceName != "" {
-		fields = append(fields, ServiceNameField(_serviceName))
+// appendFields adds the fields attached to ctx, the ids of its trace and the service name
+// to fields.
+func (l *Logger) appendFields(ctx context.Context, fields ...types.Field) []types.Field {
+	if ctxFields := ContextFields(ctx); len(ctxFields) > 0 {
+		fields = append(ctxFields[:len(ctxFields):len(ctxFields)], fields...)
+	}
+	fields = append(fields, TraceFields(ctx)...)
+	serviceName := l.serviceName
+	if serviceName == "" {
+		serviceName, _ = _serviceName.Load().(string)
+	}
+	if serviceName != "" {
+		fields = append(fields, ServiceNameField(serviceName))
 	}
 	return fields
 }
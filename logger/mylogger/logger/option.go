@@ -32,3 +32,70 @@ func WithStdOut(stdOut bool) LoggerOption {
 		log.stdOut = stdOut
 	})
 }
+
+// WithSink adds an output with its own level and format, such as an error only file next
+// to stdout. Sinks are written to after those of WithRoller and WithStdOut.
+func WithSink(sink port.Sink) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.sinks = append(log.sinks, sink)
+	})
+}
+
+// WithSpanEvents also records every entry as an event of the span in its context, so that
+// the entries show up in the trace.
+func WithSpanEvents(enabled bool) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.spanEvents = enabled
+	})
+}
+
+// WithServiceName adds the service_name field to every entry, instead of the name set by
+// SetServiceName.
+func WithServiceName(serviceName string) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.serviceName = serviceName
+	})
+}
+
+// WithEncoderConfig replaces the whole format of entries, such as with
+// types.ECSEncoderConfig(). Options given after it change parts of it.
+func WithEncoderConfig(encoder types.EncoderConfig) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder = encoder
+	})
+}
+
+// WithEncoding writes entries as JSON or as console friendly text.
+func WithEncoding(encoding types.Encoding) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder.Encoding = encoding
+	})
+}
+
+// WithKeys renames the keys of the entry properties.
+func WithKeys(keys types.EncoderKeys) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder.Keys = keys
+	})
+}
+
+// WithTimeFormat formats times as one of the types time formats, or with a time layout.
+func WithTimeFormat(format string) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder.TimeFormat = format
+	})
+}
+
+// WithStacktrace adds a stacktrace to entries at level or above. An empty level disables it.
+func WithStacktrace(level types.Level) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder.StacktraceLevel = level
+	})
+}
+
+// WithCaller includes the caller of each entry.
+func WithCaller(enabled bool) LoggerOption {
+	return loggerOptionFunc(func(log *Logger) {
+		log.encoder.Caller = enabled
+	})
+}
@@ -0,0 +1,21 @@
+package port
+
+import "github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+
+// Leveler changes the level of a logger at runtime.
+type Leveler interface {
+	SetLevel(level types.Level) error
+	GetLevel() types.Level
+
+	// SetNamedLevel overrides the level of the logger name and its children, such as
+	// "reserve" for the loggers returned by Named("reserve").
+	SetNamedLevel(name string, level types.Level) error
+	UnsetNamedLevel(name string)
+	NamedLevels() map[string]types.Level
+}
+
+// LevelEnabler reports whether a logger writes entries of a level, so that callers can skip
+// building entries that would be dropped.
+type LevelEnabler interface {
+	Enabled(level types.Level) bool
+}
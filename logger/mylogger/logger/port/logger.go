@@ -13,6 +13,17 @@ type Logger interface {
 	Error(ctx context.Context, message string, fields ...types.Field)
 	Fatal(ctx context.Context, message string, fields ...types.Field)
 	Panic(ctx context.Context, message string, fields ...types.Field)
+
+	// With returns a child logger adding fields to every entry.
+	With(fields ...types.Field) Logger
+	// Named returns a child logger whose name is extended by name.
+	Named(name string) Logger
+}
+
+// CallerOmitter returns a child logger that leaves the caller out of its entries, such as
+// for entries logged on behalf of code whose caller is already known.
+type CallerOmitter interface {
+	WithoutCaller() Logger
 }
 
 func LoggerFactory(loggerType types.LoggerType, config string) (Logger, error) {
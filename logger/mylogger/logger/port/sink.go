@@ -0,0 +1,15 @@
+package port
+
+import "github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+
+// Sink is an output of a logger with its own level and format.
+type Sink struct {
+	// Roller is the file the sink writes to, or nil for stdout.
+	Roller Roller
+	// Level is the lowest level the sink writes, on top of the level of the logger.
+	// Empty writes every entry the logger lets through.
+	Level types.Level
+	// Encoder is the format of the sink. A zero value uses the encoder of the logger.
+	// Callers and stacktraces are added as the encoder of the logger says.
+	Encoder types.EncoderConfig
+}
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+// SlogHandler is a slog.Handler writing records through a mylogger logger, so that
+// libraries logging with slog share its sink, context fields and service name.
+type SlogHandler struct {
+	l     port.Logger
+	group string
+}
+
+// NewSlogHandler creates a SlogHandler writing through l, such as for
+// slog.SetDefault(slog.New(logger.NewSlogHandler(logger.Default()))). The caller l would
+// log is the handler itself, so entries carry the caller of slog as "source" instead.
+func NewSlogHandler(l port.Logger) *SlogHandler {
+	if o, ok := l.(port.CallerOmitter); ok {
+		l = o.WithoutCaller()
+	}
+	return &SlogHandler{l: l}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if e, ok := h.l.(port.LevelEnabler); ok {
+		return e.Enabled(fromSlogLevel(level))
+	}
+	return true
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]types.Field, 0, r.NumAttrs()+1)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.group, a)
+		return true
+	})
+	if r.PC != 0 {
+		// l leaves out its caller, which would be this handler
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file := filepath.Join(filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File))
+		fields = append(fields, types.WithStringField("source", fmt.Sprintf("%s:%d", file, frame.Line)))
+	}
+
+	switch fromSlogLevel(r.Level) {
+	case types.DebugLevel:
+		h.l.Debug(ctx, r.Message, fields...)
+	case types.InfoLevel:
+		h.l.Info(ctx, r.Message, fields...)
+	case types.WarnLevel:
+		h.l.Warn(ctx, r.Message, fields...)
+	default:
+		h.l.Error(ctx, r.Message, fields...)
+	}
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]types.Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, h.group, a)
+	}
+	return &SlogHandler{l: h.l.With(fields...), group: h.group}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{l: h.l, group: h.group + name + "."}
+}
+
+// appendSlogAttr appends a as fields named with the prefix of its groups, like "http.status".
+func appendSlogAttr(fields []types.Field, prefix string, a slog.Attr) []types.Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		group := prefix
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			fields = appendSlogAttr(fields, group, ga)
+		}
+		return fields
+	}
+	if a.Key == "" {
+		return fields
+	}
+
+	name := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, types.WithStringField(name, v.String()))
+	case slog.KindInt64:
+		return append(fields, types.WithInt64Field(name, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, types.WithUint64Field(name, v.Uint64()))
+	default:
+		return append(fields, types.WithAnyField(name, v.Any()))
+	}
+}
+
+// fromSlogLevel maps slog levels, which may lie between the named ones, to the level at or
+// below them.
+func fromSlogLevel(level slog.Level) types.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return types.DebugLevel
+	case level < slog.LevelWarn:
+		return types.InfoLevel
+	case level < slog.LevelError:
+		return types.WarnLevel
+	default:
+		return types.ErrorLevel
+	}
+}
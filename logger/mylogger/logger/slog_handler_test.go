@@ -0,0 +1,83 @@
+package logger_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+// decode decodes the entries written to r.
+func decode(t *testing.T, r *memRoller) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range r.lines() {
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFieldsNamedLikeBuiltIns(t *testing.T) {
+	for _, typ := range []types.LoggerType{types.ZapLoggerType, types.SlogLoggerType} {
+		roller := &memRoller{path: fmt.Sprintf("%s-%d", t.Name(), typ)}
+		l, err := logger.LoggerFactory(typ,
+			logger.WithLevel(types.InfoLevel),
+			logger.WithRoller(roller),
+			logger.WithEncoderConfig(types.ECSEncoderConfig()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l.Info(context.Background(), "fields",
+			types.WithStringField("time", "yesterday"),
+			types.WithStringField("level", "high"))
+
+		entries := decode(t, roller)
+		if len(entries) != 1 {
+			t.Fatalf("logger %d: %d entries, want 1", typ, len(entries))
+		}
+		e := entries[0]
+		if e["time"] != "yesterday" || e["level"] != "high" {
+			t.Errorf("logger %d: time = %v, level = %v, want the fields as logged", typ, e["time"], e["level"])
+		}
+		if e["log.level"] != "info" || e["message"] != "fields" || e["@timestamp"] == nil {
+			t.Errorf("logger %d: entry %v lacks its own level, message or time", typ, e)
+		}
+	}
+}
+
+func TestSlogHandlerSource(t *testing.T) {
+	for _, typ := range []types.LoggerType{types.ZapLoggerType, types.SlogLoggerType} {
+		roller := &memRoller{path: fmt.Sprintf("%s-%d", t.Name(), typ)}
+		l, err := logger.LoggerFactory(typ, logger.WithLevel(types.InfoLevel), logger.WithRoller(roller))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slog.New(logger.NewSlogHandler(l)).Info("through slog", "n", 1)
+		l.Info(context.Background(), "direct")
+
+		entries := decode(t, roller)
+		if len(entries) != 2 {
+			t.Fatalf("logger %d: %d entries, want 2", typ, len(entries))
+		}
+		if caller, ok := entries[0]["caller"]; ok {
+			t.Errorf("logger %d: slog entry has caller %v", typ, caller)
+		}
+		if source, _ := entries[0]["source"].(string); !strings.HasPrefix(source, "logger/slog_handler_test.go:") {
+			t.Errorf("logger %d: source = %q, want this file", typ, source)
+		}
+		if caller, _ := entries[1]["caller"].(string); !strings.HasPrefix(caller, "logger/slog_handler_test.go:") {
+			t.Errorf("logger %d: caller = %q, want this file", typ, caller)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTraceparent returns a copy of ctx carrying the remote span of a W3C traceparent header,
+// such as "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", so that entries logged
+// with it are linked to the trace. ctx is returned as is if the header is invalid.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	sc, err := parseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func parseTraceparent(traceparent string) (trace.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return trace.SpanContext{}, fmt.Errorf("invalid traceparent: %s", traceparent)
+	}
+	// version 00 has exactly four parts, later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return trace.SpanContext{}, fmt.Errorf("invalid traceparent: %s", traceparent)
+	}
+
+	traceId, err := trace.TraceIDFromHex(parts[1])
+	if err != nil {
+		return trace.SpanContext{}, fmt.Errorf("invalid traceparent trace id: %v", err)
+	}
+	spanId, err := trace.SpanIDFromHex(parts[2])
+	if err != nil {
+		return trace.SpanContext{}, fmt.Errorf("invalid traceparent span id: %v", err)
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, fmt.Errorf("invalid traceparent flags: %v", err)
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceId,
+		SpanID:     spanId,
+		TraceFlags: trace.TraceFlags(flags),
+		Remote:     true,
+	}), nil
+}
+
+// TraceFields returns the trace_id and span_id fields of the span in ctx, if any.
+func TraceFields(ctx context.Context) []types.Field {
+	if ctx == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []types.Field{
+		types.WithStringField("trace_id", sc.TraceID().String()),
+		types.WithStringField("span_id", sc.SpanID().String()),
+	}
+}
+
+// addSpanEvent records an entry as an event of the span in ctx, if it is being recorded,
+// WithSpanEvents is enabled and the level of the entry is, so that span events do not
+// carry entries the logger drops.
+func (l *Logger) addSpanEvent(ctx context.Context, level types.Level, message string, fields []types.Field) {
+	if !l.spanEvents || ctx == nil || !l.Enabled(level) {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(l.bound)+len(fields)+1)
+	attrs = append(attrs, attribute.String("level", string(level)))
+	for _, f := range append(l.bound[:len(l.bound):len(l.bound)], fields...) {
+		if f.Name == "" {
+			continue
+		}
+		attrs = append(attrs, spanAttribute(f))
+	}
+	span.AddEvent(message, trace.WithAttributes(attrs...))
+}
+
+func spanAttribute(f types.Field) attribute.KeyValue {
+	switch f.Type {
+	case types.StringType:
+		return attribute.String(f.Name, f.ValueString)
+	case types.BytesType:
+		return attribute.String(f.Name, string(f.ValueBytes))
+	case types.Int32Type:
+		return attribute.Int64(f.Name, int64(f.ValueInt32))
+	case types.Int64Type:
+		return attribute.Int64(f.Name, f.ValueInt64)
+	case types.Uint32Type:
+		return attribute.Int64(f.Name, int64(f.ValueUint32))
+	case types.Uint64Type:
+		return attribute.String(f.Name, fmt.Sprint(f.ValueUint64))
+	default:
+		return attribute.String(f.Name, fmt.Sprint(f.ValueAny))
+	}
+}
@@ -0,0 +1,49 @@
+package logger_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan records the names of the events added to it.
+type recordingSpan struct {
+	trace.Span
+	events []string
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption) {
+	s.events = append(s.events, name)
+}
+
+func TestSpanEventsFollowLevel(t *testing.T) {
+	for _, typ := range []types.LoggerType{types.ZapLoggerType, types.SlogLoggerType} {
+		l, err := logger.LoggerFactory(typ,
+			logger.WithLevel(types.InfoLevel),
+			logger.WithRoller(&memRoller{path: fmt.Sprintf("%s-%d", t.Name(), typ)}),
+			logger.WithSpanEvents(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		span := &recordingSpan{Span: trace.SpanFromContext(context.Background())}
+		ctx := trace.ContextWithSpan(context.Background(), span)
+
+		l.Debug(ctx, "dropped")
+		l.Info(ctx, "kept")
+		if err = l.(port.Leveler).SetLevel(types.DebugLevel); err != nil {
+			t.Fatal(err)
+		}
+		l.Debug(ctx, "debugging")
+
+		if got := span.events; len(got) != 2 || got[0] != "kept" || got[1] != "debugging" {
+			t.Errorf("logger %d: span events = %v, want [kept debugging]", typ, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package types
+
+type Encoding string
+
+const (
+	JSONEncoding    Encoding = "json"
+	ConsoleEncoding Encoding = "console"
+)
+
+// Time formats of EncoderConfig.TimeFormat. Any other value is used as a time layout,
+// such as time.RFC1123.
+const (
+	ISO8601TimeFormat     = "iso8601"
+	RFC3339TimeFormat     = "rfc3339"
+	RFC3339NanoTimeFormat = "rfc3339nano"
+	EpochTimeFormat       = "epoch"
+	EpochMillisTimeFormat = "epoch_millis"
+	EpochNanosTimeFormat  = "epoch_nanos"
+)
+
+// EncoderKeys are the keys of the entry properties. An empty key leaves the property out.
+type EncoderKeys struct {
+	Message    string
+	Level      string
+	Time       string
+	Name       string
+	Caller     string
+	Stacktrace string
+}
+
+// EncoderConfig is the format of entries.
+type EncoderConfig struct {
+	Encoding   Encoding
+	Keys       EncoderKeys
+	TimeFormat string
+	// UppercaseLevel writes levels like "INFO" instead of "info".
+	UppercaseLevel bool
+	// StacktraceLevel is the lowest level of entries with a stacktrace, or empty for none.
+	StacktraceLevel Level
+	Caller          bool
+}
+
+// DefaultEncoderConfig writes JSON entries with ISO8601 times, callers and no stacktraces.
+func DefaultEncoderConfig() EncoderConfig {
+	return EncoderConfig{
+		Encoding: JSONEncoding,
+		Keys: EncoderKeys{
+			Message:    "msg",
+			Level:      "level",
+			Time:       "time",
+			Name:       "logger",
+			Caller:     "caller",
+			Stacktrace: "stacktrace",
+		},
+		TimeFormat: ISO8601TimeFormat,
+		Caller:     true,
+	}
+}
+
+// ECSEncoderConfig uses the keys of the Elastic Common Schema.
+func ECSEncoderConfig() EncoderConfig {
+	c := DefaultEncoderConfig()
+	c.Keys = EncoderKeys{
+		Message:    "message",
+		Level:      "log.level",
+		Time:       "@timestamp",
+		Name:       "log.logger",
+		Caller:     "log.origin.file.name",
+		Stacktrace: "error.stack_trace",
+	}
+	c.TimeFormat = RFC3339NanoTimeFormat
+	return c
+}
+
+// GCPEncoderConfig uses the keys of Google Cloud Logging structured logs.
+func GCPEncoderConfig() EncoderConfig {
+	c := DefaultEncoderConfig()
+	c.Keys = EncoderKeys{
+		Message:    "message",
+		Level:      "severity",
+		Time:       "time",
+		Name:       "logger",
+		Caller:     "caller",
+		Stacktrace: "stack_trace",
+	}
+	c.TimeFormat = RFC3339NanoTimeFormat
+	c.UppercaseLevel = true
+	return c
+}
+
+// DatadogEncoderConfig uses the keys of Datadog's standard attributes.
+func DatadogEncoderConfig() EncoderConfig {
+	c := DefaultEncoderConfig()
+	c.Keys = EncoderKeys{
+		Message:    "message",
+		Level:      "status",
+		Time:       "timestamp",
+		Name:       "logger.name",
+		Caller:     "logger.caller",
+		Stacktrace: "error.stack",
+	}
+	c.TimeFormat = RFC3339NanoTimeFormat
+	return c
+}
@@ -4,4 +4,5 @@ type LoggerType uint8
 
 const (
 	ZapLoggerType LoggerType = iota + 1
+	SlogLoggerType
 )
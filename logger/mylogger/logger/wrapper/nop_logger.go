@@ -0,0 +1,71 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+)
+
+var _ port.Leveler = (*NopLogger)(nil)
+
+// NopLogger discards every entry. Fatal and Panic still exit and panic, so that code
+// behaves the same whichever logger it is given.
+type NopLogger struct{}
+
+func NewNopLogger() *NopLogger {
+	return &NopLogger{}
+}
+
+func (n *NopLogger) With(fields ...types.Field) port.Logger {
+	return n
+}
+
+func (n *NopLogger) Named(name string) port.Logger {
+	return n
+}
+
+func (n *NopLogger) WithoutCaller() port.Logger {
+	return n
+}
+
+func (n *NopLogger) Debug(ctx context.Context, message string, fields ...types.Field) {}
+
+func (n *NopLogger) Info(ctx context.Context, message string, fields ...types.Field) {}
+
+func (n *NopLogger) Warn(ctx context.Context, message string, fields ...types.Field) {}
+
+func (n *NopLogger) Error(ctx context.Context, message string, fields ...types.Field) {}
+
+func (n *NopLogger) Fatal(ctx context.Context, message string, fields ...types.Field) {
+	os.Exit(1)
+}
+
+func (n *NopLogger) Panic(ctx context.Context, message string, fields ...types.Field) {
+	panic(message)
+}
+
+func (n *NopLogger) SetLevel(level types.Level) error {
+	_, err := toZapLevel(level)
+	return err
+}
+
+func (n *NopLogger) GetLevel() types.Level {
+	return types.PanicLevel
+}
+
+func (n *NopLogger) SetNamedLevel(name string, level types.Level) error {
+	_, err := toZapLevel(level)
+	return err
+}
+
+func (n *NopLogger) Enabled(level types.Level) bool {
+	return false
+}
+
+func (n *NopLogger) UnsetNamedLevel(name string) {}
+
+func (n *NopLogger) NamedLevels() map[string]types.Level {
+	return map[string]types.Level{}
+}
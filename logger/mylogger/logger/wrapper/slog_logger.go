@@ -0,0 +1,347 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ port.Closer = (*SlogLogger)(nil)
+var _ port.Leveler = (*SlogLogger)(nil)
+var _ port.CallerOmitter = (*SlogLogger)(nil)
+
+// slog levels of fatal and panic entries, above slog.LevelError.
+const (
+	slogLevelFatal = slog.Level(12)
+	slogLevelPanic = slog.Level(16)
+)
+
+// SlogLogger writes entries with a log/slog handler in the same shape as ZapLogger.
+type SlogLogger struct {
+	handler slog.Handler
+	name    string
+	levels  *zapLevels
+	rollers []port.Roller
+	nameKey string
+	// noCaller leaves the caller out of entries, see WithoutCaller.
+	noCaller bool
+
+	stacktrace      bool
+	stacktraceLevel zapcore.Level
+	stacktraceKey   string
+}
+
+func NewSlogLogger(level types.Level, sinks []port.Sink, encoder types.EncoderConfig) (*SlogLogger, error) {
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	var stacktraceLevel zapcore.Level
+	if encoder.StacktraceLevel != "" {
+		if stacktraceLevel, err = toZapLevel(encoder.StacktraceLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	tee := make(slogTee, 0, len(sinks))
+	var rollers []port.Roller
+	for _, sink := range sinks {
+		s, err := newSlogSink(sink, encoder)
+		if err != nil {
+			return nil, err
+		}
+		tee = append(tee, s)
+		if sink.Roller != nil {
+			rollers = append(rollers, sink.Roller)
+		}
+	}
+
+	return &SlogLogger{
+		handler:         tee,
+		levels:          newZapLevels(zlevel),
+		rollers:         rollers,
+		nameKey:         encoder.Keys.Name,
+		stacktrace:      encoder.StacktraceLevel != "" && encoder.Keys.Stacktrace != "",
+		stacktraceLevel: stacktraceLevel,
+		stacktraceKey:   encoder.Keys.Stacktrace,
+	}, nil
+}
+
+func newSlogSink(sink port.Sink, encoder types.EncoderConfig) (slogSink, error) {
+	level := slog.LevelDebug
+	if sink.Level != "" {
+		zlevel, err := toZapLevel(sink.Level)
+		if err != nil {
+			return slogSink{}, err
+		}
+		level = toSlogLevel(zlevel)
+	}
+	caller := encoder.Caller
+	if sink.Encoder.Encoding != "" {
+		encoder = sink.Encoder
+	}
+
+	var w io.Writer = os.Stdout
+	if sink.Roller != nil {
+		w = sink.Roller
+	}
+	opts := &slog.HandlerOptions{
+		AddSource: caller,
+		// SlogLogger filters entries by the level of their logger, and slogTee by the sink
+		Level:       slog.LevelDebug,
+		ReplaceAttr: slogReplacer(encoder),
+	}
+	switch encoder.Encoding {
+	case types.JSONEncoding:
+		return slogSink{handler: slog.NewJSONHandler(w, opts), level: level}, nil
+	case types.ConsoleEncoding:
+		return slogSink{handler: slog.NewTextHandler(w, opts), level: level}, nil
+	default:
+		return slogSink{}, fmt.Errorf("unknown encoding %s", encoder.Encoding)
+	}
+}
+
+func (s *SlogLogger) Close() error {
+	var errs []error
+	for _, roller := range s.rollers {
+		if err := roller.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SlogLogger) With(fields ...types.Field) port.Logger {
+	child := *s
+	child.handler = s.handler.WithAttrs(slogAttrs(fields...))
+	return &child
+}
+
+func (s *SlogLogger) Named(name string) port.Logger {
+	child := *s
+	if s.name == "" {
+		child.name = name
+	} else {
+		child.name = s.name + "." + name
+	}
+	return &child
+}
+
+// WithoutCaller returns a child logger whose entries have no caller.
+func (s *SlogLogger) WithoutCaller() port.Logger {
+	child := *s
+	child.noCaller = true
+	return &child
+}
+
+func (s *SlogLogger) Debug(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.DebugLevel, slog.LevelDebug, message, fields)
+}
+
+func (s *SlogLogger) Info(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.InfoLevel, slog.LevelInfo, message, fields)
+}
+
+func (s *SlogLogger) Warn(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.WarnLevel, slog.LevelWarn, message, fields)
+}
+
+func (s *SlogLogger) Error(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.ErrorLevel, slog.LevelError, message, fields)
+}
+
+func (s *SlogLogger) Fatal(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.FatalLevel, slogLevelFatal, message, fields)
+	s.Close()
+	os.Exit(1)
+}
+
+func (s *SlogLogger) Panic(ctx context.Context, message string, fields ...types.Field) {
+	s.log(ctx, zapcore.PanicLevel, slogLevelPanic, message, fields)
+	panic(message)
+}
+
+func (s *SlogLogger) SetLevel(level types.Level) error {
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		return err
+	}
+	s.levels.setGlobal(zlevel)
+	return nil
+}
+
+func (s *SlogLogger) GetLevel() types.Level {
+	return typesLevel(s.levels.global.Level())
+}
+
+func (s *SlogLogger) SetNamedLevel(name string, level types.Level) error {
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		return err
+	}
+	s.levels.setNamed(name, zlevel)
+	return nil
+}
+
+func (s *SlogLogger) UnsetNamedLevel(name string) {
+	s.levels.unsetNamed(name)
+}
+
+func (s *SlogLogger) NamedLevels() map[string]types.Level {
+	return s.levels.namedLevels()
+}
+
+func (s *SlogLogger) Enabled(level types.Level) bool {
+	zlevel, err := toZapLevel(level)
+	return err == nil && zlevel >= s.levels.levelOf(s.name)
+}
+
+// log writes an entry for the caller of the caller of the level method, like ZapLogger.
+func (s *SlogLogger) log(ctx context.Context, zlevel zapcore.Level, level slog.Level, message string, fields []types.Field) {
+	if zlevel < s.levels.levelOf(s.name) {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// slogReplacer drops the source of a record without pc
+	var pc uintptr
+	if !s.noCaller {
+		var pcs [1]uintptr
+		// skip runtime.Callers, log, the level method and the level method of logger.Logger
+		runtime.Callers(4, pcs[:])
+		pc = pcs[0]
+	}
+	r := slog.NewRecord(time.Now(), level, message, pc)
+	if s.name != "" && s.nameKey != "" {
+		r.AddAttrs(slog.String(s.nameKey, s.name))
+	}
+	r.AddAttrs(slogAttrs(fields...)...)
+	if s.stacktrace && zlevel >= s.stacktraceLevel {
+		r.AddAttrs(slog.String(s.stacktraceKey, string(debug.Stack())))
+	}
+	if err := s.handler.Handle(ctx, r); err != nil {
+		fmt.Fprintf(os.Stderr, "err: slog: %v\n", err)
+	}
+}
+
+// slogReplacer returns a slog.HandlerOptions.ReplaceAttr renaming and formatting the
+// attributes slog adds as encoder does with ZapLogger. ReplaceAttr also sees the fields of
+// entries, so attributes are only rewritten if they have the kind slog gives its own, and
+// a field such as "level" with a string is written as is.
+func slogReplacer(encoder types.EncoderConfig) func(groups []string, a slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return a
+		}
+		switch a.Key {
+		case slog.TimeKey:
+			if a.Value.Kind() != slog.KindTime {
+				return a
+			}
+			return slog.Attr{Key: encoder.Keys.Time, Value: slogTime(a.Value.Time(), encoder.TimeFormat)}
+		case slog.LevelKey:
+			if a.Value.Kind() != slog.KindAny {
+				return a
+			}
+			level, ok := a.Value.Any().(slog.Level)
+			if !ok {
+				return a
+			}
+			name := slogLevelName(level)
+			if encoder.UppercaseLevel {
+				name = strings.ToUpper(name)
+			}
+			return slog.String(encoder.Keys.Level, name)
+		case slog.MessageKey:
+			if a.Value.Kind() != slog.KindString {
+				return a
+			}
+			return slog.Attr{Key: encoder.Keys.Message, Value: a.Value}
+		case slog.SourceKey:
+			source, ok := a.Value.Any().(*slog.Source)
+			if !ok || source == nil {
+				return a
+			}
+			if source.File == "" {
+				// a record without pc, see WithoutCaller
+				return slog.Attr{}
+			}
+			// the package directory and file, like zap's short caller
+			file := filepath.Join(filepath.Base(filepath.Dir(source.File)), filepath.Base(source.File))
+			return slog.String(encoder.Keys.Caller, fmt.Sprintf("%s:%d", file, source.Line))
+		}
+		return a
+	}
+}
+
+func slogLevelName(level slog.Level) string {
+	switch {
+	case level >= slogLevelPanic:
+		return "panic"
+	case level >= slogLevelFatal:
+		return "fatal"
+	default:
+		return strings.ToLower(level.String())
+	}
+}
+
+func slogTime(t time.Time, format string) slog.Value {
+	switch format {
+	case "", types.ISO8601TimeFormat:
+		return slog.StringValue(t.Format("2006-01-02T15:04:05.000Z0700"))
+	case types.RFC3339TimeFormat:
+		return slog.StringValue(t.Format(time.RFC3339))
+	case types.RFC3339NanoTimeFormat:
+		return slog.StringValue(t.Format(time.RFC3339Nano))
+	case types.EpochTimeFormat:
+		return slog.Float64Value(float64(t.UnixNano()) / float64(time.Second))
+	case types.EpochMillisTimeFormat:
+		return slog.Float64Value(float64(t.UnixNano()) / float64(time.Millisecond))
+	case types.EpochNanosTimeFormat:
+		return slog.Int64Value(t.UnixNano())
+	default:
+		return slog.StringValue(t.Format(format))
+	}
+}
+
+func slogAttrs(fields ...types.Field) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		if f.Name == "" {
+			continue
+		}
+		switch f.Type {
+		case types.StringType:
+			attrs = append(attrs, slog.String(f.Name, f.ValueString))
+		case types.BytesType:
+			attrs = append(attrs, slog.String(f.Name, string(f.ValueBytes)))
+		case types.Int32Type:
+			attrs = append(attrs, slog.Int64(f.Name, int64(f.ValueInt32)))
+		case types.Int64Type:
+			attrs = append(attrs, slog.Int64(f.Name, f.ValueInt64))
+		case types.Uint32Type:
+			attrs = append(attrs, slog.Uint64(f.Name, uint64(f.ValueUint32)))
+		case types.Uint64Type:
+			attrs = append(attrs, slog.Uint64(f.Name, f.ValueUint64))
+		case types.AnyType:
+			attrs = append(attrs, slog.Any(f.Name, f.ValueAny))
+		default:
+			panic(fmt.Errorf("unknown field type, %d(%s)", f.Type, f.Name))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,73 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// slogSink is the handler of a sink with the lowest level it writes.
+type slogSink struct {
+	handler slog.Handler
+	level   slog.Level
+}
+
+// slogTee hands records to every sink whose level they reach, like zapcore.NewTee.
+type slogTee []slogSink
+
+func (t slogTee) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, s := range t {
+		if level >= s.level && s.handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t slogTee) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, s := range t {
+		if r.Level < s.level || !s.handler.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := s.handler.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t slogTee) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := make(slogTee, len(t))
+	for i, s := range t {
+		child[i] = slogSink{handler: s.handler.WithAttrs(attrs), level: s.level}
+	}
+	return child
+}
+
+func (t slogTee) WithGroup(name string) slog.Handler {
+	child := make(slogTee, len(t))
+	for i, s := range t {
+		child[i] = slogSink{handler: s.handler.WithGroup(name), level: s.level}
+	}
+	return child
+}
+
+func toSlogLevel(level zapcore.Level) slog.Level {
+	switch level {
+	case zapcore.DebugLevel:
+		return slog.LevelDebug
+	case zapcore.InfoLevel:
+		return slog.LevelInfo
+	case zapcore.WarnLevel:
+		return slog.LevelWarn
+	case zapcore.ErrorLevel:
+		return slog.LevelError
+	case zapcore.FatalLevel:
+		return slogLevelFatal
+	default:
+		return slogLevelPanic
+	}
+}
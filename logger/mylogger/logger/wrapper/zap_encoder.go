@@ -0,0 +1,57 @@
+package wrapper
+
+import (
+	"fmt"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func zapEncoder(c types.EncoderConfig) (zapcore.Encoder, error) {
+	switch c.Encoding {
+	case types.JSONEncoding:
+		return zapcore.NewJSONEncoder(zapEncoderConfig(c)), nil
+	case types.ConsoleEncoding:
+		return zapcore.NewConsoleEncoder(zapEncoderConfig(c)), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", c.Encoding)
+	}
+}
+
+func zapEncoderConfig(c types.EncoderConfig) zapcore.EncoderConfig {
+	ec := zap.NewProductionEncoderConfig()
+	ec.MessageKey = c.Keys.Message
+	ec.LevelKey = c.Keys.Level
+	ec.TimeKey = c.Keys.Time
+	ec.NameKey = c.Keys.Name
+	ec.CallerKey = c.Keys.Caller
+	ec.StacktraceKey = c.Keys.Stacktrace
+	ec.FunctionKey = zapcore.OmitKey
+	ec.EncodeTime = zapTimeEncoder(c.TimeFormat)
+	if c.UppercaseLevel {
+		ec.EncodeLevel = zapcore.CapitalLevelEncoder
+	} else {
+		ec.EncodeLevel = zapcore.LowercaseLevelEncoder
+	}
+	return ec
+}
+
+func zapTimeEncoder(format string) zapcore.TimeEncoder {
+	switch format {
+	case "", types.ISO8601TimeFormat:
+		return zapcore.ISO8601TimeEncoder
+	case types.RFC3339TimeFormat:
+		return zapcore.RFC3339TimeEncoder
+	case types.RFC3339NanoTimeFormat:
+		return zapcore.RFC3339NanoTimeEncoder
+	case types.EpochTimeFormat:
+		return zapcore.EpochTimeEncoder
+	case types.EpochMillisTimeFormat:
+		return zapcore.EpochMillisTimeEncoder
+	case types.EpochNanosTimeFormat:
+		return zapcore.EpochNanosTimeEncoder
+	default:
+		return zapcore.TimeEncoderOfLayout(format)
+	}
+}
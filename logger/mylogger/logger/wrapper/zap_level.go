@@ -0,0 +1,137 @@
+package wrapper
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// zapLevels are the levels of a logger and its children: a global level, overridden by
+// the level of the nearest named logger that has one.
+type zapLevels struct {
+	global zap.AtomicLevel
+
+	mu    sync.RWMutex
+	named map[string]zapcore.Level
+	// lowest is the lowest level of all, so that disabled entries are dropped early.
+	lowest zap.AtomicLevel
+}
+
+func newZapLevels(level zapcore.Level) *zapLevels {
+	return &zapLevels{
+		global: zap.NewAtomicLevelAt(level),
+		named:  map[string]zapcore.Level{},
+		lowest: zap.NewAtomicLevelAt(level),
+	}
+}
+
+// levelOf returns the level of the logger name, such as "reserve.usecase", which
+// inherits the level of "reserve" unless it has its own.
+func (lv *zapLevels) levelOf(name string) zapcore.Level {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+
+	if len(lv.named) == 0 {
+		return lv.global.Level()
+	}
+	for name != "" {
+		if level, ok := lv.named[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return lv.global.Level()
+}
+
+func (lv *zapLevels) setGlobal(level zapcore.Level) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	lv.global.SetLevel(level)
+	lv.updateLowest()
+}
+
+func (lv *zapLevels) setNamed(name string, level zapcore.Level) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	lv.named[name] = level
+	lv.updateLowest()
+}
+
+func (lv *zapLevels) unsetNamed(name string) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	delete(lv.named, name)
+	lv.updateLowest()
+}
+
+func (lv *zapLevels) namedLevels() map[string]types.Level {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+
+	levels := make(map[string]types.Level, len(lv.named))
+	for name, level := range lv.named {
+		levels[name] = typesLevel(level)
+	}
+	return levels
+}
+
+// updateLowest must be called with mu held.
+func (lv *zapLevels) updateLowest() {
+	lowest := lv.global.Level()
+	for _, level := range lv.named {
+		if level < lowest {
+			lowest = level
+		}
+	}
+	lv.lowest.SetLevel(lowest)
+}
+
+// levelCore filters the entries of core by the level of the logger that wrote them.
+// core itself must enable every level.
+type levelCore struct {
+	zapcore.Core
+	levels *zapLevels
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.levels.lowest.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.levels.levelOf(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+func (c *levelCore) Level() zapcore.Level {
+	return c.levels.lowest.Level()
+}
+
+func typesLevel(level zapcore.Level) types.Level {
+	switch level {
+	case zapcore.DebugLevel:
+		return types.DebugLevel
+	case zapcore.InfoLevel:
+		return types.InfoLevel
+	case zapcore.WarnLevel:
+		return types.WarnLevel
+	case zapcore.ErrorLevel:
+		return types.ErrorLevel
+	case zapcore.FatalLevel:
+		return types.FatalLevel
+	default:
+		return types.PanicLevel
+	}
+}
@@ -3,7 +3,7 @@ package wrapper
 import (
 	"context"
 	"fmt"
-	"net/url"
+	"os"
 
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
@@ -12,49 +12,78 @@ import (
 )
 
 var _ port.Closer = (*ZapLogger)(nil)
+var _ port.Leveler = (*ZapLogger)(nil)
+var _ port.CallerOmitter = (*ZapLogger)(nil)
 
 type ZapLogger struct {
 	logger *zap.Logger
+	levels *zapLevels
 }
 
-func NewZapLogger(level types.Level, stdOut bool, roller port.Roller) (*ZapLogger, error) {
+func NewZapLogger(level types.Level, sinks []port.Sink, encoder types.EncoderConfig) (*ZapLogger, error) {
 
 	var zlevel zapcore.Level = zapLevel(level)
-	var err error
 
-	config := zap.NewProductionConfig()
-	config.Sampling = nil
-	config.EncoderConfig.TimeKey = "time"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.CallerKey = "caller"
-	// config.EncoderConfig.FunctionKey = "funcName"
-	config.EncoderConfig.StacktraceKey = ""
-
-	config.Level = zap.NewAtomicLevelAt(zlevel)
-	config.Encoding = "json"
-	config.OutputPaths = []string{}
-
-	if roller != nil {
-		zap.RegisterSink("roller", func(*url.URL) (zap.Sink, error) {
-			return roller, nil
-		})
-		config.OutputPaths = append(config.OutputPaths, fmt.Sprintf("roller:%s", roller.GetPath()))
+	// a core for each sink, at the level of the sink
+	cores := make([]zapcore.Core, 0, len(sinks))
+	for _, sink := range sinks {
+		core, err := newZapSinkCore(sink, encoder)
+		if err != nil {
+			return nil, err
+		}
+		cores = append(cores, core)
 	}
 
-	if stdOut {
-		config.OutputPaths = append(config.OutputPaths, "stdout")
+	// levelCore filters entries by the level of their logger before the sinks see them
+	levels := newZapLevels(zlevel)
+	opts := []zap.Option{
+		zap.AddCallerSkip(2),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+	}
+	if encoder.Caller {
+		opts = append(opts, zap.AddCaller())
 	}
+	if encoder.StacktraceLevel != "" {
+		stacktraceLevel, err := toZapLevel(encoder.StacktraceLevel)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, zap.AddStacktrace(stacktraceLevel))
+	}
+
+	core := &levelCore{Core: zapcore.NewTee(cores...), levels: levels}
+	return &ZapLogger{
+		logger: zap.New(core, opts...),
+		levels: levels,
+	}, nil
+}
 
-	_logger, err := config.Build(zap.AddCallerSkip(2))
+func newZapSinkCore(sink port.Sink, encoder types.EncoderConfig) (zapcore.Core, error) {
+	sinkLevel := zapcore.DebugLevel
+	if sink.Level != "" {
+		var err error
+		if sinkLevel, err = toZapLevel(sink.Level); err != nil {
+			return nil, err
+		}
+	}
+	if sink.Encoder.Encoding != "" {
+		encoder = sink.Encoder
+	}
+	enc, err := zapEncoder(encoder)
 	if err != nil {
 		return nil, err
 	}
 
-	zap.ReplaceGlobals(_logger)
-
-	return &ZapLogger{
-		logger: _logger,
-	}, nil
+	var ws zapcore.WriteSyncer
+	if sink.Roller != nil {
+		ws, err = openRollerSink(sink.Roller)
+	} else {
+		ws, _, err = zap.Open("stdout")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zapcore.NewCore(enc, ws, sinkLevel), nil
 }
 
 func (z *ZapLogger) Close() error {
@@ -64,6 +93,63 @@ func (z *ZapLogger) Close() error {
 	return nil
 }
 
+func (z *ZapLogger) With(fields ...types.Field) port.Logger {
+	return &ZapLogger{
+		logger: z.logger.With(convertFields(fields...)...),
+		levels: z.levels,
+	}
+}
+
+func (z *ZapLogger) Named(name string) port.Logger {
+	return &ZapLogger{
+		logger: z.logger.Named(name),
+		levels: z.levels,
+	}
+}
+
+// WithoutCaller returns a child logger whose entries have no caller.
+func (z *ZapLogger) WithoutCaller() port.Logger {
+	return &ZapLogger{
+		logger: z.logger.WithOptions(zap.WithCaller(false)),
+		levels: z.levels,
+	}
+}
+
+func (z *ZapLogger) SetLevel(level types.Level) error {
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		return err
+	}
+	z.levels.setGlobal(zlevel)
+	return nil
+}
+
+func (z *ZapLogger) GetLevel() types.Level {
+	return typesLevel(z.levels.global.Level())
+}
+
+func (z *ZapLogger) SetNamedLevel(name string, level types.Level) error {
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		return err
+	}
+	z.levels.setNamed(name, zlevel)
+	return nil
+}
+
+func (z *ZapLogger) UnsetNamedLevel(name string) {
+	z.levels.unsetNamed(name)
+}
+
+func (z *ZapLogger) Enabled(level types.Level) bool {
+	zlevel, err := toZapLevel(level)
+	return err == nil && zlevel >= z.levels.levelOf(z.logger.Name())
+}
+
+func (z *ZapLogger) NamedLevels() map[string]types.Level {
+	return z.levels.namedLevels()
+}
+
 func (z *ZapLogger) Debug(ctx context.Context, message string, fields ...types.Field) {
 	z.logger.Debug(message, convertFields(fields...)...)
 }
@@ -133,22 +219,28 @@ func convertFields(fields ...types.Field) []zapcore.Field {
 }
 
 func zapLevel(level types.Level) zapcore.Level {
-	var zlevel zapcore.Level
+	zlevel, err := toZapLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	return zlevel
+}
+
+func toZapLevel(level types.Level) (zapcore.Level, error) {
 	switch level {
 	case types.DebugLevel:
-		zlevel = zap.DebugLevel
+		return zap.DebugLevel, nil
 	case types.InfoLevel:
-		zlevel = zap.InfoLevel
+		return zap.InfoLevel, nil
 	case types.WarnLevel:
-		zlevel = zap.WarnLevel
+		return zap.WarnLevel, nil
 	case types.ErrorLevel:
-		zlevel = zap.ErrorLevel
+		return zap.ErrorLevel, nil
 	case types.FatalLevel:
-		zlevel = zap.FatalLevel
+		return zap.FatalLevel, nil
 	case types.PanicLevel:
-		zlevel = zap.PanicLevel
+		return zap.PanicLevel, nil
 	default:
-		panic(fmt.Errorf("unknown log level %s", level))
+		return 0, fmt.Errorf("unknown log level %s", level)
 	}
-	return zlevel
 }
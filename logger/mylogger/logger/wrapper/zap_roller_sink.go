@@ -0,0 +1,61 @@
+package wrapper
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const rollerScheme = "roller"
+
+// zap sinks are registered process wide, so the roller scheme is registered once and
+// looks up the roller of each path in rollerSinks.
+var (
+	rollerSinkOnce sync.Once
+	rollerSinkErr  error
+
+	rollerSinksMu sync.Mutex
+	rollerSinks   = map[string]port.Roller{}
+)
+
+// openRollerSink opens roller as a zap sink, next to the rollers of other paths and
+// other loggers.
+func openRollerSink(roller port.Roller) (zapcore.WriteSyncer, error) {
+	rollerSinkOnce.Do(func() {
+		rollerSinkErr = zap.RegisterSink(rollerScheme, newRollerSink)
+	})
+	if rollerSinkErr != nil {
+		return nil, fmt.Errorf("register roller sink: %v", rollerSinkErr)
+	}
+
+	path := roller.GetPath()
+	rollerSinksMu.Lock()
+	defer rollerSinksMu.Unlock()
+	// the roller is only needed while zap opens it, and a later logger may bring
+	// another roller of the same path
+	rollerSinks[path] = roller
+	defer delete(rollerSinks, path)
+
+	ws, _, err := zap.Open(fmt.Sprintf("%s:%s", rollerScheme, url.PathEscape(path)))
+	if err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// newRollerSink is called by zap.Open with rollerSinksMu held.
+func newRollerSink(u *url.URL) (zap.Sink, error) {
+	path, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return nil, err
+	}
+	roller, ok := rollerSinks[path]
+	if !ok {
+		return nil, fmt.Errorf("no roller of %s", path)
+	}
+	return roller, nil
+}
@@ -0,0 +1,113 @@
+package wrapper_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/wrapper"
+)
+
+func newRoller(t *testing.T, path string) port.Roller {
+	t.Helper()
+	roller := wrapper.NewLmberjackRoller(path, 1, 1, 1, false)
+	t.Cleanup(func() { roller.Close() })
+	return roller
+}
+
+func newZapLogger(t *testing.T, rollers ...port.Roller) *wrapper.ZapLogger {
+	t.Helper()
+	sinks := make([]port.Sink, len(rollers))
+	for i, roller := range rollers {
+		sinks[i] = port.Sink{Roller: roller}
+	}
+	l, err := wrapper.NewZapLogger(types.InfoLevel, sinks, types.DefaultEncoderConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// messages returns the messages written to path, in order.
+func messages(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		// the default encoder writes the message as "msg"
+		_, after, ok := strings.Cut(line, `"msg":"`)
+		if !ok {
+			t.Fatalf("no message in %q", line)
+		}
+		msg, _, _ := strings.Cut(after, `"`)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestRollerSinks(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.log")
+	pathB := filepath.Join(dir, "b.log")
+	pathC := filepath.Join(dir, "c.log")
+	ctx := context.Background()
+
+	rollerA := newRoller(t, pathA)
+	a := newZapLogger(t, rollerA)
+	b := newZapLogger(t, newRoller(t, pathB))
+	// a path registered again by another logger, which shares the roller of the file as
+	// lumberjack rollers of one file would overwrite each other, and two rollers of one logger
+	again := newZapLogger(t, rollerA, newRoller(t, pathC))
+
+	a.Info(ctx, "a")
+	b.Info(ctx, "b")
+	again.Info(ctx, "again")
+	a.Info(ctx, "a2")
+	for _, l := range []*wrapper.ZapLogger{a, b, again} {
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string][]string{
+		pathA: {"a", "again", "a2"},
+		pathB: {"b"},
+		pathC: {"again"},
+	} {
+		if got := messages(t, path); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: messages = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func TestRollerSinksConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.log")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roller := wrapper.NewLmberjackRoller(path, 1, 1, 1, false)
+			defer roller.Close()
+			_, err := wrapper.NewZapLogger(types.InfoLevel, []port.Sink{{Roller: roller}}, types.DefaultEncoderConfig())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
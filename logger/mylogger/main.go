@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"os"
 
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger"
+	"github.com/wonksing/go-tutorials/logger/mylogger/logger/port"
 	"github.com/wonksing/go-tutorials/logger/mylogger/logger/types"
 )
 
@@ -15,21 +17,38 @@ func main() {
 		log.Println("roller:", err)
 		os.Exit(1)
 	}
-	_, err = logger.LoggerFactory(types.ZapLoggerType,
+	errRoller, err := logger.RollerFactory(types.LumberjackRoller, "logs/agent.error.log", 1, 3, 3, true)
+	if err != nil {
+		log.Println("roller:", err)
+		os.Exit(1)
+	}
+	// everything goes to the file, errors to another one and info and above to the console as text
+	console := types.DefaultEncoderConfig()
+	console.Encoding = types.ConsoleEncoding
+	l, err := logger.LoggerFactory(types.ZapLoggerType,
 		logger.WithLevel(types.DebugLevel),
-		logger.WithStdOut(true),
-		logger.WithRoller(roller))
+		logger.WithRoller(roller),
+		logger.WithSink(port.Sink{Roller: errRoller, Level: types.ErrorLevel}),
+		logger.WithSink(port.Sink{Level: types.InfoLevel, Encoder: console}))
 	if err != nil {
 		log.Println("logger:", err)
 		os.Exit(1)
 	}
+	logger.SetDefault(l)
+	// libraries logging with slog write through the same logger
+	slog.SetDefault(slog.New(logger.NewSlogHandler(l.Named("slog"))))
 	logger.SetServiceName("myloggerApp")
 
-	ctx := context.Background()
+	ctx := logger.WithFields(context.Background(), logger.RequestIdField("req-1"), logger.UserIdField("1"))
+	ctx = logger.WithTraceparent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
 	logger.Debug(ctx, "debug message")
 	logger.Info(ctx, "info message")
 	logger.Warn(ctx, "warn message")
 	logger.Error(ctx, "error message")
+
+	reserveLogger := logger.Named("reserve").With(types.WithStringField("component", "usecase"))
+	reserveLogger.Info(ctx, "info message from a child logger")
+	slog.InfoContext(ctx, "info message from slog")
 	// logger.Fatal(ctx, "fatal message")
 	// logger.Panic(ctx, "panic message")
 